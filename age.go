@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"sync"
+)
+
+// sopsAgeKeyFileEnv is the environment variable sops reads age identities from.
+const sopsAgeKeyFileEnv = "SOPS_AGE_KEY_FILE"
+
+// ageKeyFileMu serializes decryptions that set SOPS_AGE_KEY_FILE, since batch
+// files decrypted concurrently share the environment.
+var ageKeyFileMu sync.Mutex
+
+// decryptWithAgeKeyFile runs decrypt with SOPS_AGE_KEY_FILE set to keyFile,
+// restoring the variable's previous value (or absence) afterwards. An empty
+// keyFile leaves the environment alone.
+func decryptWithAgeKeyFile(keyFile string, decrypt func() ([]byte, error)) ([]byte, error) {
+	if keyFile == "" {
+		return decrypt()
+	}
+
+	ageKeyFileMu.Lock()
+	defer ageKeyFileMu.Unlock()
+
+	prev, had := os.LookupEnv(sopsAgeKeyFileEnv)
+	os.Setenv(sopsAgeKeyFileEnv, keyFile)
+	defer func() {
+		if had {
+			os.Setenv(sopsAgeKeyFileEnv, prev)
+		} else {
+			os.Unsetenv(sopsAgeKeyFileEnv)
+		}
+	}()
+	return decrypt()
+}
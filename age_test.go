@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDecryptWithAgeKeyFile(t *testing.T) {
+	decrypt := func(t *testing.T, keyFile, expected string) {
+		t.Helper()
+		var seen string
+		_, err := decryptWithAgeKeyFile(keyFile, func() ([]byte, error) {
+			seen = os.Getenv(sopsAgeKeyFileEnv)
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if seen != expected {
+			t.Errorf("%s during decryption = %q, expected %q", sopsAgeKeyFileEnv, seen, expected)
+		}
+	}
+
+	t.Run("unset before", func(t *testing.T) {
+		t.Setenv(sopsAgeKeyFileEnv, "")
+		os.Unsetenv(sopsAgeKeyFileEnv)
+		decrypt(t, "/keys/age.txt", "/keys/age.txt")
+		if _, ok := os.LookupEnv(sopsAgeKeyFileEnv); ok {
+			t.Errorf("%s still set after decryption", sopsAgeKeyFileEnv)
+		}
+	})
+
+	t.Run("restores previous value", func(t *testing.T) {
+		t.Setenv(sopsAgeKeyFileEnv, "/home/user/keys.txt")
+		decrypt(t, "/keys/age.txt", "/keys/age.txt")
+		if got := os.Getenv(sopsAgeKeyFileEnv); got != "/home/user/keys.txt" {
+			t.Errorf("%s = %q after decryption, expected it restored", sopsAgeKeyFileEnv, got)
+		}
+	})
+
+	t.Run("no key file", func(t *testing.T) {
+		t.Setenv(sopsAgeKeyFileEnv, "/home/user/keys.txt")
+		decrypt(t, "", "/home/user/keys.txt")
+	})
+}
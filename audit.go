@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Statuses recorded in the --audit-log.
+const (
+	auditSuccess = "success"
+	auditError   = "error"
+	auditDryRun  = "dry_run"
+)
+
+// auditEntry is one line of the --audit-log.
+type auditEntry struct {
+	Timestamp    time.Time `json:"timestamp"`
+	VaultPath    string    `json:"vault_path"`
+	Key          string    `json:"key"`
+	Status       string    `json:"status"`
+	ErrorMessage string    `json:"error_message"`
+}
+
+// auditLog writes newline-delimited JSON entries, one per attempted write. It
+// is safe for concurrent use, and a nil *auditLog records nothing.
+type auditLog struct {
+	mu  sync.Mutex
+	w   io.WriteCloser
+	now func() time.Time
+}
+
+// openAuditLog opens the audit log at path for appending, creating it if
+// needed, so earlier runs' entries are kept.
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	return &auditLog{w: f, now: time.Now}, nil
+}
+
+// Record logs one write of key to vaultPath (including the mount), with err
+// as its outcome.
+func (a *auditLog) Record(vaultPath, key string, err error) {
+	entry := auditEntry{VaultPath: vaultPath, Key: key, Status: auditSuccess}
+	if err != nil {
+		entry.Status = auditError
+		entry.ErrorMessage = err.Error()
+	}
+	a.write(entry)
+}
+
+// RecordDryRun logs a write of key to vaultPath that dry-run skipped.
+func (a *auditLog) RecordDryRun(vaultPath, key string) {
+	a.write(auditEntry{VaultPath: vaultPath, Key: key, Status: auditDryRun})
+}
+
+func (a *auditLog) write(entry auditEntry) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry.Timestamp = a.now().UTC()
+	if err := json.NewEncoder(a.w).Encode(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: writing audit log: %v\n", err)
+	}
+}
+
+// Close closes the audit log file.
+func (a *auditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	if err := a.w.Close(); err != nil {
+		return fmt.Errorf("writing audit log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	os.WriteFile(path, []byte("{\"status\":\"earlier run\"}\n"), 0600)
+
+	log, err := openAuditLog(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	log.now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	log.Record("secret/app/db.password", "db.password", nil)
+	log.Record("secret/app/db.url", "db.url", errors.New("permission denied"))
+	log.RecordDryRun("secret/app/api.key", "api.key")
+	if err := log.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries := readAuditLog(t, path)
+	expected := []map[string]interface{}{
+		{"status": "earlier run"},
+		{"timestamp": "2024-05-01T12:00:00Z", "vault_path": "secret/app/db.password", "key": "db.password", "status": "success", "error_message": ""},
+		{"timestamp": "2024-05-01T12:00:00Z", "vault_path": "secret/app/db.url", "key": "db.url", "status": "error", "error_message": "permission denied"},
+		{"timestamp": "2024-05-01T12:00:00Z", "vault_path": "secret/app/api.key", "key": "api.key", "status": "dry_run", "error_message": ""},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("entries = %v, expected %v", entries, expected)
+	}
+
+	// A nil log records nothing
+	var none *auditLog
+	none.Record("secret/app/x", "x", nil)
+	if err := none.Close(); err != nil {
+		t.Errorf("nil Close: unexpected error: %v", err)
+	}
+}
+
+func TestProcessFileAuditLog(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+	mv.handle("PUT", "/v1/secret/data/app/db.url", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+	})
+
+	tmpDir := t.TempDir()
+	sopsFile := filepath.Join(tmpDir, "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("db:\n  password: p\n  url: u\n"), 0644)
+	path := filepath.Join(tmpDir, "audit.jsonl")
+
+	run := func(t *testing.T, cfg Config) []map[string]interface{} {
+		t.Helper()
+		log, err := openAuditLog(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		os.Truncate(path, 0)
+		cfg.AuditLog = log
+		processFile(context.Background(), cfg, sopsFile, "app")
+		if err := log.Close(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return readAuditLog(t, path)
+	}
+
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", KVVersion: 2, Parallelism: 2, ExistsStrategy: strategyOverwrite}
+
+	t.Run("write", func(t *testing.T) {
+		statuses := map[string]string{}
+		for _, e := range run(t, cfg) {
+			statuses[e["vault_path"].(string)+" "+e["key"].(string)] = e["status"].(string)
+			if e["status"] == "error" && e["error_message"] == "" {
+				t.Errorf("error entry without a message: %v", e)
+			}
+		}
+		expected := map[string]string{
+			"secret/app/db.password db.password": "success",
+			"secret/app/db.url db.url":           "error",
+		}
+		if !reflect.DeepEqual(statuses, expected) {
+			t.Errorf("statuses = %v, expected %v", statuses, expected)
+		}
+	})
+
+	t.Run("dry-run bundle", func(t *testing.T) {
+		cfg := cfg
+		cfg.DryRun, cfg.Bundle = true, true
+		entries := run(t, cfg)
+		if len(entries) != 2 {
+			t.Fatalf("got %d entries, expected 2: %v", len(entries), entries)
+		}
+		for i, key := range []string{"db.password", "db.url"} {
+			if entries[i]["key"] != key || entries[i]["vault_path"] != "secret/app" || entries[i]["status"] != "dry_run" {
+				t.Errorf("entry %d = %v, expected dry_run of %s at secret/app", i, entries[i], key)
+			}
+		}
+	})
+}
+
+// readAuditLog parses each line of the audit log at path.
+func readAuditLog(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("opening audit log: %v", err)
+	}
+	defer f.Close()
+	var entries []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
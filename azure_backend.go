@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
+)
+
+// azureMaxSecretName is the longest secret name Azure Key Vault accepts.
+const azureMaxSecretName = 127
+
+// azureInvalidSecretChars matches characters not allowed in an Azure Key
+// Vault secret name, which may only contain letters, digits, and hyphens.
+var azureInvalidSecretChars = regexp.MustCompile(`[^A-Za-z0-9-]`)
+
+// azureKeyVaultAPI is the part of the Key Vault secrets client
+// AzureKeyVaultBackend uses.
+type azureKeyVaultAPI interface {
+	SetSecret(ctx context.Context, name string, parameters azsecrets.SetSecretParameters, options *azsecrets.SetSecretOptions) (azsecrets.SetSecretResponse, error)
+}
+
+// AzureKeyVaultBackend writes each secret to an Azure Key Vault as a secret
+// named <vault-path>-<key>.
+type AzureKeyVaultBackend struct {
+	client azureKeyVaultAPI
+}
+
+// NewAzureKeyVaultBackend creates a Key Vault backend for the vault at
+// vaultURL (https://<name>.vault.azure.net/), using the default Azure
+// credential chain: AZURE_TENANT_ID, AZURE_CLIENT_ID, and AZURE_CLIENT_SECRET,
+// workload or managed identity, or the Azure CLI login.
+func NewAzureKeyVaultBackend(vaultURL string) (*AzureKeyVaultBackend, error) {
+	if vaultURL == "" {
+		return nil, fmt.Errorf("--azure-keyvault-url is required")
+	}
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, fmt.Errorf("loading Azure credentials: %w", err)
+	}
+	client, err := azsecrets.NewClient(vaultURL, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating Key Vault client: %w", err)
+	}
+	return &AzureKeyVaultBackend{client: client}, nil
+}
+
+// Location returns the secret name for key: the vault path's segments and
+// key joined by "-", with dots, underscores, and any other character Azure
+// doesn't allow replaced by "-".
+func (a *AzureKeyVaultBackend) Location(basePath, key string) string {
+	name := strings.ReplaceAll(strings.Trim(basePath, "/"), "/", "-") + "-" + key
+	return azureInvalidSecretChars.ReplaceAllString(name, "-")
+}
+
+// WriteSecrets sets each key's secret. Key Vault creates the secret on its
+// first write and adds a new version to it on every later one. A secret that
+// was deleted but not purged can't be written until it is recovered or
+// purged, since soft-deleted names stay reserved. Nothing is written if two
+// keys map to the same secret name.
+func (a *AzureKeyVaultBackend) WriteSecrets(ctx context.Context, basePath string, keys []string, data map[string]interface{}) (int, error) {
+	origin := make(map[string]string, len(keys))
+	for _, key := range keys {
+		name := a.Location(basePath, key)
+		if prev, ok := origin[name]; ok {
+			return 0, fmt.Errorf("keys %q and %q both map to secret %s", prev, key, name)
+		}
+		origin[name] = key
+	}
+
+	written := 0
+	for _, key := range keys {
+		name := a.Location(basePath, key)
+		if len(name) > azureMaxSecretName {
+			return written, fmt.Errorf("secret name %s is longer than the %d characters Key Vault allows", name, azureMaxSecretName)
+		}
+		value := formatValue(data[key])
+		_, err := a.client.SetSecret(ctx, name, azsecrets.SetSecretParameters{Value: &value}, nil)
+		var respErr *azcore.ResponseError
+		if errors.As(err, &respErr) && respErr.StatusCode == http.StatusConflict {
+			return written, fmt.Errorf("failed to write Key Vault secret %s: it is deleted but not purged, recover or purge it first: %w", name, err)
+		}
+		if err != nil {
+			return written, fmt.Errorf("failed to write Key Vault secret %s: %w", name, err)
+		}
+		written++
+	}
+	return written, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
+)
+
+// fakeAzureKeyVault stores the versions set for each secret name.
+type fakeAzureKeyVault struct {
+	versions map[string][]string
+	deleted  map[string]bool
+}
+
+func (f *fakeAzureKeyVault) SetSecret(ctx context.Context, name string, parameters azsecrets.SetSecretParameters, options *azsecrets.SetSecretOptions) (azsecrets.SetSecretResponse, error) {
+	if f.deleted[name] {
+		return azsecrets.SetSecretResponse{}, &azcore.ResponseError{StatusCode: http.StatusConflict, ErrorCode: "Conflict"}
+	}
+	f.versions[name] = append(f.versions[name], *parameters.Value)
+	return azsecrets.SetSecretResponse{}, nil
+}
+
+func TestAzureKeyVaultBackendWriteSecrets(t *testing.T) {
+	fake := &fakeAzureKeyVault{versions: map[string][]string{"myapp-db-password": {"old"}}}
+	backend := &AzureKeyVaultBackend{client: fake}
+
+	data := map[string]interface{}{"db.password": "s3cr3t", "db.port": 5432}
+	written, err := backend.WriteSecrets(context.Background(), "myapp", []string{"db.password", "db.port"}, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if written != 2 {
+		t.Errorf("written = %d, expected 2", written)
+	}
+	expected := map[string][]string{
+		"myapp-db-password": {"old", "s3cr3t"},
+		"myapp-db-port":     {"5432"},
+	}
+	if !reflect.DeepEqual(fake.versions, expected) {
+		t.Errorf("versions = %v, expected %v", fake.versions, expected)
+	}
+
+	t.Run("deleted secret", func(t *testing.T) {
+		fake := &fakeAzureKeyVault{versions: map[string][]string{}, deleted: map[string]bool{"myapp-token": true}}
+		backend := &AzureKeyVaultBackend{client: fake}
+		_, err := backend.WriteSecrets(context.Background(), "myapp", []string{"token"}, map[string]interface{}{"token": "t"})
+		if err == nil || !strings.Contains(err.Error(), "recover or purge") {
+			t.Errorf("expected deleted secret error, got %v", err)
+		}
+	})
+
+	t.Run("name too long", func(t *testing.T) {
+		key := strings.Repeat("k", azureMaxSecretName)
+		_, err := backend.WriteSecrets(context.Background(), "myapp", []string{key}, map[string]interface{}{key: "v"})
+		if err == nil {
+			t.Error("expected error for long secret name")
+		}
+	})
+
+	t.Run("colliding names", func(t *testing.T) {
+		fake := &fakeAzureKeyVault{versions: map[string][]string{}}
+		backend := &AzureKeyVaultBackend{client: fake}
+		data := map[string]interface{}{"db.pass": "a", "db_pass": "b"}
+		_, err := backend.WriteSecrets(context.Background(), "myapp", []string{"db.pass", "db_pass"}, data)
+		if err == nil || !strings.Contains(err.Error(), `"db.pass" and "db_pass"`) {
+			t.Fatalf("expected collision error, got %v", err)
+		}
+		if len(fake.versions) != 0 {
+			t.Errorf("expected no writes, got %v", fake.versions)
+		}
+	})
+}
+
+func TestAzureKeyVaultBackendLocation(t *testing.T) {
+	backend := &AzureKeyVaultBackend{}
+	if got := backend.Location("myproject/app/", "db.client_id"); got != "myproject-app-db-client-id" {
+		t.Errorf("Location = %q, expected myproject-app-db-client-id", got)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Names for --backend.
+const (
+	backendVault     = "vault"
+	backendChamber   = "chamber"
+	backendDoppler   = "doppler"
+	backendInfisical = "infisical"
+	backendAWSSM     = "aws-secrets-manager"
+	backendGCPSM     = "gcp-secret-manager"
+	backendAzureKV   = "azure-keyvault"
+	backend1Password = "1password"
+	backendConsul    = "consul"
+	backendK8s       = "kubernetes"
+)
+
+// Backend is a secrets store, other than Vault, that flattened SOPS secrets
+// can be written to.
+type Backend interface {
+	// Location returns where key will be stored, for dry-run output.
+	Location(basePath, key string) string
+	// WriteSecrets writes every key in keys under basePath (the <vault-path>
+	// argument), stopping at the first error. It returns the number written.
+	WriteSecrets(ctx context.Context, basePath string, keys []string, data map[string]interface{}) (int, error)
+}
+
+// newBackend creates the backend selected by cfg.Backend.
+func newBackend(ctx context.Context, cfg Config) (Backend, error) {
+	switch cfg.Backend {
+	case backendChamber:
+		return NewChamberBackend(ctx, cfg.ChamberService, cfg.ChamberKMSKeyAlias)
+	case backendDoppler:
+		return NewDopplerBackend(cfg.DopplerProject, cfg.DopplerConfig, cfg.DopplerToken)
+	case backendInfisical:
+		return NewInfisicalBackend(cfg.InfisicalURL, cfg.InfisicalWorkspaceID, cfg.InfisicalEnvironment, cfg.InfisicalToken)
+	case backendAWSSM:
+		return NewSecretsManagerBackend(ctx)
+	case backendGCPSM:
+		return NewGCPSecretManagerBackend(ctx, cfg.GCPProject)
+	case backendAzureKV:
+		return NewAzureKeyVaultBackend(cfg.AzureKeyVaultURL)
+	case backend1Password:
+		return NewOnePasswordBackend(cfg.OnePasswordHost, cfg.OnePasswordToken)
+	case backendConsul:
+		return NewConsulBackend(cfg.ConsulAddr, cfg.ConsulToken)
+	case backendK8s:
+		return NewKubernetesBackend(cfg.K8sNamespace, cfg.K8sSecretName, cfg.OutputFile, cfg.K8sApply), nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q", cfg.Backend)
+	}
+}
+
+// backendLocation returns the Location of the backend selected by
+// cfg.Backend, without creating a client or checking credentials, for
+// dry-run output.
+func backendLocation(cfg Config) func(basePath, key string) string {
+	var backend Backend
+	switch cfg.Backend {
+	case backendChamber:
+		backend = &ChamberBackend{service: cfg.ChamberService}
+	case backendDoppler:
+		backend = &DopplerBackend{project: cfg.DopplerProject, config: cfg.DopplerConfig}
+	case backendInfisical:
+		backend = &InfisicalBackend{workspaceID: cfg.InfisicalWorkspaceID, environment: cfg.InfisicalEnvironment}
+	case backendAWSSM:
+		backend = &SecretsManagerBackend{}
+	case backendGCPSM:
+		backend = &GCPSecretManagerBackend{project: cfg.GCPProject}
+	case backendAzureKV:
+		backend = &AzureKeyVaultBackend{}
+	case backend1Password:
+		backend = &OnePasswordBackend{}
+	case backendConsul:
+		backend = &ConsulBackend{}
+	case backendK8s:
+		backend = NewKubernetesBackend(cfg.K8sNamespace, cfg.K8sSecretName, cfg.OutputFile, cfg.K8sApply)
+	default:
+		return func(basePath, key string) string { return basePath + "/" + key }
+	}
+	return backend.Location
+}
+
+// validBackend reports whether name is a supported --backend value.
+func validBackend(name string) bool {
+	switch name {
+	case backendVault, backendChamber, backendDoppler, backendInfisical, backendAWSSM, backendGCPSM, backendAzureKV, backend1Password, backendConsul, backendK8s:
+		return true
+	}
+	return false
+}
+
+// envVarName maps a flattened key to the upper-case, underscore-separated
+// secret name used by env-var oriented stores: "db.password" -> "DB_PASSWORD".
+func envVarName(key string) string {
+	return strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestEnvVarName(t *testing.T) {
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{"db.password", "DB_PASSWORD"},
+		{"token", "TOKEN"},
+		{"admin.oauth2.client-id", "ADMIN_OAUTH2_CLIENT_ID"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if result := envVarName(tt.key); result != tt.expected {
+				t.Errorf("envVarName(%q) = %q, expected %q", tt.key, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBackendLocation(t *testing.T) {
+	tests := []struct {
+		cfg      Config
+		expected string
+	}{
+		{Config{Backend: backendChamber}, "/myapp/db/password"},
+		{Config{Backend: backendDoppler, DopplerConfig: "prd"}, "myapp/prd/DB_PASSWORD"},
+		{Config{Backend: backendAWSSM}, "myapp/db.password"},
+		{Config{Backend: backend1Password}, "op://myapp/db.password/value"},
+		{Config{Backend: backendConsul}, "myapp/db.password"},
+		{Config{Backend: backendK8s, K8sNamespace: "default"}, "default/myapp[db.password]"},
+	}
+
+	// No credentials are needed for any of them
+	for _, tt := range tests {
+		t.Run(tt.cfg.Backend, func(t *testing.T) {
+			if result := backendLocation(tt.cfg)("myapp", "db.password"); result != tt.expected {
+				t.Errorf("location = %q, expected %q", result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// backupSecrets reads what each of paths (under the mount) holds before it is
+// overwritten and saves it to file as JSON: a map of mount-prefixed path to
+// the secret's data, or null for a path that doesn't exist yet. The file is
+// only readable by its owner, since it holds secret values. It returns the
+// number of paths that had data.
+func backupSecrets(client VaultWriter, mount string, paths []string, file string) (int, error) {
+	backup := make(map[string]map[string]interface{}, len(paths))
+	existing := 0
+	for _, p := range paths {
+		data, _, err := client.readKV(p)
+		if err != nil {
+			return 0, err
+		}
+		if data != nil {
+			existing++
+		}
+		backup[mount+"/"+p] = data
+	}
+
+	content, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("marshaling backup: %w", err)
+	}
+	if err := os.WriteFile(file, append(content, '\n'), 0600); err != nil {
+		return 0, fmt.Errorf("writing backup file: %w", err)
+	}
+	return existing, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProcessFileBackupVault(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+	mv.seed("secret/data/app/db.password", map[string]interface{}{"value": "old"})
+
+	dir := t.TempDir()
+	sopsFile := filepath.Join(dir, "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("db:\n  password: new\n  url: u\n"), 0644)
+	backupFile := filepath.Join(dir, "backup.json")
+
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", BackupFile: backupFile}
+	if err := processFile(context.Background(), cfg, sopsFile, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := mv.stored("secret/data/app/db.password"); got["value"] != "new" {
+		t.Errorf("db.password = %v, expected new", got)
+	}
+
+	content, err := os.ReadFile(backupFile)
+	if err != nil {
+		t.Fatalf("reading backup: %v", err)
+	}
+	var backup map[string]map[string]interface{}
+	if err := json.Unmarshal(content, &backup); err != nil {
+		t.Fatalf("parsing backup: %v", err)
+	}
+	expected := map[string]map[string]interface{}{
+		"secret/app/db.password": {"value": "old"},
+		"secret/app/db.url":      nil,
+	}
+	if !reflect.DeepEqual(backup, expected) {
+		t.Errorf("backup = %v, expected %v", backup, expected)
+	}
+
+	info, err := os.Stat(backupFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("backup file mode = %o, expected 600", perm)
+	}
+}
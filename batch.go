@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// BatchEntry is one SOPS file to import and the Vault path to import it to.
+type BatchEntry struct {
+	SopsFile  string
+	VaultPath string
+	// Config, if set, replaces the run's Config for this entry.
+	Config *Config
+}
+
+// loadBatchFile reads a batch file with one "<sops-file> <vault-path>" pair
+// per line. Blank lines and lines starting with "#" are ignored. Relative
+// SOPS file paths are resolved against the batch file's directory.
+func loadBatchFile(path string) ([]BatchEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening batch file: %w", err)
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(path)
+	var entries []BatchEntry
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected '<sops-file> <vault-path>', got %q", lineNum, line)
+		}
+
+		sopsFile := fields[0]
+		if !filepath.IsAbs(sopsFile) {
+			sopsFile = filepath.Join(dir, sopsFile)
+		}
+		entries = append(entries, BatchEntry{SopsFile: sopsFile, VaultPath: fields[1]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading batch file: %w", err)
+	}
+
+	return entries, nil
+}
+
+// defaultDirGlob is the --dir-glob default: the usual SOPS file names.
+const defaultDirGlob = "*.enc.yaml,*.sops.yaml"
+
+// dirEntries returns a BatchEntry for each file directly in dir that matches
+// any of patterns, in name order, each written to vaultPath plus its
+// filename cleaned of suffixes. Two files that would be written to the same
+// path are an error.
+func dirEntries(dir, vaultPath string, patterns, suffixes []string) ([]BatchEntry, error) {
+	seen := make(map[string]bool)
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+		}
+		for _, m := range matches {
+			if info, err := os.Stat(m); err != nil || info.IsDir() || seen[m] {
+				continue
+			}
+			seen[m] = true
+			files = append(files, m)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files in %s match %s", dir, strings.Join(patterns, ", "))
+	}
+	sort.Strings(files)
+
+	entries := make([]BatchEntry, len(files))
+	byPath := make(map[string]string)
+	for i, f := range files {
+		p := vaultPath + "/" + cleanFilename(f, suffixes)
+		if other, ok := byPath[p]; ok {
+			return nil, fmt.Errorf("%s and %s would both be written to %s", other, f, p)
+		}
+		byPath[p] = f
+		entries[i] = BatchEntry{SopsFile: f, VaultPath: p}
+	}
+	return entries, nil
+}
+
+// processBatchConcurrent processes entries with up to concurrency files in
+// flight at once. Each file gets its own Vault client. Failures don't stop
+// other files; every error is collected and returned once all files finish.
+// Once ctx is cancelled, files not yet started are reported as errInterrupted.
+func processBatchConcurrent(ctx context.Context, entries []BatchEntry, cfg Config, concurrency int) []error {
+	var errs []error
+	for _, err := range processEntries(ctx, entries, cfg, concurrency) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// entryError is the outcome of the entry at index, sent by a worker.
+type entryError struct {
+	index int
+	err   error
+}
+
+// processEntries is processBatchConcurrent returning the outcome of every
+// entry: the error at each index is nil if that entry succeeded. Workers send
+// failures on a buffered channel, which is drained once they all finish.
+func processEntries(ctx context.Context, entries []BatchEntry, cfg Config, concurrency int) []error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	jobs := make(chan int)
+	// Room for every entry, so workers never block on reporting
+	errCh := make(chan entryError, len(entries))
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				entry := entries[i]
+				if ctx.Err() != nil {
+					errCh <- entryError{i, fmt.Errorf("%s: %w", entry.SopsFile, errInterrupted)}
+					continue
+				}
+				entryCfg := cfg
+				if entry.Config != nil {
+					entryCfg = *entry.Config
+				}
+				if err := processFile(ctx, entryCfg, entry.SopsFile, entry.VaultPath); err != nil {
+					errCh <- entryError{i, fmt.Errorf("%s: %w", entry.SopsFile, err)}
+				}
+			}
+		}()
+	}
+
+	for i := range entries {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	close(errCh)
+
+	errs := make([]error, len(entries))
+	for e := range errCh {
+		errs[e.index] = e.err
+	}
+	return errs
+}
+
+// batchExitCode is the exit status for a --batch or --dir run with errs: 1 if
+// any file failed, otherwise 0. With ignoreMissingKey, files that failed only
+// because no SOPS key was available don't count as failures, and exit 2 if
+// nothing else failed.
+func batchExitCode(errs []error, ignoreMissingKey bool) int {
+	code := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+		case ignoreMissingKey && errors.Is(err, errMissingSopsKey):
+			if code == 0 {
+				code = 2
+			}
+		default:
+			return 1
+		}
+	}
+	return code
+}
+
+// printDirSummary prints one line per file processed with --dir, saying
+// where it was written or why it failed, then the totals.
+func printDirSummary(w io.Writer, mount string, entries []BatchEntry, errs []error) {
+	failed := 0
+	for i, entry := range entries {
+		if errs[i] != nil {
+			failed++
+			fmt.Fprintf(w, "FAILED %v\n", errs[i])
+			continue
+		}
+		fmt.Fprintf(w, "OK     %s -> %s/%s\n", entry.SopsFile, mount, entry.VaultPath)
+	}
+	fmt.Fprintf(w, "Processed %d files (%d failed)\n", len(entries), failed)
+}
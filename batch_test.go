@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLoadBatchFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	t.Run("parses entries", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "batch.txt")
+		content := "# comment\napp-secrets.enc.yaml myproject\n\n/abs/db-secrets.enc.yaml other/path\n"
+		os.WriteFile(path, []byte(content), 0644)
+
+		entries, err := loadBatchFile(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := []BatchEntry{
+			{SopsFile: filepath.Join(tmpDir, "app-secrets.enc.yaml"), VaultPath: "myproject"},
+			{SopsFile: "/abs/db-secrets.enc.yaml", VaultPath: "other/path"},
+		}
+		if !reflect.DeepEqual(entries, expected) {
+			t.Errorf("loadBatchFile() = %v, expected %v", entries, expected)
+		}
+	})
+
+	t.Run("rejects malformed line", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "bad.txt")
+		os.WriteFile(path, []byte("only-one-field\n"), 0644)
+
+		if _, err := loadBatchFile(path); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("expected line 1 error, got %v", err)
+		}
+	})
+}
+
+func TestProcessBatchConcurrent(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+	tmpDir := t.TempDir()
+
+	var entries []BatchEntry
+	for _, name := range []string{"a", "b", "c", "d"} {
+		path := filepath.Join(tmpDir, name+"-secrets.enc.yaml")
+		os.WriteFile(path, []byte("db:\n  password: "+name+"-pass\n"), 0644)
+		entries = append(entries, BatchEntry{SopsFile: path, VaultPath: "apps/" + name})
+	}
+	entries = append(entries, BatchEntry{SopsFile: filepath.Join(tmpDir, "missing.enc.yaml"), VaultPath: "apps/missing"})
+
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", ExistsStrategy: strategyOverwrite}
+	errs := processBatchConcurrent(context.Background(), entries, cfg, 3)
+
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "missing.enc.yaml") {
+		t.Fatalf("expected one error for missing file, got %v", errs)
+	}
+
+	calls := mv.Calls()
+	sort.Strings(calls)
+	expected := []string{
+		"PUT /v1/secret/data/apps/a/db.password",
+		"PUT /v1/secret/data/apps/b/db.password",
+		"PUT /v1/secret/data/apps/c/db.password",
+		"PUT /v1/secret/data/apps/d/db.password",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("calls = %v, expected %v", calls, expected)
+	}
+	if got := mv.stored("secret/data/apps/c/db.password")["value"]; got != "c-pass" {
+		t.Errorf("stored value = %v, expected c-pass", got)
+	}
+}
+
+func TestDirEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"app-secrets.enc.yaml", "db.sops.yaml", "notes.txt", "web.enc.json"} {
+		os.WriteFile(filepath.Join(tmpDir, name), []byte("key: value\n"), 0644)
+	}
+	os.Mkdir(filepath.Join(tmpDir, "nested.enc.yaml"), 0755)
+
+	t.Run("matches default globs", func(t *testing.T) {
+		entries, err := dirEntries(tmpDir, "myproject", splitList(defaultDirGlob), nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := []BatchEntry{
+			{SopsFile: filepath.Join(tmpDir, "app-secrets.enc.yaml"), VaultPath: "myproject/app"},
+			{SopsFile: filepath.Join(tmpDir, "db.sops.yaml"), VaultPath: "myproject/db"},
+		}
+		if !reflect.DeepEqual(entries, expected) {
+			t.Errorf("dirEntries() = %v, expected %v", entries, expected)
+		}
+	})
+
+	t.Run("overlapping globs match once", func(t *testing.T) {
+		entries, err := dirEntries(tmpDir, "myproject", []string{"*.enc.*", "web.*"}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(entries) != 2 || entries[1].VaultPath != "myproject/web" {
+			t.Errorf("dirEntries() = %v, expected app and web", entries)
+		}
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		if _, err := dirEntries(tmpDir, "myproject", []string{"*.toml"}, nil); err == nil || !strings.Contains(err.Error(), "no files") {
+			t.Errorf("expected no files error, got %v", err)
+		}
+	})
+
+	t.Run("colliding names", func(t *testing.T) {
+		os.WriteFile(filepath.Join(tmpDir, "app.sops.yaml"), []byte("key: value\n"), 0644)
+		if _, err := dirEntries(tmpDir, "myproject", splitList(defaultDirGlob), nil); err == nil || !strings.Contains(err.Error(), "myproject/app") {
+			t.Errorf("expected collision error, got %v", err)
+		}
+	})
+}
+
+func TestPrintDirSummary(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+	tmpDir := t.TempDir()
+
+	os.WriteFile(filepath.Join(tmpDir, "app-secrets.enc.yaml"), []byte("db:\n  password: p\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "bad.sops.yaml"), []byte("- not a mapping\n"), 0644)
+
+	entries, err := dirEntries(tmpDir, "myproject", splitList(defaultDirGlob), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", ExistsStrategy: strategyOverwrite}
+	errs := processEntries(context.Background(), entries, cfg, 2)
+
+	var buf strings.Builder
+	printDirSummary(&buf, cfg.Mount, entries, errs)
+	for _, want := range []string{
+		"OK     " + entries[0].SopsFile + " -> secret/myproject/app\n",
+		"FAILED " + entries[1].SopsFile + ": parsing YAML",
+		"Processed 2 files (1 failed)\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("summary missing %q:\n%s", want, buf.String())
+		}
+	}
+	if got := mv.stored("secret/data/myproject/app/db.password")["value"]; got != "p" {
+		t.Errorf("stored value = %v, expected p", got)
+	}
+}
+
+func TestBatchExitCode(t *testing.T) {
+	missing := fmt.Errorf("a.yaml: decrypting SOPS file: %w", errMissingSopsKey)
+	failed := errors.New("b.yaml: parsing YAML")
+	tests := []struct {
+		name   string
+		errs   []error
+		ignore bool
+		want   int
+	}{
+		{"no errors", []error{nil, nil}, false, 0},
+		{"failure", []error{nil, failed}, false, 1},
+		{"missing key", []error{missing}, false, 1},
+		{"missing key ignored", []error{nil, missing}, true, 2},
+		{"missing key and failure", []error{missing, failed}, true, 1},
+	}
+	for _, tt := range tests {
+		if got := batchExitCode(tt.errs, tt.ignore); got != tt.want {
+			t.Errorf("%s: batchExitCode = %d, expected %d", tt.name, got, tt.want)
+		}
+	}
+}
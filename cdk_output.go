@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// cdkDefaultContextKey is the cdk.context.json key secrets are written under.
+const cdkDefaultContextKey = "secrets"
+
+// updateCDKContext merges data into the object stored under contextKey in the
+// CDK context file at path, creating the file if needed. Other context keys,
+// and entries under contextKey that aren't in data, are kept verbatim.
+func updateCDKContext(path, contextKey string, data map[string]interface{}) error {
+	context := make(map[string]json.RawMessage)
+	content, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(content, &context); err != nil {
+			return fmt.Errorf("parsing CDK context: %w", err)
+		}
+		if context == nil {
+			context = make(map[string]json.RawMessage)
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("reading CDK context: %w", err)
+	}
+
+	secrets := make(map[string]json.RawMessage)
+	if existing, ok := context[contextKey]; ok {
+		if err := json.Unmarshal(existing, &secrets); err != nil {
+			return fmt.Errorf("CDK context key %q is not an object: %w", contextKey, err)
+		}
+		if secrets == nil {
+			secrets = make(map[string]json.RawMessage)
+		}
+	}
+
+	for k, v := range data {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("marshaling %s: %w", k, err)
+		}
+		secrets[k] = raw
+	}
+
+	merged, err := json.Marshal(secrets)
+	if err != nil {
+		return fmt.Errorf("marshaling secrets: %w", err)
+	}
+	context[contextKey] = merged
+
+	out, err := json.MarshalIndent(context, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling CDK context: %w", err)
+	}
+	if err := os.WriteFile(path, append(out, '\n'), 0600); err != nil {
+		return fmt.Errorf("writing CDK context: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUpdateCDKContext(t *testing.T) {
+	t.Run("creates file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cdk.context.json")
+		if err := updateCDKContext(path, "secrets", map[string]interface{}{"db.password": "hunter2", "db.port": 5432}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var got map[string]interface{}
+		content, _ := os.ReadFile(path)
+		if err := json.Unmarshal(content, &got); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		expected := map[string]interface{}{
+			"secrets": map[string]interface{}{"db.password": "hunter2", "db.port": float64(5432)},
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("got %v, expected %v", got, expected)
+		}
+	})
+
+	t.Run("merges with existing context", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cdk.context.json")
+		existing := `{
+  "availability-zones:account=123456789012:region=us-east-1": ["us-east-1a", "us-east-1b"],
+  "secrets": {"api.key": "old", "legacy.token": "keep"}
+}`
+		os.WriteFile(path, []byte(existing), 0644)
+
+		if err := updateCDKContext(path, "secrets", map[string]interface{}{"api.key": "new", "db.password": "p"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var got map[string]interface{}
+		content, _ := os.ReadFile(path)
+		json.Unmarshal(content, &got)
+		expected := map[string]interface{}{
+			"availability-zones:account=123456789012:region=us-east-1": []interface{}{"us-east-1a", "us-east-1b"},
+			"secrets": map[string]interface{}{"api.key": "new", "legacy.token": "keep", "db.password": "p"},
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("got %v, expected %v", got, expected)
+		}
+	})
+
+	t.Run("context key is not an object", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cdk.context.json")
+		os.WriteFile(path, []byte(`{"secrets": "nope"}`), 0644)
+		if err := updateCDKContext(path, "secrets", map[string]interface{}{"a": "b"}); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
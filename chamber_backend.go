@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// chamberDefaultKMSKeyAlias is the KMS key chamber encrypts parameters with
+// unless told otherwise.
+const chamberDefaultKMSKeyAlias = "parameter_store_key"
+
+// ssmAPI is the part of the SSM client ChamberBackend uses.
+type ssmAPI interface {
+	PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error)
+}
+
+// ChamberBackend writes secrets to AWS SSM Parameter Store using the path
+// layout of the chamber tool: /<service>/<key>.
+type ChamberBackend struct {
+	client      ssmAPI
+	service     string
+	kmsKeyAlias string
+}
+
+// NewChamberBackend creates a chamber-style SSM backend using the standard
+// AWS credential chain (AWS_REGION, AWS_PROFILE, etc.). If service is empty,
+// the <vault-path> argument is used as the service name.
+func NewChamberBackend(ctx context.Context, service, kmsKeyAlias string) (*ChamberBackend, error) {
+	awsCfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS config: %w", err)
+	}
+	if kmsKeyAlias == "" {
+		kmsKeyAlias = chamberDefaultKMSKeyAlias
+	}
+	return &ChamberBackend{
+		client:      ssm.NewFromConfig(awsCfg),
+		service:     service,
+		kmsKeyAlias: kmsKeyAlias,
+	}, nil
+}
+
+// chamberParameterName maps a flattened key to a chamber SSM parameter name.
+// Chamber lowercases services and keys, and nesting dots become slashes.
+// For example: ("MyApp", "db.Password") -> "/myapp/db/password"
+func chamberParameterName(service, key string) string {
+	service = strings.Trim(strings.ToLower(service), "/")
+	key = strings.ReplaceAll(strings.ToLower(key), ".", "/")
+	return "/" + service + "/" + key
+}
+
+func (c *ChamberBackend) serviceFor(basePath string) string {
+	if c.service != "" {
+		return c.service
+	}
+	return basePath
+}
+
+// Location returns the SSM parameter name for key.
+func (c *ChamberBackend) Location(basePath, key string) string {
+	return chamberParameterName(c.serviceFor(basePath), key)
+}
+
+// WriteSecrets stores each key as a SecureString parameter, overwriting any
+// existing value.
+func (c *ChamberBackend) WriteSecrets(ctx context.Context, basePath string, keys []string, data map[string]interface{}) (int, error) {
+	keyID := c.kmsKeyAlias
+	if !strings.HasPrefix(keyID, "alias/") {
+		keyID = "alias/" + keyID
+	}
+
+	written := 0
+	for _, key := range keys {
+		name := c.Location(basePath, key)
+		_, err := c.client.PutParameter(ctx, &ssm.PutParameterInput{
+			Name:      aws.String(name),
+			Value:     aws.String(formatValue(data[key])),
+			Type:      types.ParameterTypeSecureString,
+			KeyId:     aws.String(keyID),
+			Overwrite: aws.Bool(true),
+		})
+		if err != nil {
+			return written, fmt.Errorf("failed to write SSM parameter %s: %w", name, err)
+		}
+		written++
+	}
+	return written, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// fakeSSM records PutParameter calls.
+type fakeSSM struct {
+	puts []*ssm.PutParameterInput
+	err  error
+}
+
+func (f *fakeSSM) PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.puts = append(f.puts, params)
+	return &ssm.PutParameterOutput{}, nil
+}
+
+func TestChamberParameterName(t *testing.T) {
+	tests := []struct {
+		service  string
+		key      string
+		expected string
+	}{
+		{"myapp", "db.password", "/myapp/db/password"},
+		{"myapp", "token", "/myapp/token"},
+		{"MyApp", "admin.oauth2.clientID", "/myapp/admin/oauth2/clientid"},
+		{"/team/myapp/", "api.key", "/team/myapp/api/key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			result := chamberParameterName(tt.service, tt.key)
+			if result != tt.expected {
+				t.Errorf("chamberParameterName(%q, %q) = %q, expected %q", tt.service, tt.key, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestChamberBackendWriteSecrets(t *testing.T) {
+	fake := &fakeSSM{}
+	backend := &ChamberBackend{client: fake, kmsKeyAlias: "custom_key"}
+
+	data := map[string]interface{}{"db.password": "s3cr3t", "db.port": 5432}
+	written, err := backend.WriteSecrets(context.Background(), "myapp", []string{"db.password", "db.port"}, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if written != 2 || len(fake.puts) != 2 {
+		t.Fatalf("expected 2 writes, got %d", len(fake.puts))
+	}
+
+	put := fake.puts[0]
+	if aws.ToString(put.Name) != "/myapp/db/password" || aws.ToString(put.Value) != "s3cr3t" {
+		t.Errorf("unexpected parameter %s = %s", aws.ToString(put.Name), aws.ToString(put.Value))
+	}
+	if put.Type != types.ParameterTypeSecureString {
+		t.Errorf("type = %s, expected SecureString", put.Type)
+	}
+	if aws.ToString(put.KeyId) != "alias/custom_key" {
+		t.Errorf("key id = %s, expected alias/custom_key", aws.ToString(put.KeyId))
+	}
+	if !aws.ToBool(put.Overwrite) {
+		t.Error("expected Overwrite=true")
+	}
+	if aws.ToString(fake.puts[1].Value) != "5432" {
+		t.Errorf("non-string value = %s, expected 5432", aws.ToString(fake.puts[1].Value))
+	}
+
+	t.Run("service flag overrides vault path", func(t *testing.T) {
+		backend := &ChamberBackend{client: &fakeSSM{}, service: "billing"}
+		if loc := backend.Location("ignored/path", "api.key"); loc != "/billing/api/key" {
+			t.Errorf("Location() = %q, expected /billing/api/key", loc)
+		}
+	})
+
+	t.Run("stops on error", func(t *testing.T) {
+		backend := &ChamberBackend{client: &fakeSSM{err: errors.New("access denied")}}
+		if _, err := backend.WriteSecrets(context.Background(), "myapp", []string{"db.password"}, data); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// completionCommand is the command the completion scripts complete.
+const completionCommand = "sops-to-vault"
+
+// completionFlag describes a flag for the completion scripts.
+type completionFlag struct {
+	name  string
+	usage string
+	// takesValue is false for boolean flags, which don't consume the next
+	// argument.
+	takesValue bool
+}
+
+// completionFlags lists the flags in flags, sorted by name, with the first
+// line of each usage string.
+func completionFlags(flags *flag.FlagSet) []completionFlag {
+	var result []completionFlag
+	flags.VisitAll(func(f *flag.Flag) {
+		usage, _, _ := strings.Cut(f.Usage, "\n")
+		boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+		result = append(result, completionFlag{
+			name:       f.Name,
+			usage:      usage,
+			takesValue: !ok || !boolFlag.IsBoolFlag(),
+		})
+	})
+	return result
+}
+
+// writeCompletion writes the completion script for shell (bash, zsh, or
+// fish) for the flags in flags. Flag names are completed with their
+// descriptions where the shell shows them, and the sops-file argument with
+// YAML and JSON files.
+func writeCompletion(w io.Writer, shell string, flags *flag.FlagSet) error {
+	switch shell {
+	case "bash":
+		return writeBashCompletion(w, completionFlags(flags))
+	case "zsh":
+		return writeZshCompletion(w, completionFlags(flags))
+	case "fish":
+		return writeFishCompletion(w, completionFlags(flags))
+	default:
+		return fmt.Errorf("unsupported shell %q (expected bash, zsh, or fish)", shell)
+	}
+}
+
+func writeBashCompletion(w io.Writer, flags []completionFlag) error {
+	var names, valueFlags []string
+	for _, f := range flags {
+		names = append(names, "--"+f.name)
+		if f.takesValue {
+			valueFlags = append(valueFlags, f.name)
+		}
+	}
+	_, err := fmt.Fprintf(w, `# bash completion for %[1]s
+_sops_to_vault() {
+    local cur prev
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+    # A flag's value (-flag or --flag): complete any file
+    prev="${prev#-}"
+    case "${prev#-}" in
+        %[2]s)
+            COMPREPLY=( $(compgen -f -- "$cur") )
+            return
+            ;;
+    esac
+
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=( $(compgen -W "%[3]s" -- "$cur") )
+        return
+    fi
+
+    # The sops-file argument: directories and YAML or JSON files
+    local ext
+    COMPREPLY=( $(compgen -d -- "$cur") )
+    for ext in yaml yml json; do
+        COMPREPLY+=( $(compgen -f -X "!*.$ext" -- "$cur") )
+    done
+}
+complete -o filenames -F _sops_to_vault %[1]s
+`, completionCommand, strings.Join(valueFlags, "|"), strings.Join(names, " "))
+	return err
+}
+
+func writeZshCompletion(w io.Writer, flags []completionFlag) error {
+	if _, err := fmt.Fprintf(w, "#compdef %s\n\n_arguments \\\n", completionCommand); err != nil {
+		return err
+	}
+	// Brackets and colons end an _arguments description
+	escape := strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`, "'", `'\''`)
+	for _, f := range flags {
+		spec := "--" + f.name + "[" + escape.Replace(f.usage) + "]"
+		if f.takesValue {
+			spec = "--" + f.name + "=[" + escape.Replace(f.usage) + "]:value:_files"
+		}
+		if _, err := fmt.Fprintf(w, "  '%s' \\\n", spec); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, `  '*:sops file:_files -g "*.(yaml|yml|json)"'`)
+	return err
+}
+
+func writeFishCompletion(w io.Writer, flags []completionFlag) error {
+	escape := strings.NewReplacer(`\`, `\\`, "'", `\'`)
+	for _, f := range flags {
+		required := ""
+		if f.takesValue {
+			required = " -r"
+		}
+		if _, err := fmt.Fprintf(w, "complete -c %s -l %s%s -d '%s'\n", completionCommand, f.name, required, escape.Replace(f.usage)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "complete -c %s -k -a '(__fish_complete_suffix .yaml; __fish_complete_suffix .yml; __fish_complete_suffix .json)'\n", completionCommand)
+	return err
+}
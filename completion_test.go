@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteCompletion(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.String("vault-addr", "", "Vault server address")
+	flags.Bool("dry-run", false, "Print secrets without writing to Vault")
+	flags.String("batch-file", "", "File listing '<sops-file> <vault-path>' pairs [one per line]: see README")
+
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		t.Run(shell, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeCompletion(&buf, shell, flags); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			script := buf.String()
+			for _, name := range []string{"vault-addr", "dry-run", "batch-file"} {
+				if !strings.Contains(script, name) {
+					t.Errorf("script doesn't complete --%s:\n%s", name, script)
+				}
+			}
+
+			// Check the script parses, where the shell is installed
+			bin, err := exec.LookPath(shell)
+			if err != nil {
+				t.Skipf("%s not installed", shell)
+			}
+			file := filepath.Join(t.TempDir(), "completion."+shell)
+			os.WriteFile(file, buf.Bytes(), 0644)
+			if out, err := exec.Command(bin, "-n", file).CombinedOutput(); err != nil {
+				t.Errorf("%s -n: %v\n%s\n%s", shell, err, out, script)
+			}
+		})
+	}
+
+	t.Run("bash value flags", func(t *testing.T) {
+		var buf bytes.Buffer
+		writeCompletion(&buf, "bash", flags)
+		if !strings.Contains(buf.String(), `case "${prev#-}" in
+        batch-file|vault-addr)`) {
+			t.Errorf("expected only value flags in the case pattern:\n%s", buf.String())
+		}
+	})
+
+	t.Run("unsupported shell", func(t *testing.T) {
+		if err := writeCompletion(&bytes.Buffer{}, "tcsh", flags); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestBashCompletionCompletes(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not installed")
+	}
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.String("vault-addr", "", "")
+	flags.Bool("dry-run", false, "")
+	var buf bytes.Buffer
+	if err := writeCompletion(&buf, "bash", flags); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"app.yaml", "app.json", "notes.txt"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	complete := func(words ...string) string {
+		script := buf.String() + `
+COMP_WORDS=(` + strings.Join(words, " ") + `)
+COMP_CWORD=$((${#COMP_WORDS[@]} - 1))
+_sops_to_vault
+printf '%s\n' "${COMPREPLY[@]}" | sort | tr '\n' ' '
+`
+		cmd := exec.Command(bash, "-c", script)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("bash: %v\n%s", err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	if got := complete("sops-to-vault", "--d"); got != "--dry-run" {
+		t.Errorf("flag completion = %q, expected --dry-run", got)
+	}
+	if got := complete("sops-to-vault", "--dry-run", "a"); got != "app.json app.yaml" {
+		t.Errorf("file completion = %q, expected app.json app.yaml", got)
+	}
+	if got := complete("sops-to-vault", "-vault-addr", "n"); got != "notes.txt" {
+		t.Errorf("flag value completion = %q, expected notes.txt", got)
+	}
+}
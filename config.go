@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// defaultConfigFile is read from the home directory when --config isn't given.
+const defaultConfigFile = ".sops-to-vault.toml"
+
+// defaultConfigPath returns ~/.sops-to-vault.toml, or "" if there is no home
+// directory.
+func defaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, defaultConfigFile)
+}
+
+// applyConfigFile sets flags from the TOML file at path, whose keys
+// are flag names with underscores in place of dashes (vault_addr for
+// --vault-addr). Flags already set on the command line are left alone, so
+// they override the file. An array sets a repeatable flag once per element.
+// A missing file is only an error if required.
+func applyConfigFile(flags *flag.FlagSet, path string, required bool) error {
+	var values map[string]interface{}
+	if _, err := toml.DecodeFile(path, &values); err != nil {
+		if !required && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := strings.ReplaceAll(key, "_", "-")
+		if name == "config" || flags.Lookup(name) == nil {
+			return fmt.Errorf("config file %s: unknown setting %q", path, key)
+		}
+		if set[name] {
+			continue
+		}
+		elems, ok := values[key].([]interface{})
+		if !ok {
+			elems = []interface{}{values[key]}
+		}
+		for _, v := range elems {
+			if _, ok := v.(map[string]interface{}); ok {
+				return fmt.Errorf("config file %s: %s must be a value, not a table", path, key)
+			}
+			if err := flags.Set(name, fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("config file %s: %s: %w", path, key, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyConfigFile(t *testing.T) {
+	newFlags := func() (*flag.FlagSet, *Config, *[]string) {
+		var cfg Config
+		var excludes []string
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.StringVar(&cfg.VaultAddr, "vault-addr", "", "")
+		fs.StringVar(&cfg.Mount, "mount", "secret", "")
+		fs.IntVar(&cfg.Parallelism, "parallelism", 1, "")
+		fs.BoolVar(&cfg.DryRun, "dry-run", false, "")
+		fs.DurationVar(&cfg.MinTokenTTL, "min-token-ttl", 0, "")
+		fs.Func("key-exclude", "", func(v string) error {
+			excludes = append(excludes, v)
+			return nil
+		})
+		return fs, &cfg, &excludes
+	}
+	configFile := filepath.Join(t.TempDir(), "config.toml")
+	os.WriteFile(configFile, []byte(`vault_addr = "https://vault.example.com"
+mount = "kv"
+parallelism = 4
+dry_run = true
+min_token_ttl = "10m"
+key_exclude = ["a.*", "b.*"]
+`), 0644)
+
+	t.Run("fills unset flags", func(t *testing.T) {
+		fs, cfg, excludes := newFlags()
+		fs.Parse(nil)
+		if err := applyConfigFile(fs, configFile, true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cfg.VaultAddr != "https://vault.example.com" || cfg.Mount != "kv" || cfg.Parallelism != 4 || !cfg.DryRun || cfg.MinTokenTTL != 10*time.Minute {
+			t.Errorf("unexpected config: %+v", cfg)
+		}
+		if !reflect.DeepEqual(*excludes, []string{"a.*", "b.*"}) {
+			t.Errorf("key-exclude = %v, expected [a.* b.*]", *excludes)
+		}
+	})
+
+	t.Run("command line wins", func(t *testing.T) {
+		fs, cfg, _ := newFlags()
+		fs.Parse([]string{"--mount", "other", "--parallelism=2"})
+		if err := applyConfigFile(fs, configFile, true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cfg.Mount != "other" || cfg.Parallelism != 2 || cfg.VaultAddr != "https://vault.example.com" {
+			t.Errorf("unexpected config: %+v", cfg)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		fs, _, _ := newFlags()
+		missing := filepath.Join(t.TempDir(), "missing.toml")
+		if err := applyConfigFile(fs, missing, false); err != nil {
+			t.Errorf("unexpected error for optional file: %v", err)
+		}
+		if err := applyConfigFile(fs, missing, true); err == nil {
+			t.Error("expected error for required file")
+		}
+	})
+
+	t.Run("unknown setting", func(t *testing.T) {
+		fs, _, _ := newFlags()
+		bad := filepath.Join(t.TempDir(), "bad.toml")
+		os.WriteFile(bad, []byte("vault_adr = \"x\"\n"), 0644)
+		if err := applyConfigFile(fs, bad, true); err == nil || !strings.Contains(err.Error(), "vault_adr") {
+			t.Errorf("expected unknown setting error, got %v", err)
+		}
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		fs, _, _ := newFlags()
+		bad := filepath.Join(t.TempDir(), "bad.toml")
+		os.WriteFile(bad, []byte("parallelism = \"many\"\n"), 0644)
+		if err := applyConfigFile(fs, bad, true); err == nil {
+			t.Error("expected error for invalid value")
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+// consulKVAPI is the part of the Consul KV client ConsulBackend uses.
+type consulKVAPI interface {
+	Put(p *consul.KVPair, q *consul.WriteOptions) (*consul.WriteMeta, error)
+}
+
+// ConsulBackend writes each secret to Consul KV under <vault-path>/<key>.
+type ConsulBackend struct {
+	kv consulKVAPI
+}
+
+// NewConsulBackend creates a Consul KV backend for the agent at addr,
+// authenticating with token. Either may be empty to use CONSUL_HTTP_ADDR and
+// CONSUL_HTTP_TOKEN (or the local agent).
+func NewConsulBackend(addr, token string) (*ConsulBackend, error) {
+	config := consul.DefaultConfig()
+	if addr != "" {
+		config.Address = addr
+	}
+	if token != "" {
+		config.Token = token
+	}
+	client, err := consul.NewClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating Consul client: %w", err)
+	}
+	return &ConsulBackend{kv: client.KV()}, nil
+}
+
+// Location returns the Consul key for key. Consul keys don't start with a
+// slash.
+func (c *ConsulBackend) Location(basePath, key string) string {
+	return strings.TrimPrefix(basePath+"/"+key, "/")
+}
+
+// WriteSecrets puts each key's value, replacing any existing value.
+func (c *ConsulBackend) WriteSecrets(ctx context.Context, basePath string, keys []string, data map[string]interface{}) (int, error) {
+	written := 0
+	opts := (&consul.WriteOptions{}).WithContext(ctx)
+	for _, key := range keys {
+		name := c.Location(basePath, key)
+		pair := &consul.KVPair{Key: name, Value: []byte(formatValue(data[key]))}
+		if _, err := c.kv.Put(pair, opts); err != nil {
+			return written, fmt.Errorf("failed to write Consul key %s: %w", name, err)
+		}
+		written++
+	}
+	return written, nil
+}
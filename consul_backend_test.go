@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+// fakeConsulKV stores the pairs put, failing for keys in fail.
+type fakeConsulKV struct {
+	pairs map[string]string
+	fail  map[string]bool
+}
+
+func (f *fakeConsulKV) Put(p *consul.KVPair, q *consul.WriteOptions) (*consul.WriteMeta, error) {
+	if f.fail[p.Key] {
+		return nil, errors.New("Permission denied")
+	}
+	f.pairs[p.Key] = string(p.Value)
+	return &consul.WriteMeta{}, nil
+}
+
+func TestConsulBackendWriteSecrets(t *testing.T) {
+	fake := &fakeConsulKV{pairs: make(map[string]string)}
+	backend := &ConsulBackend{kv: fake}
+
+	data := map[string]interface{}{"db.password": "s3cr3t", "db.port": 5432}
+	written, err := backend.WriteSecrets(context.Background(), "myproject/app", []string{"db.password", "db.port"}, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if written != 2 {
+		t.Errorf("written = %d, expected 2", written)
+	}
+	expected := map[string]string{"myproject/app/db.password": "s3cr3t", "myproject/app/db.port": "5432"}
+	if !reflect.DeepEqual(fake.pairs, expected) {
+		t.Errorf("pairs = %v, expected %v", fake.pairs, expected)
+	}
+
+	t.Run("error", func(t *testing.T) {
+		fake := &fakeConsulKV{pairs: make(map[string]string), fail: map[string]bool{"app/b": true}}
+		backend := &ConsulBackend{kv: fake}
+		written, err := backend.WriteSecrets(context.Background(), "app", []string{"a", "b", "c"}, map[string]interface{}{"a": "1", "b": "2", "c": "3"})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if written != 1 {
+			t.Errorf("written = %d, expected 1", written)
+		}
+	})
+}
+
+func TestConsulBackendLocation(t *testing.T) {
+	backend := &ConsulBackend{}
+	if got := backend.Location("/myproject", "db.password"); got != "myproject/db.password" {
+		t.Errorf("Location = %q, expected myproject/db.password", got)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// updateDotenvCounterpart updates a dotenv counterpart file with vault
+// references, one NAME=ref+vault://... line per key, named by envVarName.
+// Returns (updated bool, error).
+func updateDotenvCounterpart(path, vaultPath string, sopsKeys []string) (bool, error) {
+	return updateDotenvCounterpartRefs(path, sopsKeys, func(key string) string {
+		return vaultRef(vaultPath + "/" + key)
+	}, defaultSeparator)
+}
+
+// updateDotenvCounterpartRefs is updateDotenvCounterpart with the reference
+// for each key supplied by refFor. Existing lines for a key are updated in
+// place, keeping any "export " prefix; missing keys are appended at the end.
+// Comments, blank lines, and other variables are left as they are. sep is
+// accepted to match the other counterpart updaters: dotenv keys are flat.
+func updateDotenvCounterpartRefs(path string, sopsKeys []string, refFor func(key string) string, sep string) (bool, error) {
+	// Check if file exists
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil // File doesn't exist, skip silently
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("reading file: %w", err)
+	}
+
+	refs := make(map[string]string, len(sopsKeys))
+	for _, key := range sopsKeys {
+		refs[envVarName(key)] = refFor(key)
+	}
+
+	text := strings.TrimSuffix(string(content), "\n")
+	var lines []string
+	if text != "" {
+		lines = strings.Split(text, "\n")
+	}
+
+	seen := make(map[string]bool)
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		prefix := ""
+		if strings.HasPrefix(trimmed, "export ") {
+			prefix = "export "
+			trimmed = strings.TrimSpace(strings.TrimPrefix(trimmed, "export "))
+		}
+		name, _, ok := strings.Cut(trimmed, "=")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if ref, ok := refs[name]; ok {
+			lines[i] = prefix + name + "=" + ref
+			seen[name] = true
+		}
+	}
+
+	for _, key := range sopsKeys {
+		if name := envVarName(key); !seen[name] {
+			lines = append(lines, name+"="+refs[name])
+			seen[name] = true
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return false, fmt.Errorf("writing file: %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateDotenvCounterpart(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	t.Run("updates existing keys and appends missing ones", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "app.env")
+		initial := "# database\nDB_PASSWORD=placeholder\n\nexport API_KEY = \"old\"\nLOG_LEVEL=debug\n"
+		os.WriteFile(path, []byte(initial), 0644)
+
+		updated, err := updateDotenvCounterpart(path, "secret/myapp", []string{"db.password", "api_key", "db.url"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !updated {
+			t.Fatal("expected updated=true")
+		}
+
+		fileContent, _ := os.ReadFile(path)
+		expected := "# database\n" +
+			"DB_PASSWORD=ref+vault://secret/myapp/db.password#value\n" +
+			"\n" +
+			"export API_KEY=ref+vault://secret/myapp/api_key#value\n" +
+			"LOG_LEVEL=debug\n" +
+			"DB_URL=ref+vault://secret/myapp/db.url#value\n"
+		if string(fileContent) != expected {
+			t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", string(fileContent), expected)
+		}
+	})
+
+	t.Run("empty file", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "empty.env")
+		os.WriteFile(path, nil, 0644)
+
+		if _, err := updateDotenvCounterpart(path, "secret/myapp", []string{"token"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		fileContent, _ := os.ReadFile(path)
+		if expected := "TOKEN=ref+vault://secret/myapp/token#value\n"; string(fileContent) != expected {
+			t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", string(fileContent), expected)
+		}
+	})
+
+	t.Run("skips non-existent file", func(t *testing.T) {
+		updated, err := updateDotenvCounterpart(filepath.Join(tmpDir, "nonexistent.env"), "secret/test", []string{"key"})
+		if err != nil || updated {
+			t.Errorf("expected (false, nil), got (%v, %v)", updated, err)
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// updateJSONCounterpart updates a JSON counterpart file with vault references,
+// following the same nesting rules as updateCounterpartFile. Object keys keep
+// their order. Returns (updated bool, error).
+func updateJSONCounterpart(path, vaultPath string, sopsKeys []string) (bool, error) {
+	return updateJSONCounterpartRefs(path, sopsKeys, func(key string) string {
+		return vaultRef(vaultPath + "/" + key)
+	}, defaultSeparator)
+}
+
+// updateJSONCounterpartRefs is updateJSONCounterpart with the reference for
+// each key supplied by refFor and the key segments separated by sep. JSON is
+// valid YAML, so the file is parsed into a yaml.Node, which keeps key order,
+// and updated with upsertNestedKey like a YAML counterpart before being
+// written back as JSON with the file's indentation.
+func updateJSONCounterpartRefs(path string, sopsKeys []string, refFor func(key string) string, sep string) (bool, error) {
+	// Check if file exists
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil // File doesn't exist, skip silently
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("reading file: %w", err)
+	}
+	if !json.Valid(content) {
+		return false, fmt.Errorf("parsing JSON: %s is not valid JSON", path)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return false, fmt.Errorf("parsing JSON: %w", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return false, fmt.Errorf("expected JSON object at root")
+	}
+	root := doc.Content[0]
+
+	for _, key := range sopsKeys {
+		upsertNestedKey(root, strings.Split(key, sep), refFor(key), sep)
+	}
+
+	var compact bytes.Buffer
+	if err := writeJSONNode(&compact, root); err != nil {
+		return false, fmt.Errorf("marshaling JSON: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, compact.Bytes(), "", detectJSONIndent(content)); err != nil {
+		return false, fmt.Errorf("marshaling JSON: %w", err)
+	}
+	buf.WriteByte('\n')
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return false, fmt.Errorf("writing file: %w", err)
+	}
+
+	return true, nil
+}
+
+// writeJSONNode writes a node parsed from JSON, or added by upsertNestedKey,
+// to b as compact JSON. Scalars keep their original text unless they are
+// strings, including the untagged ones upsertNestedKey adds.
+func writeJSONNode(b *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		b.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeJSONString(b, node.Content[i].Value); err != nil {
+				return err
+			}
+			b.WriteByte(':')
+			if err := writeJSONNode(b, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	case yaml.SequenceNode:
+		b.WriteByte('[')
+		for i, elem := range node.Content {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeJSONNode(b, elem); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	case yaml.ScalarNode:
+		if node.Tag == "" || node.Tag == "!!str" {
+			return writeJSONString(b, node.Value)
+		}
+		b.WriteString(node.Value)
+	default:
+		return fmt.Errorf("unexpected node kind %v", node.Kind)
+	}
+	return nil
+}
+
+// writeJSONString writes s to b as a JSON string, leaving <, >, and &
+// unescaped.
+func writeJSONString(b *bytes.Buffer, s string) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(s); err != nil {
+		return err
+	}
+	b.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	return nil
+}
+
+// detectJSONIndent returns the indentation of the first indented line of
+// content, or two spaces if there is none.
+func detectJSONIndent(content []byte) string {
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && len(trimmed) < len(line) {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return "  "
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateJSONCounterpart(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	t.Run("keeps key order and other values", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "nested.json")
+		os.WriteFile(path, []byte(`{
+    "name": "app <prod>",
+    "admin": {
+        "oauth2": {
+            "clientID": "placeholder"
+        },
+        "port": 8080,
+        "debug": false,
+        "hosts": ["a", "b"],
+        "extra": null
+    }
+}
+`), 0644)
+
+		updated, err := updateJSONCounterpart(path, "secret/myapp", []string{"admin.oauth2.clientID", "token"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !updated {
+			t.Fatal("expected updated=true")
+		}
+
+		fileContent, _ := os.ReadFile(path)
+		expected := `{
+    "name": "app <prod>",
+    "admin": {
+        "oauth2": {
+            "clientID": "ref+vault://secret/myapp/admin.oauth2.clientID#value"
+        },
+        "port": 8080,
+        "debug": false,
+        "hosts": [
+            "a",
+            "b"
+        ],
+        "extra": null
+    },
+    "token": "ref+vault://secret/myapp/token#value"
+}
+`
+		if string(fileContent) != expected {
+			t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", string(fileContent), expected)
+		}
+	})
+
+	t.Run("flat keys", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "flat.json")
+		os.WriteFile(path, []byte(`{"db.password": "placeholder"}`), 0644)
+
+		if _, err := updateJSONCounterpart(path, "secret/myapp", []string{"db.password", "db.user"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		fileContent, _ := os.ReadFile(path)
+		expected := "{\n  \"db.password\": \"ref+vault://secret/myapp/db.password#value\",\n  \"db.user\": \"ref+vault://secret/myapp/db.user#value\"\n}\n"
+		if string(fileContent) != expected {
+			t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", string(fileContent), expected)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		updated, err := updateJSONCounterpart(filepath.Join(tmpDir, "missing.json"), "secret/myapp", []string{"key"})
+		if err != nil || updated {
+			t.Errorf("expected (false, nil), got (%v, %v)", updated, err)
+		}
+	})
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "invalid.json")
+		os.WriteFile(path, []byte("key: value\n"), 0644)
+		if _, err := updateJSONCounterpart(path, "secret/myapp", []string{"key"}); err == nil {
+			t.Error("expected error for non-JSON content")
+		}
+	})
+}
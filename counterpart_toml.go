@@ -0,0 +1,442 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+)
+
+// updateTOMLCounterpart updates a TOML counterpart file with vault references,
+// following the same nesting rules as updateCounterpartFile. Only the values
+// being set are rewritten and new keys are added as lines of their own, so
+// comments, key order, and formatting are preserved.
+// Returns (updated bool, error).
+func updateTOMLCounterpart(path, vaultPath string, sopsKeys []string) (bool, error) {
+	return updateTOMLCounterpartRefs(path, sopsKeys, func(key string) string {
+		return vaultRef(vaultPath + "/" + key)
+	}, defaultSeparator)
+}
+
+// updateTOMLCounterpartRefs is updateTOMLCounterpart with the reference for
+// each key supplied by refFor and the key segments separated by sep.
+func updateTOMLCounterpartRefs(path string, sopsKeys []string, refFor func(key string) string, sep string) (bool, error) {
+	// Check if file exists
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil // File doesn't exist, skip silently
+	}
+	if err != nil {
+		return false, fmt.Errorf("reading file: %w", err)
+	}
+
+	// The decoded document decides where each key goes; the text is then
+	// edited in place
+	var doc map[string]interface{}
+	if _, err := toml.Decode(string(content), &doc); err != nil {
+		return false, fmt.Errorf("parsing TOML: %w", err)
+	}
+	if doc == nil {
+		doc = make(map[string]interface{})
+	}
+
+	text := string(content)
+	for _, key := range sopsKeys {
+		ref := refFor(key)
+		keyPath := upsertMapKey(doc, strings.Split(key, sep), ref, sep)
+		if keyPath == nil {
+			continue
+		}
+		if text, err = setTOMLValue(text, keyPath, ref); err != nil {
+			return false, fmt.Errorf("updating %s: %w", key, err)
+		}
+	}
+
+	// Never write a file the edits have broken
+	var check map[string]interface{}
+	if _, err := toml.Decode(text, &check); err != nil {
+		return false, fmt.Errorf("updated TOML doesn't parse: %w", err)
+	}
+
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		return false, fmt.Errorf("writing file: %w", err)
+	}
+
+	return true, nil
+}
+
+// upsertMapKey is the map equivalent of upsertNestedKey: it updates an exact
+// flat key or the deepest matching nested key, otherwise adds the key flat if
+// the level already uses keys containing sep, or as nested tables if it
+// doesn't. It returns the full key path it set, or nil if a value that isn't
+// a table is in the way.
+func upsertMapKey(m map[string]interface{}, keyPath []string, value, sep string) []string {
+	if len(keyPath) == 0 {
+		return nil
+	}
+
+	flatKey := strings.Join(keyPath, sep)
+	if _, ok := m[flatKey]; ok {
+		m[flatKey] = value
+		return []string{flatKey}
+	}
+
+	if existing, ok := m[keyPath[0]]; ok {
+		if len(keyPath) == 1 {
+			m[keyPath[0]] = value
+			return []string{keyPath[0]}
+		}
+		if nested, ok := existing.(map[string]interface{}); ok {
+			if rest := upsertMapKey(nested, keyPath[1:], value, sep); rest != nil {
+				return append([]string{keyPath[0]}, rest...)
+			}
+		}
+		return nil
+	}
+
+	for k := range m {
+		if strings.Contains(k, sep) {
+			m[flatKey] = value
+			return []string{flatKey}
+		}
+	}
+
+	for _, segment := range keyPath[:len(keyPath)-1] {
+		nested := make(map[string]interface{})
+		m[segment] = nested
+		m = nested
+	}
+	m[keyPath[len(keyPath)-1]] = value
+	return append([]string(nil), keyPath...)
+}
+
+// tomlEntry is a key/value pair in a TOML document: its full key path and
+// the byte range of its value.
+type tomlEntry struct {
+	path       []string
+	start, end int
+}
+
+// tomlSection is the part of a TOML document belonging to the root table or
+// to one [table] or [[array]] header.
+type tomlSection struct {
+	path  []string
+	array bool
+	// insertAt is where a new key belongs in the section: after its last
+	// entry's line, or after the header line if it has none. indent is that
+	// entry's indentation.
+	insertAt int
+	indent   string
+}
+
+// setTOMLValue sets the value at keyPath in the TOML document text to the
+// string value. An existing value is replaced where it stands; otherwise the
+// key is added at the end of the section of the deepest [table] it's under,
+// as a dotted key relative to that table.
+func setTOMLValue(text string, keyPath []string, value string) (string, error) {
+	entries, sections, err := scanTOML(text)
+	if err != nil {
+		return "", err
+	}
+
+	for _, e := range entries {
+		if equalPath(e.path, keyPath) {
+			return text[:e.start] + tomlQuote(value) + text[e.end:], nil
+		}
+	}
+	for _, s := range sections {
+		if equalPath(s.path, keyPath) {
+			return "", fmt.Errorf("%s is a table", strings.Join(keyPath, "."))
+		}
+	}
+
+	section := sections[0]
+	for _, s := range sections[1:] {
+		if !s.array && len(s.path) > len(section.path) && len(s.path) < len(keyPath) && equalPath(s.path, keyPath[:len(s.path)]) {
+			section = s
+		}
+	}
+
+	newline := "\n"
+	if strings.Contains(text, "\r\n") {
+		newline = "\r\n"
+	}
+	line := section.indent + tomlKey(keyPath[len(section.path):]) + " = " + tomlQuote(value) + newline
+	at := section.insertAt
+	if at > 0 && !strings.HasSuffix(text[:at], "\n") {
+		line = newline + line
+	}
+	return text[:at] + line + text[at:], nil
+}
+
+func equalPath(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// scanTOML finds every key/value pair and table header in a TOML document.
+// The first section returned is the root table's.
+func scanTOML(text string) ([]tomlEntry, []tomlSection, error) {
+	var entries []tomlEntry
+	sections := []tomlSection{{}}
+	current := &sections[0]
+
+	pos := 0
+	for {
+		pos = skipTOMLSpace(text, pos, true)
+		if pos >= len(text) {
+			break
+		}
+		lineStart := strings.LastIndex(text[:pos], "\n") + 1
+
+		switch text[pos] {
+		case '#':
+			pos = endOfLine(text, pos)
+		case '[':
+			array := strings.HasPrefix(text[pos:], "[[")
+			close := "]"
+			pos++
+			if array {
+				close = "]]"
+				pos++
+			}
+			key, next, err := parseTOMLKey(text, pos)
+			if err != nil {
+				return nil, nil, err
+			}
+			next = skipTOMLSpace(text, next, false)
+			if !strings.HasPrefix(text[next:], close) {
+				return nil, nil, fmt.Errorf("malformed table header at byte %d", lineStart)
+			}
+			pos = endOfLine(text, next+len(close))
+			sections = append(sections, tomlSection{path: key, array: array, insertAt: pos})
+			current = &sections[len(sections)-1]
+		default:
+			key, next, err := parseTOMLKey(text, pos)
+			if err != nil {
+				return nil, nil, err
+			}
+			next = skipTOMLSpace(text, next, false)
+			if next >= len(text) || text[next] != '=' {
+				return nil, nil, fmt.Errorf("expected = after key at byte %d", pos)
+			}
+			start := skipTOMLSpace(text, next+1, false)
+			end, err := scanTOMLValue(text, start)
+			if err != nil {
+				return nil, nil, err
+			}
+			path := append(append([]string(nil), current.path...), key...)
+			entries = append(entries, tomlEntry{path: path, start: start, end: end})
+			pos = endOfLine(text, end)
+			current.insertAt = pos
+			line := text[lineStart:]
+			current.indent = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		}
+	}
+	return entries, sections, nil
+}
+
+// skipTOMLSpace skips spaces and tabs, and newlines too if newlines is set.
+func skipTOMLSpace(text string, pos int, newlines bool) int {
+	for pos < len(text) {
+		switch text[pos] {
+		case ' ', '\t':
+		case '\r', '\n':
+			if !newlines {
+				return pos
+			}
+		default:
+			return pos
+		}
+		pos++
+	}
+	return pos
+}
+
+// endOfLine returns the offset just past the newline ending the line pos is
+// on, or the end of text.
+func endOfLine(text string, pos int) int {
+	if i := strings.IndexByte(text[pos:], '\n'); i != -1 {
+		return pos + i + 1
+	}
+	return len(text)
+}
+
+// parseTOMLKey parses a (possibly dotted) key starting at pos and returns its
+// segments and the offset after it.
+func parseTOMLKey(text string, pos int) ([]string, int, error) {
+	var key []string
+	for {
+		pos = skipTOMLSpace(text, pos, false)
+		if pos >= len(text) {
+			return nil, pos, fmt.Errorf("expected a key at byte %d", pos)
+		}
+		switch text[pos] {
+		case '"', '\'':
+			end, err := scanTOMLValue(text, pos)
+			if err != nil {
+				return nil, pos, err
+			}
+			var segment map[string]string
+			if _, err := toml.Decode("k = "+text[pos:end], &segment); err != nil {
+				return nil, pos, fmt.Errorf("malformed key at byte %d: %w", pos, err)
+			}
+			key = append(key, segment["k"])
+			pos = end
+		default:
+			end := pos
+			for end < len(text) && isBareKeyChar(text[end]) {
+				end++
+			}
+			if end == pos {
+				return nil, pos, fmt.Errorf("expected a key at byte %d", pos)
+			}
+			key = append(key, text[pos:end])
+			pos = end
+		}
+		next := skipTOMLSpace(text, pos, false)
+		if next >= len(text) || text[next] != '.' {
+			return key, pos, nil
+		}
+		pos = next + 1
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// scanTOMLValue returns the offset just past the value starting at pos,
+// which may span several lines (multi-line strings, arrays).
+func scanTOMLValue(text string, pos int) (int, error) {
+	unterminated := fmt.Errorf("unterminated value at byte %d", pos)
+	switch {
+	case strings.HasPrefix(text[pos:], `"""`):
+		for i := pos + 3; i < len(text); i++ {
+			if text[i] == '\\' {
+				i++
+				continue
+			}
+			if strings.HasPrefix(text[i:], `"""`) {
+				// Up to two quotes may end the content itself
+				end := i + 3
+				for n := 0; n < 2 && end < len(text) && text[end] == '"'; n++ {
+					end++
+				}
+				return end, nil
+			}
+		}
+		return 0, unterminated
+	case strings.HasPrefix(text[pos:], "'''"):
+		i := strings.Index(text[pos+3:], "'''")
+		if i == -1 {
+			return 0, unterminated
+		}
+		end := pos + 3 + i + 3
+		for n := 0; n < 2 && end < len(text) && text[end] == '\''; n++ {
+			end++
+		}
+		return end, nil
+	case text[pos] == '"':
+		for i := pos + 1; i < len(text) && text[i] != '\n'; i++ {
+			switch text[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1, nil
+			}
+		}
+		return 0, unterminated
+	case text[pos] == '\'':
+		i := strings.IndexAny(text[pos+1:], "'\n")
+		if i == -1 || text[pos+1+i] != '\'' {
+			return 0, unterminated
+		}
+		return pos + 1 + i + 1, nil
+	case text[pos] == '[' || text[pos] == '{':
+		depth := 0
+		for i := pos; i < len(text); {
+			switch c := text[i]; {
+			case c == '[' || c == '{':
+				depth++
+				i++
+			case c == ']' || c == '}':
+				depth--
+				i++
+				if depth == 0 {
+					return i, nil
+				}
+			case c == '"' || c == '\'':
+				end, err := scanTOMLValue(text, i)
+				if err != nil {
+					return 0, err
+				}
+				i = end
+			case c == '#':
+				i = endOfLine(text, i)
+			default:
+				i++
+			}
+		}
+		return 0, unterminated
+	default:
+		// A number, boolean, or date, running to a comment or the end of
+		// the line (dates may contain a space)
+		end := pos
+		for end < len(text) && text[end] != '#' && text[end] != '\n' {
+			end++
+		}
+		return pos + len(strings.TrimRight(text[pos:end], " \t\r")), nil
+	}
+}
+
+var bareTOMLKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tomlKey formats a key path as a dotted key, quoting segments that aren't
+// valid bare keys.
+func tomlKey(path []string) string {
+	segments := make([]string, len(path))
+	for i, segment := range path {
+		if bareTOMLKey.MatchString(segment) {
+			segments[i] = segment
+		} else {
+			segments[i] = tomlQuote(segment)
+		}
+	}
+	return strings.Join(segments, ".")
+}
+
+// tomlQuote formats s as a TOML basic string.
+func tomlQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f || r == utf8.RuneError:
+			b.WriteString(`\u` + fmt.Sprintf("%04X", r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
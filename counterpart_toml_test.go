@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateTOMLCounterpart(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	t.Run("updates flat keys", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "flat.toml")
+		os.WriteFile(path, []byte("password = \"placeholder\"\nport = 5432\n"), 0644)
+
+		updated, err := updateTOMLCounterpart(path, "secret/myapp", []string{"password"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !updated {
+			t.Fatal("expected updated=true")
+		}
+
+		fileContent, _ := os.ReadFile(path)
+		expected := "password = \"ref+vault://secret/myapp/password#value\"\nport = 5432\n"
+		if string(fileContent) != expected {
+			t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", string(fileContent), expected)
+		}
+	})
+
+	t.Run("updates nested tables", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "nested.toml")
+		os.WriteFile(path, []byte("[admin.oauth2]\nclientID = \"placeholder\"\n"), 0644)
+
+		if _, err := updateTOMLCounterpart(path, "secret/myapp", []string{"admin.oauth2.clientID"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		fileContent, _ := os.ReadFile(path)
+		expected := "[admin.oauth2]\nclientID = \"ref+vault://secret/myapp/admin.oauth2.clientID#value\"\n"
+		if string(fileContent) != expected {
+			t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", string(fileContent), expected)
+		}
+	})
+
+	t.Run("adds missing keys as nested tables", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "missing.toml")
+		os.WriteFile(path, []byte("existing = \"value\"\n"), 0644)
+
+		if _, err := updateTOMLCounterpart(path, "secret/myapp", []string{"db.url"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		fileContent, _ := os.ReadFile(path)
+		expected := "existing = \"value\"\ndb.url = \"ref+vault://secret/myapp/db.url#value\"\n"
+		if string(fileContent) != expected {
+			t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", string(fileContent), expected)
+		}
+	})
+
+	t.Run("adds flat key when dotted keys exist at level", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "dotted.toml")
+		os.WriteFile(path, []byte("\"db.host\" = \"localhost\"\n"), 0644)
+
+		if _, err := updateTOMLCounterpart(path, "secret/myapp", []string{"db.url"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		fileContent, _ := os.ReadFile(path)
+		expected := "\"db.host\" = \"localhost\"\n\"db.url\" = \"ref+vault://secret/myapp/db.url#value\"\n"
+		if string(fileContent) != expected {
+			t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", string(fileContent), expected)
+		}
+	})
+
+	t.Run("preserves comments and key order", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "commented.toml")
+		os.WriteFile(path, []byte(`# App settings
+name = "myapp" # not a secret
+password = "placeholder" # set by sops-to-vault
+
+[server]
+port = 8080
+hosts = [
+  "a", # primary
+  "b",
+]
+
+# Database
+[db]
+  user = "app"
+  password = """
+placeholder"""
+`), 0644)
+
+		keys := []string{"password", "db.password", "db.url", "server.tls.key", "token"}
+		if _, err := updateTOMLCounterpart(path, "secret/myapp", keys); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		fileContent, _ := os.ReadFile(path)
+		expected := `# App settings
+name = "myapp" # not a secret
+password = "ref+vault://secret/myapp/password#value" # set by sops-to-vault
+token = "ref+vault://secret/myapp/token#value"
+
+[server]
+port = 8080
+hosts = [
+  "a", # primary
+  "b",
+]
+tls.key = "ref+vault://secret/myapp/server.tls.key#value"
+
+# Database
+[db]
+  user = "app"
+  password = "ref+vault://secret/myapp/db.password#value"
+  url = "ref+vault://secret/myapp/db.url#value"
+`
+		if string(fileContent) != expected {
+			t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", string(fileContent), expected)
+		}
+	})
+
+	t.Run("skips non-existent file", func(t *testing.T) {
+		updated, err := updateTOMLCounterpart(filepath.Join(tmpDir, "nonexistent.toml"), "secret/test", []string{"key"})
+		if err != nil || updated {
+			t.Fatalf("got (%v, %v), expected (false, nil)", updated, err)
+		}
+	})
+}
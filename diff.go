@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Statuses of a key in a --diff.
+const (
+	diffNew       = "new"
+	diffChanged   = "changed"
+	diffUnchanged = "unchanged"
+)
+
+// errDiffFound is returned by a --diff run that found differences, so the
+// process exits non-zero.
+var errDiffFound = errors.New("vault differs from the SOPS file")
+
+// diffEntry is one key's comparison between the SOPS file and Vault. The
+// values themselves are never kept, only their lengths.
+type diffEntry struct {
+	Key    string
+	Status string
+	// ExpectedLen is the length of the SOPS file's value, and ActualLen
+	// that of Vault's (0 for a new key).
+	ExpectedLen int
+	ActualLen   int
+}
+
+// diffSecrets compares each key's value in data with what Vault holds.
+// fieldFor returns the path (under the mount) and field a key is stored in;
+// each path is read only once.
+func diffSecrets(client VaultWriter, keys []string, data map[string]interface{}, fieldFor func(key string) (string, string)) ([]diffEntry, error) {
+	stored := make(map[string]map[string]interface{})
+	entries := make([]diffEntry, 0, len(keys))
+	for _, key := range keys {
+		p, field := fieldFor(key)
+		current, ok := stored[p]
+		if !ok {
+			var err error
+			if current, _, err = client.readKV(p); err != nil {
+				return nil, err
+			}
+			stored[p] = current
+		}
+
+		expected := formatValue(data[key])
+		entry := diffEntry{Key: key, Status: diffUnchanged, ExpectedLen: len(expected)}
+		value, exists := current[field]
+		actual := fmt.Sprint(value)
+		switch {
+		case !exists:
+			entry.Status = diffNew
+		case actual != expected:
+			entry.Status = diffChanged
+		}
+		if exists {
+			entry.ActualLen = len(actual)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// printDiff prints each key's location and status, never its value,
+// followed by the totals, and reports whether anything differs.
+func printDiff(w io.Writer, entries []diffEntry, locationFor func(key string) string) bool {
+	counts := make(map[string]int)
+	for _, e := range entries {
+		counts[e.Status]++
+		marker := " "
+		switch e.Status {
+		case diffNew:
+			marker = "+"
+		case diffChanged:
+			marker = "~"
+		}
+		fmt.Fprintf(w, "%s %s: <%s>\n", marker, locationFor(e.Key), e.Status)
+	}
+	fmt.Fprintf(w, "%d new, %d changed, %d unchanged\n", counts[diffNew], counts[diffChanged], counts[diffUnchanged])
+	return counts[diffNew]+counts[diffChanged] > 0
+}
+
+// printVerify prints each key whose Vault value doesn't match the SOPS file,
+// as expected vs. actual with both values masked to their lengths, followed
+// by the totals, and reports whether anything differs.
+func printVerify(w io.Writer, entries []diffEntry, locationFor func(key string) string) bool {
+	mismatched := 0
+	for _, e := range entries {
+		if e.Status == diffUnchanged {
+			continue
+		}
+		mismatched++
+		actual := "<missing>"
+		if e.Status == diffChanged {
+			actual = maskLength(e.ActualLen)
+		}
+		fmt.Fprintf(w, "MISMATCH %s: expected %s vs. actual %s\n", locationFor(e.Key), maskLength(e.ExpectedLen), actual)
+	}
+	if mismatched > 0 {
+		fmt.Fprintf(w, "%d of %d secrets don't match Vault\n", mismatched, len(entries))
+		return true
+	}
+	fmt.Fprintf(w, "All %d secrets match Vault\n", len(entries))
+	return false
+}
+
+// maskLength describes a hidden value by its length.
+func maskLength(n int) string {
+	return fmt.Sprintf("<%d chars>", n)
+}
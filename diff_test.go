@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffSecrets(t *testing.T) {
+	mv := newMockVault(t)
+	client := mv.client(t, "secret")
+	mv.seed("secret/data/app/db.password", map[string]interface{}{"value": "old"})
+	mv.seed("secret/data/app/db.port", map[string]interface{}{"value": "5432"})
+
+	data := map[string]interface{}{"db.password": "new", "db.port": 5432, "db.url": "u"}
+	keys := []string{"db.password", "db.port", "db.url"}
+	fieldFor := func(key string) (string, string) { return "app/" + key, "value" }
+
+	entries, err := diffSecrets(client, keys, data, fieldFor)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []diffEntry{
+		{Key: "db.password", Status: diffChanged, ExpectedLen: 3, ActualLen: 3},
+		{Key: "db.port", Status: diffUnchanged, ExpectedLen: 4, ActualLen: 4},
+		{Key: "db.url", Status: diffNew, ExpectedLen: 1},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("diffSecrets() = %v, expected %v", entries, expected)
+	}
+
+	var buf strings.Builder
+	if !printDiff(&buf, entries, func(key string) string { return "secret/app/" + key }) {
+		t.Error("expected printDiff to report differences")
+	}
+	want := "~ secret/app/db.password: <changed>\n" +
+		"  secret/app/db.port: <unchanged>\n" +
+		"+ secret/app/db.url: <new>\n" +
+		"1 new, 1 changed, 1 unchanged\n"
+	if buf.String() != want {
+		t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", buf.String(), want)
+	}
+}
+
+func TestDiffSecretsBundle(t *testing.T) {
+	mv := newMockVault(t)
+	client := mv.client(t, "secret")
+	mv.seed("secret/data/app/db", map[string]interface{}{"password": "p", "url": "u"})
+
+	data := map[string]interface{}{"db.password": "p", "db.url": "u"}
+	fieldFor := func(key string) (string, string) {
+		section, rest := splitTopLevelKey(key, ".")
+		return "app/" + section, rest
+	}
+
+	entries, err := diffSecrets(client, []string{"db.password", "db.url"}, data, fieldFor)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, e := range entries {
+		if e.Status != diffUnchanged {
+			t.Errorf("%s: status = %s, expected unchanged", e.Key, e.Status)
+		}
+	}
+	if calls := mv.Calls(); len(calls) != 1 {
+		t.Errorf("expected the bundle to be read once, got %v", calls)
+	}
+}
+
+func TestProcessFileDiff(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+	mv.seed("secret/data/app/db.password", map[string]interface{}{"value": "p"})
+
+	sopsFile := filepath.Join(t.TempDir(), "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("db:\n  password: p\n"), 0644)
+
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", Diff: true}
+	if err := processFile(context.Background(), cfg, sopsFile, "app"); err != nil {
+		t.Fatalf("expected no differences, got %v", err)
+	}
+
+	os.WriteFile(sopsFile, []byte("db:\n  password: changed\n"), 0644)
+	if err := processFile(context.Background(), cfg, sopsFile, "app"); !errors.Is(err, errDiffFound) {
+		t.Fatalf("expected errDiffFound, got %v", err)
+	}
+	for _, call := range mv.Calls() {
+		if !strings.HasPrefix(call, "GET ") {
+			t.Errorf("diff made a non-read call: %s", call)
+		}
+	}
+}
+
+func TestPrintVerify(t *testing.T) {
+	locationFor := func(key string) string { return "secret/app/" + key }
+	entries := []diffEntry{
+		{Key: "db.password", Status: diffChanged, ExpectedLen: 12, ActualLen: 8},
+		{Key: "db.port", Status: diffUnchanged, ExpectedLen: 4, ActualLen: 4},
+		{Key: "db.url", Status: diffNew, ExpectedLen: 20},
+	}
+
+	var buf strings.Builder
+	if !printVerify(&buf, entries, locationFor) {
+		t.Error("expected printVerify to report mismatches")
+	}
+	want := "MISMATCH secret/app/db.password: expected <12 chars> vs. actual <8 chars>\n" +
+		"MISMATCH secret/app/db.url: expected <20 chars> vs. actual <missing>\n" +
+		"2 of 3 secrets don't match Vault\n"
+	if buf.String() != want {
+		t.Errorf("printVerify output:\n%s\nexpected:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if printVerify(&buf, entries[1:2], locationFor) {
+		t.Error("expected no mismatches")
+	}
+	if buf.String() != "All 1 secrets match Vault\n" {
+		t.Errorf("printVerify output = %q", buf.String())
+	}
+}
+
+func TestProcessFileCompareHash(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+
+	sopsFile := filepath.Join(t.TempDir(), "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("db:\n  password: p\n"), 0644)
+
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", ExistsStrategy: strategyOverwrite, CompareHash: true}
+	if err := processFile(context.Background(), cfg, sopsFile, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// sha256("p")
+	want := "sha256:148de9c5a7a44d19e56cd9ae1a554bf67847afb0c58f6e12fa29ac7ddfca9940"
+	if got := mv.stored("secret/data/app/db.password")["value"]; got != want {
+		t.Fatalf("stored value = %v, expected %s", got, want)
+	}
+
+	// --verify-hash
+	cfg.Diff, cfg.VerifyOnly = true, true
+	if err := processFile(context.Background(), cfg, sopsFile, "app"); err != nil {
+		t.Fatalf("expected the hashes to match, got %v", err)
+	}
+	os.WriteFile(sopsFile, []byte("db:\n  password: changed\n"), 0644)
+	if err := processFile(context.Background(), cfg, sopsFile, "app"); !errors.Is(err, errDiffFound) {
+		t.Fatalf("expected errDiffFound, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// dopplerDefaultAPIURL is the Doppler API base URL.
+const dopplerDefaultAPIURL = "https://api.doppler.com"
+
+// DopplerClient is a minimal client for the Doppler REST API.
+type DopplerClient struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+}
+
+// NewDopplerClient creates a client authenticating with a Doppler service
+// or personal token.
+func NewDopplerClient(baseURL, token string) *DopplerClient {
+	return &DopplerClient{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+	}
+}
+
+// SetSecrets creates or updates secrets in a project config in one request.
+// Secrets not in the map are left untouched.
+func (c *DopplerClient) SetSecrets(project, config string, secrets map[string]string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"project": project,
+		"config":  config,
+		"secrets": secrets,
+	})
+	if err != nil {
+		return fmt.Errorf("marshaling request: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+"/v3/configs/config/secrets", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to write Doppler secrets to %s/%s: %w", project, config, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Messages []string `json:"messages"`
+		}
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return fmt.Errorf("failed to write Doppler secrets to %s/%s: %s: %s",
+			project, config, resp.Status, strings.Join(errResp.Messages, "; "))
+	}
+	return nil
+}
+
+// DopplerBackend writes secrets to a Doppler project config.
+type DopplerBackend struct {
+	client  *DopplerClient
+	project string
+	config  string
+}
+
+// NewDopplerBackend creates a Doppler backend. If project is empty, the
+// <vault-path> argument is used as the project name.
+func NewDopplerBackend(project, config, token string) (*DopplerBackend, error) {
+	if config == "" {
+		return nil, fmt.Errorf("--doppler-config is required")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("Doppler token required (--doppler-token or DOPPLER_TOKEN)")
+	}
+	return &DopplerBackend{
+		client:  NewDopplerClient(dopplerDefaultAPIURL, token),
+		project: project,
+		config:  config,
+	}, nil
+}
+
+func (d *DopplerBackend) projectFor(basePath string) string {
+	if d.project != "" {
+		return d.project
+	}
+	return basePath
+}
+
+// Location returns <project>/<config>/<NAME> for key.
+func (d *DopplerBackend) Location(basePath, key string) string {
+	return d.projectFor(basePath) + "/" + d.config + "/" + envVarName(key)
+}
+
+// WriteSecrets sets all keys in a single bulk request, so either every
+// secret is written or none are.
+func (d *DopplerBackend) WriteSecrets(ctx context.Context, basePath string, keys []string, data map[string]interface{}) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, errInterrupted
+	}
+
+	secrets := make(map[string]string, len(keys))
+	origin := make(map[string]string, len(keys))
+	for _, key := range keys {
+		name := envVarName(key)
+		if prev, ok := origin[name]; ok {
+			return 0, fmt.Errorf("keys %q and %q both map to secret %s", prev, key, name)
+		}
+		origin[name] = key
+		secrets[name] = formatValue(data[key])
+	}
+
+	if err := d.client.SetSecrets(d.projectFor(basePath), d.config, secrets); err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
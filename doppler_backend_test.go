@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDopplerBackendWriteSecrets(t *testing.T) {
+	var gotAuth, gotPath string
+	var gotBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotPath = r.Method + " " + r.URL.Path
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		writeJSON(w, map[string]interface{}{"secrets": map[string]interface{}{}})
+	}))
+	defer server.Close()
+
+	backend := &DopplerBackend{client: NewDopplerClient(server.URL, "dp.st.test"), config: "prd"}
+	data := map[string]interface{}{"db.password": "s3cr3t", "db.port": 5432}
+	written, err := backend.WriteSecrets(context.Background(), "myapp", []string{"db.password", "db.port"}, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if written != 2 {
+		t.Errorf("written = %d, expected 2", written)
+	}
+	if gotPath != "POST /v3/configs/config/secrets" {
+		t.Errorf("request = %s", gotPath)
+	}
+	if gotAuth != "Bearer dp.st.test" {
+		t.Errorf("Authorization = %q", gotAuth)
+	}
+	expected := map[string]interface{}{
+		"project": "myapp",
+		"config":  "prd",
+		"secrets": map[string]interface{}{"DB_PASSWORD": "s3cr3t", "DB_PORT": "5432"},
+	}
+	if !reflect.DeepEqual(gotBody, expected) {
+		t.Errorf("body = %v, expected %v", gotBody, expected)
+	}
+	if loc := backend.Location("myapp", "db.password"); loc != "myapp/prd/DB_PASSWORD" {
+		t.Errorf("Location = %q", loc)
+	}
+
+	t.Run("api error", func(t *testing.T) {
+		server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			writeJSON(w, map[string]interface{}{"messages": []string{"Invalid Service token"}, "success": false})
+		})
+		if _, err := backend.WriteSecrets(context.Background(), "myapp", []string{"db.password"}, data); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("colliding names", func(t *testing.T) {
+		data := map[string]interface{}{"db.password": "a", "db_password": "b"}
+		if _, err := backend.WriteSecrets(context.Background(), "myapp", []string{"db.password", "db_password"}, data); err == nil {
+			t.Fatal("expected collision error")
+		}
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		if _, err := NewDopplerBackend("myapp", "prd", ""); err == nil || !strings.Contains(err.Error(), "token required") {
+			t.Fatalf("NewDopplerBackend: expected missing token error, got %v", err)
+		}
+	})
+}
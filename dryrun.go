@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats for --output-format.
+const (
+	formatText     = "text"
+	formatJSON     = "json"
+	formatMarkdown = "markdown"
+)
+
+func printDryRun(path, mount string, data map[string]interface{}, mask string) {
+	fmt.Printf("[dry-run] Would write to Vault path: %s/%s\n", mount, path)
+	fmt.Printf("[dry-run] %d secrets:\n", len(data))
+
+	// Sort keys for consistent output
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Printf("  %s = %s\n", k, maskValue(data[k], mask))
+	}
+}
+
+// printBundleDryRun is printDryRun for --bundle, where all of data is
+// written as a single secret at path.
+func printBundleDryRun(path, mount string, data map[string]interface{}, mask string) {
+	fmt.Printf("[dry-run] Would write 1 secret with %d keys to Vault path: %s/%s\n", len(data), mount, path)
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Printf("  %s = %s\n", k, maskValue(data[k], mask))
+	}
+}
+
+// printDryRunRequests lists the Vault API request that would write each of
+// paths (under mount) for --verbose.
+func printDryRunRequests(w io.Writer, addr, mount string, kvVersion int, paths []string) {
+	fmt.Fprintf(w, "[dry-run] Would send %d Vault API requests:\n", len(paths))
+	for _, p := range paths {
+		fmt.Fprintf(w, "  PUT %s/v1/%s\n", strings.TrimSuffix(addr, "/"), kvAPIPath(mount, kvVersion, "data", p))
+	}
+}
+
+// writeDryRunYAML writes data, nested again on sep, to w as YAML for
+// --dry-run --output-file, with each value masked according to mask. With
+// arrays, keys flattened by --flatten-arrays become sequences again.
+func writeDryRunYAML(w io.Writer, data map[string]interface{}, sep string, arrays bool, mask string) error {
+	masked := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		masked[k] = maskValue(v, mask)
+	}
+	unflatten := Unflatten
+	if arrays {
+		unflatten = UnflattenArrays
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(unflatten(masked, sep)); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// Modes for --mask-value-length, from least to most revealing.
+const (
+	maskModeNone   = "none"
+	maskModeLength = "length"
+	maskModeHint   = "hint"
+	maskModeFull   = "full"
+)
+
+// validMaskMode reports whether mode is a supported --mask-value-length
+// value.
+func validMaskMode(mode string) bool {
+	switch mode {
+	case maskModeNone, maskModeLength, maskModeHint, maskModeFull:
+		return true
+	}
+	return false
+}
+
+// maskValue describes a secret value for display according to mode: nothing
+// but <secret> (none), its type and, for strings, its length (length, the
+// default), its first and last characters (hint), or the value itself (full).
+func maskValue(v interface{}, mode string) string {
+	switch mode {
+	case maskModeNone:
+		return "<secret>"
+	case maskModeHint:
+		// Too short to hint at without giving most of it away
+		runes := []rune(formatValue(v))
+		if len(runes) < 4 {
+			return "***"
+		}
+		return string(runes[0]) + "***" + string(runes[len(runes)-1])
+	case maskModeFull:
+		return formatValue(v)
+	}
+	switch val := v.(type) {
+	case string:
+		return fmt.Sprintf("<string, %d chars>", len(val))
+	default:
+		return fmt.Sprintf("<%T>", v)
+	}
+}
+
+// printMarkdownDryRun writes the dry-run as a Markdown table suitable for a
+// GitHub PR comment, and returns the rendered table. Values are masked the
+// same way as printDryRun. With bundle, every key shares the vaultPath
+// secret and is shown as <path>#<key>.
+func printMarkdownDryRun(w io.Writer, mount, vaultPath string, data map[string]interface{}, bundle bool) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("| Key | Vault Path | Type | Size |\n")
+	b.WriteString("|-----|-----------|------|------|\n")
+	for _, k := range keys {
+		typ, size := fmt.Sprintf("%T", data[k]), "-"
+		if s, ok := data[k].(string); ok {
+			typ, size = "string", fmt.Sprintf("%d chars", len(s))
+		}
+		location := mount + "/" + vaultPath + "/" + k
+		if bundle {
+			location = mount + "/" + vaultPath + "#" + k
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n",
+			escapeMarkdownCell(k), escapeMarkdownCell(location), typ, size)
+	}
+
+	table := b.String()
+	io.WriteString(w, table)
+	return table
+}
+
+// escapeMarkdownCell escapes characters that would break a Markdown table cell.
+func escapeMarkdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// shellSafe matches values that need no quoting in a POSIX shell.
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// printEnvExports prints an `export NAME=value` line for each secret, named
+// by envVarName, so the output can be sourced into a shell.
+func printEnvExports(w io.Writer, data map[string]interface{}) {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(w, "export %s=%s\n", envVarName(k), shellQuote(formatValue(data[k])))
+	}
+}
+
+// shellQuote quotes s for a POSIX shell: values with anything beyond a safe
+// set of characters are single-quoted, closing and reopening the quotes
+// around each embedded single quote.
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrintEnvExports(t *testing.T) {
+	data := map[string]interface{}{
+		"db.password": "s3cr3t",
+		"api-key":     "it's $HOME",
+		"port":        5432,
+	}
+
+	var buf strings.Builder
+	printEnvExports(&buf, data)
+
+	expected := "export API_KEY='it'\\''s $HOME'\n" +
+		"export DB_PASSWORD=s3cr3t\n" +
+		"export PORT=5432\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"plain", "plain"},
+		{"postgres://user@host:5432/db", "postgres://user@host:5432/db"},
+		{"", "''"},
+		{"two words", "'two words'"},
+		{"$(rm -rf /)", "'$(rm -rf /)'"},
+		{"it's", `'it'\''s'`},
+		{"line1\nline2", "'line1\nline2'"},
+	}
+
+	for _, tt := range tests {
+		if got := shellQuote(tt.input); got != tt.expected {
+			t.Errorf("shellQuote(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+}
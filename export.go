@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// runSops executes the sops binary with args and returns its stdout.
+// It is a variable so tests can substitute a fake executor.
+var runSops = func(args ...string) ([]byte, error) {
+	cmd := exec.Command("sops", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("sops %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// reencryptAsJSON marshals decrypted as JSON and encrypts it with the sops
+// binary, writing the result to outputPath.
+func reencryptAsJSON(decrypted map[string]interface{}, outputPath string, sopsArgs []string) error {
+	plain, err := json.MarshalIndent(decrypted, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling JSON: %w", err)
+	}
+	return encryptWithSops(plain, inputFormatJSON, outputPath, sopsArgs)
+}
+
+// encryptWithSops encrypts plain (in format, json or yaml) with the sops
+// binary, writing the result to outputPath. The plaintext is staged in a
+// private temp directory next to outputPath and the encrypted file is moved
+// into place only once sops succeeds.
+func encryptWithSops(plain []byte, format, outputPath string, sopsArgs []string) error {
+	tmpDir, err := os.MkdirTemp(filepath.Dir(outputPath), ".sops-to-vault-")
+	if err != nil {
+		return fmt.Errorf("creating temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	plainPath := filepath.Join(tmpDir, "plain."+format)
+	if err := os.WriteFile(plainPath, plain, 0600); err != nil {
+		return fmt.Errorf("writing temp file: %w", err)
+	}
+
+	encryptedPath := filepath.Join(tmpDir, "encrypted."+format)
+	args := []string{"--encrypt", "--input-type", format, "--output-type", format}
+	args = append(args, sopsArgs...)
+	args = append(args, "--output", encryptedPath, plainPath)
+	if _, err := runSops(args...); err != nil {
+		return err
+	}
+
+	if err := os.Rename(encryptedPath, outputPath); err != nil {
+		return fmt.Errorf("moving encrypted file: %w", err)
+	}
+	return nil
+}
+
+// sopsMetadata is the subset of a SOPS file's "sops" section that identifies
+// its master keys.
+type sopsMetadata struct {
+	KMS []struct {
+		Arn string `yaml:"arn" json:"arn"`
+	} `yaml:"kms" json:"kms"`
+	GCPKMS []struct {
+		ResourceID string `yaml:"resource_id" json:"resource_id"`
+	} `yaml:"gcp_kms" json:"gcp_kms"`
+	AzureKV []struct {
+		VaultURL string `yaml:"vault_url" json:"vault_url"`
+		Name     string `yaml:"name" json:"name"`
+		Version  string `yaml:"version" json:"version"`
+	} `yaml:"azure_kv" json:"azure_kv"`
+	HCVault []struct {
+		VaultAddress string `yaml:"vault_address" json:"vault_address"`
+		EnginePath   string `yaml:"engine_path" json:"engine_path"`
+		KeyName      string `yaml:"key_name" json:"key_name"`
+	} `yaml:"hc_vault" json:"hc_vault"`
+	Age []struct {
+		Recipient string `yaml:"recipient" json:"recipient"`
+	} `yaml:"age" json:"age"`
+	PGP []struct {
+		Fp string `yaml:"fp" json:"fp"`
+	} `yaml:"pgp" json:"pgp"`
+	KeyGroups []interface{} `yaml:"key_groups" json:"key_groups"`
+}
+
+// readSopsMetadata parses the sops section of an encrypted file in the given
+// input format. sops encrypts TOML as binary, which it stores as JSON.
+func readSopsMetadata(content []byte, format string) (sopsMetadata, error) {
+	var doc struct {
+		Sops sopsMetadata `yaml:"sops" json:"sops"`
+	}
+	switch format {
+	case inputFormatJSON, inputFormatTOML:
+		if err := json.Unmarshal(content, &doc); err != nil {
+			return sopsMetadata{}, fmt.Errorf("parsing SOPS metadata: %w", err)
+		}
+	case inputFormatDotenv:
+		return readDotenvSopsMetadata(content)
+	default:
+		if err := yaml.Unmarshal(content, &doc); err != nil {
+			return sopsMetadata{}, fmt.Errorf("parsing SOPS metadata: %w", err)
+		}
+	}
+	return doc.Sops, nil
+}
+
+// readDotenvSopsMetadata parses the metadata sops writes to dotenv files as
+// flattened keys, such as sops_age__list_0__map_recipient=age1...
+func readDotenvSopsMetadata(content []byte) (sopsMetadata, error) {
+	env, err := parseDotenv(content)
+	if err != nil {
+		return sopsMetadata{}, fmt.Errorf("parsing SOPS metadata: %w", err)
+	}
+
+	keys := make(map[string][]map[string]interface{})
+	for k, v := range env {
+		name, ok := strings.CutPrefix(k, "sops_")
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(name, "key_groups__") {
+			keys["key_groups"] = append(keys["key_groups"], nil)
+			continue
+		}
+		kind, rest, ok := strings.Cut(name, "__list_")
+		if !ok {
+			continue
+		}
+		index, field, ok := strings.Cut(rest, "__map_")
+		if !ok {
+			continue
+		}
+		i, err := strconv.Atoi(index)
+		if err != nil {
+			continue
+		}
+		for len(keys[kind]) <= i {
+			keys[kind] = append(keys[kind], map[string]interface{}{})
+		}
+		keys[kind][i][field] = v
+	}
+
+	// Reuse the JSON field names rather than mapping each key type by hand
+	raw, err := json.Marshal(keys)
+	if err != nil {
+		return sopsMetadata{}, err
+	}
+	var meta sopsMetadata
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return sopsMetadata{}, fmt.Errorf("parsing SOPS metadata: %w", err)
+	}
+	return meta, nil
+}
+
+// sopsKeyArgs reads the sops metadata of an encrypted file in the given input
+// format and returns the sops command line flags that select the same master
+// keys. Key groups can't be expressed as flags, so files that use them are
+// rejected rather than silently re-encrypted under the .sops.yaml rules.
+func sopsKeyArgs(path, format string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading SOPS file: %w", err)
+	}
+
+	meta, err := readSopsMetadata(content, format)
+	if err != nil {
+		return nil, err
+	}
+	if len(meta.KeyGroups) > 0 {
+		return nil, fmt.Errorf("%s uses sops key groups, which can't be reproduced with sops command line flags", path)
+	}
+
+	var args []string
+	add := func(flag string, values []string) {
+		if len(values) > 0 {
+			args = append(args, flag, strings.Join(values, ","))
+		}
+	}
+
+	var kms, gcp, azure, hcv, age, pgp []string
+	for _, k := range meta.KMS {
+		kms = append(kms, k.Arn)
+	}
+	for _, k := range meta.GCPKMS {
+		gcp = append(gcp, k.ResourceID)
+	}
+	for _, k := range meta.AzureKV {
+		azure = append(azure, fmt.Sprintf("%s/keys/%s/%s", strings.TrimSuffix(k.VaultURL, "/"), k.Name, k.Version))
+	}
+	for _, k := range meta.HCVault {
+		hcv = append(hcv, fmt.Sprintf("%s/v1/%s/keys/%s", strings.TrimSuffix(k.VaultAddress, "/"), k.EnginePath, k.KeyName))
+	}
+	for _, k := range meta.Age {
+		age = append(age, k.Recipient)
+	}
+	for _, k := range meta.PGP {
+		pgp = append(pgp, k.Fp)
+	}
+	add("--kms", kms)
+	add("--gcp-kms", gcp)
+	add("--azure-kv", azure)
+	add("--hc-vault-transit", hcv)
+	add("--age", age)
+	add("--pgp", pgp)
+
+	return args, nil
+}
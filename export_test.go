@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// stubSops replaces runSops for the duration of a test.
+func stubSops(t *testing.T, fn func(args ...string) ([]byte, error)) {
+	t.Helper()
+	orig := runSops
+	runSops = fn
+	t.Cleanup(func() { runSops = orig })
+}
+
+func TestReencryptAsJSON(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	t.Run("encrypts via sops and moves output", func(t *testing.T) {
+		var gotArgs []string
+		var gotPlain map[string]interface{}
+		stubSops(t, func(args ...string) ([]byte, error) {
+			gotArgs = args
+			input := args[len(args)-1]
+			output := args[len(args)-2]
+			content, _ := os.ReadFile(input)
+			json.Unmarshal(content, &gotPlain)
+			return nil, os.WriteFile(output, []byte(`{"encrypted":true}`), 0600)
+		})
+
+		outputPath := filepath.Join(tmpDir, "backup.enc.json")
+		data := map[string]interface{}{"db.password": "s3cr3t"}
+		if err := reencryptAsJSON(data, outputPath, []string{"--age", "age1xyz"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expectedPrefix := []string{"--encrypt", "--input-type", "json", "--output-type", "json", "--age", "age1xyz", "--output"}
+		if !reflect.DeepEqual(gotArgs[:len(expectedPrefix)], expectedPrefix) {
+			t.Errorf("unexpected sops args: %v", gotArgs)
+		}
+		if !reflect.DeepEqual(gotPlain, data) {
+			t.Errorf("sops received %v, expected %v", gotPlain, data)
+		}
+
+		content, _ := os.ReadFile(outputPath)
+		if string(content) != `{"encrypted":true}` {
+			t.Errorf("unexpected output file content: %s", content)
+		}
+
+		entries, _ := os.ReadDir(tmpDir)
+		if len(entries) != 1 {
+			t.Errorf("expected temp files to be cleaned up, found %d entries", len(entries))
+		}
+	})
+
+	t.Run("leaves output untouched on sops failure", func(t *testing.T) {
+		stubSops(t, func(args ...string) ([]byte, error) {
+			return nil, errors.New("no keys")
+		})
+
+		outputPath := filepath.Join(tmpDir, "failed.enc.json")
+		if err := reencryptAsJSON(map[string]interface{}{"k": "v"}, outputPath, nil); err == nil {
+			t.Fatal("expected error")
+		}
+		if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+			t.Error("expected no output file")
+		}
+	})
+}
+
+func TestSopsKeyArgs(t *testing.T) {
+	expected := []string{"--gcp-kms", "projects/p/locations/global/keyRings/r/cryptoKeys/k", "--age", "age1aaa,age1bbb"}
+
+	tests := []struct {
+		name    string
+		format  string
+		content string
+	}{
+		{
+			name:   "yaml",
+			format: inputFormatYAML,
+			content: `password: ENC[AES256_GCM,data:xxx]
+sops:
+    gcp_kms:
+        - resource_id: projects/p/locations/global/keyRings/r/cryptoKeys/k
+    age:
+        - recipient: age1aaa
+        - recipient: age1bbb
+`,
+		},
+		{
+			name:   "json",
+			format: inputFormatJSON,
+			content: `{"password": "ENC[AES256_GCM,data:xxx]", "sops": {
+  "gcp_kms": [{"resource_id": "projects/p/locations/global/keyRings/r/cryptoKeys/k"}],
+  "age": [{"recipient": "age1aaa"}, {"recipient": "age1bbb"}]
+}}`,
+		},
+		{
+			name:   "toml encrypted as binary",
+			format: inputFormatTOML,
+			content: `{"data": "ENC[AES256_GCM,data:xxx]", "sops": {
+  "gcp_kms": [{"resource_id": "projects/p/locations/global/keyRings/r/cryptoKeys/k"}],
+  "age": [{"recipient": "age1aaa"}, {"recipient": "age1bbb"}]
+}}`,
+		},
+		{
+			name:   "dotenv",
+			format: inputFormatDotenv,
+			content: `PASSWORD=ENC[AES256_GCM,data:xxx]
+sops_age__list_1__map_recipient=age1bbb
+sops_age__list_0__map_enc=-----BEGIN AGE ENCRYPTED FILE-----\nxxx\n-----END AGE ENCRYPTED FILE-----\n
+sops_age__list_0__map_recipient=age1aaa
+sops_gcp_kms__list_0__map_resource_id=projects/p/locations/global/keyRings/r/cryptoKeys/k
+sops_version=3.8.1
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app-secrets.enc")
+			os.WriteFile(path, []byte(tt.content), 0644)
+
+			args, err := sopsKeyArgs(path, tt.format)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(args, expected) {
+				t.Errorf("sopsKeyArgs() = %v, expected %v", args, expected)
+			}
+		})
+	}
+}
+
+func TestSopsKeyArgsKeyGroups(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+	}{
+		{
+			name:   "yaml",
+			format: inputFormatYAML,
+			content: `password: ENC[AES256_GCM,data:xxx]
+sops:
+    key_groups:
+        - age:
+            - recipient: age1aaa
+        - pgp:
+            - fp: ABCDEF
+`,
+		},
+		{
+			name:   "dotenv",
+			format: inputFormatDotenv,
+			content: `PASSWORD=ENC[AES256_GCM,data:xxx]
+sops_key_groups__list_0__map_age__list_0__map_recipient=age1aaa
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app-secrets.enc")
+			os.WriteFile(path, []byte(tt.content), 0644)
+
+			if _, err := sopsKeyArgs(path, tt.format); err == nil {
+				t.Fatal("expected an error for a file using key groups")
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// filterByExactKeys returns the subset of data whose keys are listed in keys,
+// along with the matched keys in sorted order. Listed keys missing from data
+// are reported together in the error.
+func filterByExactKeys(data map[string]interface{}, keys []string) (map[string]interface{}, []string, error) {
+	filtered := make(map[string]interface{}, len(keys))
+	var matched, unmatched []string
+	for _, k := range keys {
+		if _, done := filtered[k]; done {
+			continue
+		}
+		v, ok := data[k]
+		if !ok {
+			unmatched = append(unmatched, k)
+			continue
+		}
+		filtered[k] = v
+		matched = append(matched, k)
+	}
+	sort.Strings(matched)
+
+	if len(unmatched) > 0 {
+		return filtered, matched, fmt.Errorf("keys not found in SOPS file: %s", strings.Join(unmatched, ", "))
+	}
+	return filtered, matched, nil
+}
+
+// filterByPattern returns the subset of data whose keys match include and
+// don't match exclude, along with the dropped keys in sorted order. A nil
+// pattern doesn't filter.
+func filterByPattern(data map[string]interface{}, include, exclude *regexp.Regexp) (map[string]interface{}, []string) {
+	filtered := make(map[string]interface{}, len(data))
+	var dropped []string
+	for k, v := range data {
+		if (include != nil && !include.MatchString(k)) || (exclude != nil && exclude.MatchString(k)) {
+			dropped = append(dropped, k)
+			continue
+		}
+		filtered[k] = v
+	}
+	sort.Strings(dropped)
+	return filtered, dropped
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var result []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// sopsMetadataKey is the top-level key SOPS stores its encryption metadata
+// under (kms, pgp, lastmodified, mac, ...).
+const sopsMetadataKey = "sops"
+
+// dropSopsMetadata removes the flattened SOPS metadata keys ("sops" and
+// anything under "sops<sep>") from data.
+func dropSopsMetadata(data map[string]interface{}, sep string) map[string]interface{} {
+	result := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		if k == sopsMetadataKey || strings.HasPrefix(k, sopsMetadataKey+sep) {
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// stripKeyPrefix removes prefix from every key in data that starts with it.
+// It returns the renamed data, the original name of each renamed key, and the
+// keys left unchanged because they don't start with prefix (sorted). A
+// stripped key that clashes with an unchanged one is an error.
+func stripKeyPrefix(data map[string]interface{}, prefix string) (map[string]interface{}, map[string]string, []string, error) {
+	stripped := make(map[string]interface{}, len(data))
+	original := make(map[string]string)
+	var unchanged []string
+	for k, v := range data {
+		name := strings.TrimPrefix(k, prefix)
+		if name == k || name == "" {
+			unchanged = append(unchanged, k)
+			stripped[k] = v
+			continue
+		}
+		original[name] = k
+		stripped[name] = v
+	}
+	sort.Strings(unchanged)
+
+	for _, k := range unchanged {
+		if from, ok := original[k]; ok {
+			return nil, nil, nil, fmt.Errorf("key %s becomes %s after stripping %q, which is already a key", from, k, prefix)
+		}
+	}
+	return stripped, original, unchanged, nil
+}
+
+// loadKeyRenameMap reads a --key-rename-map file: a YAML map of flattened key
+// names to the names to write them as.
+func loadKeyRenameMap(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var renames map[string]string
+	if err := yaml.Unmarshal(content, &renames); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return renames, nil
+}
+
+// renameKeys renames the keys of data found in renames. It returns the
+// renamed data, the original name of each renamed key, and the entries of
+// renames that match no key (sorted). Two keys that would end up with the
+// same name are an error.
+func renameKeys(data map[string]interface{}, renames map[string]string) (map[string]interface{}, map[string]string, []string, error) {
+	renamed := make(map[string]interface{}, len(data))
+	original := make(map[string]string)
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name := k
+		if to, ok := renames[k]; ok {
+			name = to
+			original[to] = k
+		}
+		if _, dup := renamed[name]; dup {
+			return nil, nil, nil, fmt.Errorf("--key-rename-map: two keys would both be written as %s", name)
+		}
+		renamed[name] = data[k]
+	}
+
+	var unused []string
+	for from := range renames {
+		if _, ok := data[from]; !ok {
+			unused = append(unused, from)
+		}
+	}
+	sort.Strings(unused)
+	return renamed, original, unused, nil
+}
+
+// recordRenames adds renamed (new name -> previous name) to original (name
+// -> name in the SOPS file), following keys renamed more than once back to
+// their first name.
+func recordRenames(original, renamed map[string]string) {
+	first := make(map[string]string, len(renamed))
+	for to, from := range renamed {
+		if name, ok := original[from]; ok {
+			from = name
+		}
+		first[to] = from
+	}
+	for _, from := range renamed {
+		delete(original, from)
+	}
+	for to, from := range first {
+		original[to] = from
+	}
+}
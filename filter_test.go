@@ -0,0 +1,162 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestFilterByExactKeys(t *testing.T) {
+	data := map[string]interface{}{
+		"db.password": "p",
+		"db.url":      "u",
+		"api.key":     "k",
+	}
+
+	t.Run("keeps only listed keys", func(t *testing.T) {
+		filtered, matched, err := filterByExactKeys(data, []string{"db.password", "api.key", "db.password"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := map[string]interface{}{"db.password": "p", "api.key": "k"}
+		if !reflect.DeepEqual(filtered, expected) {
+			t.Errorf("filtered = %v, expected %v", filtered, expected)
+		}
+		if !reflect.DeepEqual(matched, []string{"api.key", "db.password"}) {
+			t.Errorf("matched = %v", matched)
+		}
+	})
+
+	t.Run("reports unmatched keys", func(t *testing.T) {
+		_, matched, err := filterByExactKeys(data, []string{"db.url", "db.pass", "missing"})
+		if err == nil || !strings.Contains(err.Error(), "db.pass, missing") {
+			t.Errorf("expected error listing unmatched keys, got %v", err)
+		}
+		if !reflect.DeepEqual(matched, []string{"db.url"}) {
+			t.Errorf("matched = %v, expected [db.url]", matched)
+		}
+	})
+}
+
+func TestFilterByPattern(t *testing.T) {
+	data := map[string]interface{}{"db.password": "p", "db.url": "u", "api.key": "k", "api.debug": "d"}
+
+	tests := []struct {
+		name     string
+		include  *regexp.Regexp
+		exclude  *regexp.Regexp
+		expected []string
+		dropped  []string
+	}{
+		{"no patterns", nil, nil, []string{"api.debug", "api.key", "db.password", "db.url"}, nil},
+		{"include", regexp.MustCompile(`^db\.`), nil, []string{"db.password", "db.url"}, []string{"api.debug", "api.key"}},
+		{"exclude", nil, regexp.MustCompile(`debug`), []string{"api.key", "db.password", "db.url"}, []string{"api.debug"}},
+		{"both", regexp.MustCompile(`^api\.`), regexp.MustCompile(`debug`), []string{"api.key"}, []string{"api.debug", "db.password", "db.url"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filtered, dropped := filterByPattern(data, tt.include, tt.exclude)
+			var keys []string
+			for k := range filtered {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, tt.expected) {
+				t.Errorf("kept = %v, expected %v", keys, tt.expected)
+			}
+			if !reflect.DeepEqual(dropped, tt.dropped) {
+				t.Errorf("dropped = %v, expected %v", dropped, tt.dropped)
+			}
+		})
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	result := splitList(" a, b,,c ,")
+	if !reflect.DeepEqual(result, []string{"a", "b", "c"}) {
+		t.Errorf("splitList() = %v", result)
+	}
+	if splitList("") != nil {
+		t.Error("expected nil for empty input")
+	}
+}
+
+func TestStripKeyPrefix(t *testing.T) {
+	data := map[string]interface{}{"app.db.password": "p", "app.token": "t", "other": "o"}
+	stripped, original, unchanged, err := stripKeyPrefix(data, "app.")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{"db.password": "p", "token": "t", "other": "o"}
+	if !reflect.DeepEqual(stripped, expected) {
+		t.Errorf("stripped = %v, expected %v", stripped, expected)
+	}
+	expectedOriginal := map[string]string{"db.password": "app.db.password", "token": "app.token"}
+	if !reflect.DeepEqual(original, expectedOriginal) {
+		t.Errorf("original = %v, expected %v", original, expectedOriginal)
+	}
+	if !reflect.DeepEqual(unchanged, []string{"other"}) {
+		t.Errorf("unchanged = %v, expected [other]", unchanged)
+	}
+
+	t.Run("clash", func(t *testing.T) {
+		data := map[string]interface{}{"app.token": "t", "token": "u"}
+		if _, _, _, err := stripKeyPrefix(data, "app."); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestRenameKeys(t *testing.T) {
+	data := map[string]interface{}{"db.userName": "u", "db.passWord": "p", "token": "t"}
+	renames := map[string]string{"db.userName": "db.user_name", "db.passWord": "db.password", "api.key": "api_key"}
+
+	renamed, original, unused, err := renameKeys(data, renames)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{"db.user_name": "u", "db.password": "p", "token": "t"}
+	if !reflect.DeepEqual(renamed, expected) {
+		t.Errorf("renamed = %v, expected %v", renamed, expected)
+	}
+	expectedOriginal := map[string]string{"db.user_name": "db.userName", "db.password": "db.passWord"}
+	if !reflect.DeepEqual(original, expectedOriginal) {
+		t.Errorf("original = %v, expected %v", original, expectedOriginal)
+	}
+	if !reflect.DeepEqual(unused, []string{"api.key"}) {
+		t.Errorf("unused = %v, expected [api.key]", unused)
+	}
+
+	t.Run("clash", func(t *testing.T) {
+		if _, _, _, err := renameKeys(data, map[string]string{"db.userName": "token"}); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestRecordRenames(t *testing.T) {
+	original := make(map[string]string)
+	recordRenames(original, map[string]string{"app.db_user": "app.dbUser", "app.token": "app.secret"})
+	recordRenames(original, map[string]string{"db_user": "app.db_user", "other": "app.other"})
+
+	expected := map[string]string{"db_user": "app.dbUser", "app.token": "app.secret", "other": "app.other"}
+	if !reflect.DeepEqual(original, expected) {
+		t.Errorf("original = %v, expected %v", original, expected)
+	}
+}
+
+func TestDropSopsMetadata(t *testing.T) {
+	data := map[string]interface{}{
+		"sops.kms.0.arn":    "arn:aws:kms:us-east-1:123:key/abc",
+		"sops.lastmodified": "2024-01-01T00:00:00Z",
+		"sopsy.key":         "kept",
+		"db.sops":           "kept",
+	}
+	expected := map[string]interface{}{"sopsy.key": "kept", "db.sops": "kept"}
+	if got := dropSopsMetadata(data, "."); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+}
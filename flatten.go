@@ -1,25 +1,231 @@
 package main
 
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultSeparator joins the segments of a flattened key.
+const defaultSeparator = "."
+
 // Flatten converts a nested map structure into a flat map with dot-notation keys.
 // For example: {"admin": {"oauth2": {"clientID": "x"}}} becomes {"admin.oauth2.clientID": "x"}
 func Flatten(data map[string]interface{}) map[string]interface{} {
+	return FlattenWithSeparator(data, defaultSeparator)
+}
+
+// FlattenWithSeparator is Flatten with the key segments joined by sep.
+// For example, with sep "__": {"db": {"url": "x"}} becomes {"db__url": "x"}
+func FlattenWithSeparator(data map[string]interface{}, sep string) map[string]interface{} {
 	result := make(map[string]interface{})
-	flattenRecursive(data, "", result)
+	flattenRecursive(data, "", sep, 1, 0, false, result) // can't fail without a depth limit
 	return result
 }
 
-func flattenRecursive(data map[string]interface{}, prefix string, result map[string]interface{}) {
+// FlattenWithOptions is FlattenWithSeparator with keys limited to maxDepth
+// segments (0 for no limit). A map found at that depth is kept whole, as a
+// JSON string.
+// For example, with maxDepth 2: {"a": {"b": {"c": 1}}} becomes {"a.b": "{\"c\":1}"}
+func FlattenWithOptions(data map[string]interface{}, sep string, maxDepth int) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	if err := flattenRecursive(data, "", sep, 1, maxDepth, false, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FlattenWithArraySupport is FlattenWithOptions that also flattens arrays,
+// with each element's index as its key segment. Empty arrays are kept as
+// they are.
+// For example: {"allowedIPs": ["10.0.0.1", "10.0.0.2"]} becomes
+// {"allowedIPs.0": "10.0.0.1", "allowedIPs.1": "10.0.0.2"}
+func FlattenWithArraySupport(data map[string]interface{}, sep string, maxDepth int) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	if err := flattenRecursive(data, "", sep, 1, maxDepth, true, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func flattenRecursive(data map[string]interface{}, prefix, sep string, depth, maxDepth int, arrays bool, result map[string]interface{}) error {
 	for key, value := range data {
 		fullKey := key
 		if prefix != "" {
-			fullKey = prefix + "." + key
+			fullKey = prefix + sep + key
+		}
+		if err := flattenValue(value, fullKey, sep, depth, maxDepth, arrays, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flattenValue adds value to result under key, descending into maps, and
+// into arrays if arrays is set, unless depth has reached maxDepth.
+func flattenValue(value interface{}, key, sep string, depth, maxDepth int, arrays bool, result map[string]interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if maxDepth > 0 && depth >= maxDepth {
+			return flattenAsJSON(v, key, result)
+		}
+		return flattenRecursive(v, key, sep, depth+1, maxDepth, arrays, result)
+	case []interface{}:
+		if !arrays || len(v) == 0 {
+			break
+		}
+		if maxDepth > 0 && depth >= maxDepth {
+			return flattenAsJSON(v, key, result)
+		}
+		for i, elem := range v {
+			if err := flattenValue(elem, key+sep+strconv.Itoa(i), sep, depth+1, maxDepth, arrays, result); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	result[key] = value
+	return nil
+}
+
+// flattenAsJSON adds value to result under key as a JSON string.
+func flattenAsJSON(value interface{}, key string, result map[string]interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encoding %s as JSON: %w", key, err)
+	}
+	result[key] = string(encoded)
+	return nil
+}
+
+// encodeComplexValues replaces each map or array value in data (a sequence
+// without --flatten-arrays, say) with its JSON encoding, for
+// --json-encode-complex. Otherwise such values are formatted by formatValue,
+// e.g. as [a b].
+func encodeComplexValues(data map[string]interface{}) error {
+	for key, value := range data {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			if err := flattenAsJSON(value, key, data); err != nil {
+				return err
+			}
 		}
+	}
+	return nil
+}
+
+// miscSection holds keys that have no top-level section of their own.
+const miscSection = "misc"
+
+// splitTopLevelKey splits a flattened key into its top-level section and the
+// remaining key at the first sep. Keys without a section are placed in
+// miscSection.
+// For example: "db.password" -> ("db", "password"), "token" -> ("misc", "token")
+func splitTopLevelKey(key, sep string) (string, string) {
+	if idx := strings.Index(key, sep); idx != -1 {
+		return key[:idx], key[idx+len(sep):]
+	}
+	return miscSection, key
+}
+
+// splitKeyByTopLevel groups a flattened map by top-level section, keyed by
+// the remainder of each key.
+// For example: {"db.password": "x", "token": "y"} becomes
+// {"db": {"password": "x"}, "misc": {"token": "y"}}
+func splitKeyByTopLevel(flat map[string]interface{}, sep string) map[string]map[string]interface{} {
+	result := make(map[string]map[string]interface{})
+	for key, value := range flat {
+		section, rest := splitTopLevelKey(key, sep)
+		if result[section] == nil {
+			result[section] = make(map[string]interface{})
+		}
+		result[section][rest] = value
+	}
+	return result
+}
+
+// Unflatten reverses FlattenWithSeparator, splitting each key on sep to
+// rebuild the nested map.
+// For example: {"admin.oauth2.clientID": "x"} becomes {"admin": {"oauth2": {"clientID": "x"}}}
+// A key whose prefix is itself a key with a value, such as "db.url" alongside
+// "db", can't be nested under it, so its remainder is kept as a flat key at
+// that level ({"db": "x", "db.url": "y"}). Keys starting with sep are kept
+// whole. Either way flattening the result gives back data.
+func Unflatten(data map[string]interface{}, sep string) map[string]interface{} {
+	// Sorted, a key comes before every key it is a prefix of, so leaf
+	// values are placed before anything that would nest beneath them
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make(map[string]interface{})
+	for _, key := range keys {
+		segments := strings.Split(key, sep)
+		if segments[0] == "" {
+			result[key] = data[key]
+			continue
+		}
+
+		node := result
+		for i, segment := range segments {
+			if i == len(segments)-1 {
+				node[segment] = data[key]
+				break
+			}
+			existing, ok := node[segment]
+			if !ok {
+				nested := make(map[string]interface{})
+				node[segment] = nested
+				node = nested
+				continue
+			}
+			nested, ok := existing.(map[string]interface{})
+			if !ok {
+				node[strings.Join(segments[i:], sep)] = data[key]
+				break
+			}
+			node = nested
+		}
+	}
+	return result
+}
 
-		switch v := value.(type) {
-		case map[string]interface{}:
-			flattenRecursive(v, fullKey, result)
-		default:
-			result[fullKey] = value
+// UnflattenArrays is Unflatten for keys from FlattenWithArraySupport: after
+// nesting, every map whose keys are exactly 0 to n-1 becomes an array again.
+// For example: {"allowedIPs.0": "10.0.0.1", "allowedIPs.1": "10.0.0.2"}
+// becomes {"allowedIPs": ["10.0.0.1", "10.0.0.2"]}
+func UnflattenArrays(data map[string]interface{}, sep string) map[string]interface{} {
+	result := Unflatten(data, sep)
+	for k, v := range result {
+		result[k] = restoreArrays(v)
+	}
+	return result
+}
+
+// restoreArrays converts value, and any maps nested in it, to arrays where
+// their keys are the indexes 0 to n-1.
+func restoreArrays(value interface{}) interface{} {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	for k, v := range m {
+		m[k] = restoreArrays(v)
+	}
+	arr := make([]interface{}, len(m))
+	for i := range arr {
+		elem, ok := m[strconv.Itoa(i)]
+		if !ok {
+			return m
 		}
+		arr[i] = elem
+	}
+	if len(arr) == 0 {
+		return m
 	}
+	return arr
 }
@@ -76,3 +76,263 @@ func TestFlatten(t *testing.T) {
 		})
 	}
 }
+
+func TestFlattenWithSeparator(t *testing.T) {
+	input := map[string]interface{}{
+		"admin": map[string]interface{}{
+			"oauth2": map[string]interface{}{"clientID": "id"},
+		},
+		"db.host": "localhost",
+		"token":   "flat",
+	}
+	expected := map[string]interface{}{
+		"admin__oauth2__clientID": "id",
+		"db.host":                 "localhost",
+		"token":                   "flat",
+	}
+
+	result := FlattenWithSeparator(input, "__")
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("FlattenWithSeparator() = %v, expected %v", result, expected)
+	}
+}
+
+func TestSplitKeyByTopLevel(t *testing.T) {
+	input := map[string]interface{}{
+		"database.password":   "pass",
+		"database.url":        "postgres://localhost",
+		"api.key":             "key",
+		"api.oauth2.secret":   "oauth",
+		"token":               "flat",
+		"admin.publicAddress": "https://example.com",
+	}
+	expected := map[string]map[string]interface{}{
+		"database": {"password": "pass", "url": "postgres://localhost"},
+		"api":      {"key": "key", "oauth2.secret": "oauth"},
+		"admin":    {"publicAddress": "https://example.com"},
+		"misc":     {"token": "flat"},
+	}
+
+	result := splitKeyByTopLevel(input, ".")
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("splitKeyByTopLevel() = %v, expected %v", result, expected)
+	}
+}
+
+func TestSplitKeyByTopLevelSeparator(t *testing.T) {
+	input := map[string]interface{}{
+		"api__oauth2__secret": "oauth",
+		"db.host":             "localhost",
+	}
+	expected := map[string]map[string]interface{}{
+		"api":  {"oauth2__secret": "oauth"},
+		"misc": {"db.host": "localhost"},
+	}
+
+	result := splitKeyByTopLevel(input, "__")
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("splitKeyByTopLevel() = %v, expected %v", result, expected)
+	}
+}
+
+func TestUnflatten(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    map[string]interface{}
+		sep      string
+		expected map[string]interface{}
+	}{
+		{
+			name:     "flat keys",
+			input:    map[string]interface{}{"key1": "value1", "key2": 42},
+			sep:      ".",
+			expected: map[string]interface{}{"key1": "value1", "key2": 42},
+		},
+		{
+			name: "nested keys",
+			input: map[string]interface{}{
+				"admin.oauth2.clientID":     "id",
+				"admin.oauth2.clientSecret": "secret",
+				"admin.publicAddress":       "https://example.com",
+				"token":                     "flat",
+			},
+			sep: ".",
+			expected: map[string]interface{}{
+				"admin": map[string]interface{}{
+					"oauth2": map[string]interface{}{
+						"clientID":     "id",
+						"clientSecret": "secret",
+					},
+					"publicAddress": "https://example.com",
+				},
+				"token": "flat",
+			},
+		},
+		{
+			name:  "custom separator",
+			input: map[string]interface{}{"db__host": "localhost", "db__user.name": "admin"},
+			sep:   "__",
+			expected: map[string]interface{}{
+				"db": map[string]interface{}{"host": "localhost", "user.name": "admin"},
+			},
+		},
+		{
+			name:     "key is a prefix of another key",
+			input:    map[string]interface{}{"db": "x", "db.url": "y", "db.url.port": "z"},
+			sep:      ".",
+			expected: map[string]interface{}{"db": "x", "db.url": "y", "db.url.port": "z"},
+		},
+		{
+			name:  "nested key is a prefix of another key",
+			input: map[string]interface{}{"api.db": "x", "api.db.url": "y", "api.key": "z"},
+			sep:   ".",
+			expected: map[string]interface{}{
+				"api": map[string]interface{}{"db": "x", "db.url": "y", "key": "z"},
+			},
+		},
+		{
+			name:     "leading separator",
+			input:    map[string]interface{}{".hidden": "x", "a..b": "y"},
+			sep:      ".",
+			expected: map[string]interface{}{".hidden": "x", "a": map[string]interface{}{"": map[string]interface{}{"b": "y"}}},
+		},
+		{
+			name:     "empty map",
+			input:    map[string]interface{}{},
+			sep:      ".",
+			expected: map[string]interface{}{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Unflatten(tt.input, tt.sep)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Unflatten() = %v, expected %v", result, tt.expected)
+			}
+			if roundTrip := FlattenWithSeparator(result, tt.sep); !reflect.DeepEqual(roundTrip, tt.input) {
+				t.Errorf("FlattenWithSeparator(Unflatten()) = %v, expected %v", roundTrip, tt.input)
+			}
+		})
+	}
+}
+
+func TestFlattenWithOptions(t *testing.T) {
+	input := map[string]interface{}{
+		"token": "t",
+		"config": map[string]interface{}{
+			"name": "app",
+			"db": map[string]interface{}{
+				"host": "h",
+				"pool": map[string]interface{}{"max": 10},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		maxDepth int
+		expected map[string]interface{}
+	}{
+		{
+			name:     "unlimited",
+			maxDepth: 0,
+			expected: map[string]interface{}{"token": "t", "config.name": "app", "config.db.host": "h", "config.db.pool.max": 10},
+		},
+		{
+			name:     "two levels",
+			maxDepth: 2,
+			expected: map[string]interface{}{"token": "t", "config.name": "app", "config.db": `{"host":"h","pool":{"max":10}}`},
+		},
+		{
+			name:     "one level",
+			maxDepth: 1,
+			expected: map[string]interface{}{"token": "t", "config": `{"db":{"host":"h","pool":{"max":10}},"name":"app"}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := FlattenWithOptions(input, ".", tt.maxDepth)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("FlattenWithOptions() = %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFlattenWithArraySupport(t *testing.T) {
+	input := map[string]interface{}{
+		"allowedIPs": []interface{}{"10.0.0.1", "10.0.0.2"},
+		"users": []interface{}{
+			map[string]interface{}{"name": "a", "roles": []interface{}{"admin"}},
+		},
+		"empty": []interface{}{},
+	}
+
+	result, err := FlattenWithArraySupport(input, ".", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"allowedIPs.0":    "10.0.0.1",
+		"allowedIPs.1":    "10.0.0.2",
+		"users.0.name":    "a",
+		"users.0.roles.0": "admin",
+		"empty":           []interface{}{},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("FlattenWithArraySupport() = %v, expected %v", result, expected)
+	}
+
+	t.Run("max depth", func(t *testing.T) {
+		result, err := FlattenWithArraySupport(input, ".", 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := result["users.0"]; got != `{"name":"a","roles":["admin"]}` {
+			t.Errorf("users.0 = %v, expected it kept as JSON", got)
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		if got := UnflattenArrays(result, "."); !reflect.DeepEqual(got, input) {
+			t.Errorf("UnflattenArrays() = %v, expected %v", got, input)
+		}
+	})
+}
+
+func TestEncodeComplexValues(t *testing.T) {
+	data := FlattenWithSeparator(map[string]interface{}{
+		"allowedIPs": []interface{}{"10.0.0.1", "10.0.0.2"},
+		"users":      []interface{}{map[string]interface{}{"name": "a"}},
+		"db":         map[string]interface{}{"port": 5432},
+	}, ".")
+
+	if err := encodeComplexValues(data); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"allowedIPs": `["10.0.0.1","10.0.0.2"]`,
+		"users":      `[{"name":"a"}]`,
+		"db.port":    5432,
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("encodeComplexValues() = %v, expected %v", data, expected)
+	}
+}
+
+func TestUnflattenArrays(t *testing.T) {
+	// Only maps keyed by every index from 0 become arrays
+	data := map[string]interface{}{"a.0": "x", "a.1": "y", "b.1": "z", "c.0": "w", "c.name": "n"}
+	expected := map[string]interface{}{
+		"a": []interface{}{"x", "y"},
+		"b": map[string]interface{}{"1": "z"},
+		"c": map[string]interface{}{"0": "w", "name": "n"},
+	}
+	if got := UnflattenArrays(data, "."); !reflect.DeepEqual(got, expected) {
+		t.Errorf("UnflattenArrays() = %v, expected %v", got, expected)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Input formats for --format. Except for toml, the names match sops' own
+// --input-type values.
+const (
+	inputFormatYAML   = "yaml"
+	inputFormatJSON   = "json"
+	inputFormatDotenv = "dotenv"
+	inputFormatTOML   = "toml"
+)
+
+// detectFormat guesses a SOPS file's format from its extension, falling back
+// to YAML. For example: "app.enc.json" -> json, "prod.env" -> dotenv.
+func detectFormat(path string) string {
+	base := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(base, ".json"):
+		return inputFormatJSON
+	case strings.HasSuffix(base, ".env"), base == ".env":
+		return inputFormatDotenv
+	case strings.HasSuffix(base, ".toml"):
+		return inputFormatTOML
+	default:
+		return inputFormatYAML
+	}
+}
+
+// sopsFormat returns the sops format to decrypt a file of the given input
+// format with. sops has no TOML support and encrypts .toml files as binary,
+// which decrypts back to the original TOML text.
+func sopsFormat(format string) string {
+	if format == inputFormatTOML {
+		return "binary"
+	}
+	return format
+}
+
+// validInputFormat reports whether name is a supported --format value.
+func validInputFormat(name string) bool {
+	switch name {
+	case inputFormatYAML, inputFormatJSON, inputFormatDotenv, inputFormatTOML:
+		return true
+	}
+	return false
+}
+
+// parseDecrypted parses decrypted SOPS content in the given format.
+func parseDecrypted(content []byte, format string) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	switch format {
+	case inputFormatJSON:
+		// Keep numbers as written; float64 would print large integers as 1e+06
+		dec := json.NewDecoder(bytes.NewReader(content))
+		dec.UseNumber()
+		if err := dec.Decode(&data); err != nil {
+			return nil, fmt.Errorf("parsing JSON: %w", err)
+		}
+	case inputFormatDotenv:
+		var err error
+		if data, err = parseDotenv(content); err != nil {
+			return nil, fmt.Errorf("parsing dotenv: %w", err)
+		}
+	case inputFormatTOML:
+		if err := toml.Unmarshal(content, &data); err != nil {
+			return nil, fmt.Errorf("parsing TOML: %w", err)
+		}
+		normalizeTOML(data)
+	default:
+		if err := yaml.Unmarshal(content, &data); err != nil {
+			return nil, fmt.Errorf("parsing YAML: %w", err)
+		}
+	}
+	return data, nil
+}
+
+// normalizeTOML rewrites arrays of tables, which the TOML decoder returns as
+// []map[string]interface{}, as []interface{} so they are treated the same as
+// a YAML list of maps. Inline tables already decode to plain maps.
+func normalizeTOML(data map[string]interface{}) {
+	for k, v := range data {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			normalizeTOML(val)
+		case []map[string]interface{}:
+			list := make([]interface{}, len(val))
+			for i, table := range val {
+				normalizeTOML(table)
+				list[i] = table
+			}
+			data[k] = list
+		}
+	}
+}
+
+// parseDotenv parses KEY=VALUE lines. Blank lines and # comments are skipped,
+// an "export " prefix is allowed, and values may be wrapped in matching
+// single or double quotes.
+func parseDotenv(content []byte) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNum)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		data[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// formatValue converts a decoded value to the string stored in Vault.
+// Floats are written in plain decimal (1000000, not 1e+06) and times as
+// RFC 3339; everything else uses its default format.
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 32)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"app-secrets.enc.yaml", inputFormatYAML},
+		{"secrets.yml", inputFormatYAML},
+		{"config/app.enc.json", inputFormatJSON},
+		{"SECRETS.JSON", inputFormatJSON},
+		{"prod.env", inputFormatDotenv},
+		{"deploy/.env", inputFormatDotenv},
+		{"config.enc.toml", inputFormatTOML},
+		{"secrets", inputFormatYAML},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if result := detectFormat(tt.path); result != tt.expected {
+				t.Errorf("detectFormat(%q) = %q, expected %q", tt.path, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseDecrypted(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		content  string
+		expected map[string]interface{}
+	}{
+		{
+			name:    "yaml",
+			format:  inputFormatYAML,
+			content: "db:\n  password: p\n  port: 5432\n",
+			expected: map[string]interface{}{
+				"db": map[string]interface{}{"password": "p", "port": 5432},
+			},
+		},
+		{
+			name:    "json",
+			format:  inputFormatJSON,
+			content: `{"db": {"password": "p", "port": 5432}, "max": 1000000}`,
+			expected: map[string]interface{}{
+				"db":  map[string]interface{}{"password": "p", "port": json.Number("5432")},
+				"max": json.Number("1000000"),
+			},
+		},
+		{
+			name:    "dotenv",
+			format:  inputFormatDotenv,
+			content: "# database\nDB_PASSWORD=p=w\n\nexport API_KEY=\"k 1\"\nTOKEN='t'\nEMPTY=\n",
+			expected: map[string]interface{}{
+				"DB_PASSWORD": "p=w",
+				"API_KEY":     "k 1",
+				"TOKEN":       "t",
+				"EMPTY":       "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseDecrypted([]byte(tt.content), tt.format)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("got %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+
+	t.Run("toml", func(t *testing.T) {
+		content := `
+token = "t"
+port = 5432
+ratio = 0.5
+enabled = true
+db = { user = "u", password = "p" }
+
+[[servers]]
+name = "a"
+
+[[servers]]
+name = "b"
+`
+		result, err := parseDecrypted([]byte(content), inputFormatTOML)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := map[string]interface{}{
+			"token":   "t",
+			"port":    int64(5432),
+			"ratio":   0.5,
+			"enabled": true,
+			"db":      map[string]interface{}{"user": "u", "password": "p"},
+			"servers": []interface{}{
+				map[string]interface{}{"name": "a"},
+				map[string]interface{}{"name": "b"},
+			},
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("got %#v, expected %#v", result, expected)
+		}
+
+		flat := Flatten(result)
+		for key, want := range map[string]string{"port": "5432", "ratio": "0.5", "enabled": "true", "db.password": "p"} {
+			if got := formatValue(flat[key]); got != want {
+				t.Errorf("formatValue(%s) = %q, expected %q", key, got, want)
+			}
+		}
+	})
+
+	t.Run("invalid dotenv line", func(t *testing.T) {
+		if _, err := parseDecrypted([]byte("KEY=v\nnot a pair\n"), inputFormatDotenv); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		if _, err := parseDecrypted([]byte("{"), inputFormatJSON); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{"s", "s"},
+		{5432, "5432"},
+		{int64(9007199254740993), "9007199254740993"},
+		{1000000.0, "1000000"},
+		{0.25, "0.25"},
+		{true, "true"},
+		{time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), "2024-05-01T12:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		if result := formatValue(tt.value); result != tt.expected {
+			t.Errorf("formatValue(%#v) = %q, expected %q", tt.value, result, tt.expected)
+		}
+	}
+}
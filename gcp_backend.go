@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// gcpSecretNameSeparator joins the vault path and key in a GCP secret name,
+// since secret IDs can't contain slashes.
+const gcpSecretNameSeparator = "--"
+
+// gcpInvalidSecretChars matches characters not allowed in a GCP secret ID.
+var gcpInvalidSecretChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// gcpSecretManagerAPI is the part of the Secret Manager client
+// GCPSecretManagerBackend uses.
+type gcpSecretManagerAPI interface {
+	CreateSecret(ctx context.Context, req *secretmanagerpb.CreateSecretRequest, opts ...gax.CallOption) (*secretmanagerpb.Secret, error)
+	AddSecretVersion(ctx context.Context, req *secretmanagerpb.AddSecretVersionRequest, opts ...gax.CallOption) (*secretmanagerpb.SecretVersion, error)
+}
+
+// GCPSecretManagerBackend writes each secret to Google Cloud Secret Manager
+// as a secret named <vault-path>--<key>.
+type GCPSecretManagerBackend struct {
+	client  gcpSecretManagerAPI
+	project string
+}
+
+// NewGCPSecretManagerBackend creates a Secret Manager backend for project,
+// using Application Default Credentials (GOOGLE_APPLICATION_CREDENTIALS,
+// gcloud auth, or the metadata server).
+func NewGCPSecretManagerBackend(ctx context.Context, project string) (*GCPSecretManagerBackend, error) {
+	if project == "" {
+		return nil, fmt.Errorf("--gcp-project is required")
+	}
+	client, err := secretmanager.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("creating Secret Manager client: %w", err)
+	}
+	return &GCPSecretManagerBackend{client: client, project: project}, nil
+}
+
+// Location returns the secret ID for key: the vault path's segments and key
+// joined by "--", with any other character GCP doesn't allow (such as the
+// dots in nested keys) replaced by "_".
+func (g *GCPSecretManagerBackend) Location(basePath, key string) string {
+	name := strings.ReplaceAll(strings.Trim(basePath, "/"), "/", gcpSecretNameSeparator) + gcpSecretNameSeparator + key
+	return gcpInvalidSecretChars.ReplaceAllString(name, "_")
+}
+
+// WriteSecrets adds a new version to each key's secret, creating the secret
+// (with automatic replication) on its first write. Nothing is written if two
+// keys map to the same secret ID.
+func (g *GCPSecretManagerBackend) WriteSecrets(ctx context.Context, basePath string, keys []string, data map[string]interface{}) (int, error) {
+	origin := make(map[string]string, len(keys))
+	for _, key := range keys {
+		name := g.Location(basePath, key)
+		if prev, ok := origin[name]; ok {
+			return 0, fmt.Errorf("keys %q and %q both map to secret %s", prev, key, name)
+		}
+		origin[name] = key
+	}
+
+	written := 0
+	for _, key := range keys {
+		name := g.Location(basePath, key)
+		secret := "projects/" + g.project + "/secrets/" + name
+		version := &secretmanagerpb.AddSecretVersionRequest{
+			Parent:  secret,
+			Payload: &secretmanagerpb.SecretPayload{Data: []byte(formatValue(data[key]))},
+		}
+		_, err := g.client.AddSecretVersion(ctx, version)
+		if status.Code(err) == codes.NotFound {
+			_, err = g.client.CreateSecret(ctx, &secretmanagerpb.CreateSecretRequest{
+				Parent:   "projects/" + g.project,
+				SecretId: name,
+				Secret: &secretmanagerpb.Secret{
+					Replication: &secretmanagerpb.Replication{
+						Replication: &secretmanagerpb.Replication_Automatic_{Automatic: &secretmanagerpb.Replication_Automatic{}},
+					},
+				},
+			})
+			if err == nil {
+				_, err = g.client.AddSecretVersion(ctx, version)
+			}
+		}
+		if err != nil {
+			return written, fmt.Errorf("failed to write Secret Manager secret %s: %w", secret, err)
+		}
+		written++
+	}
+	return written, nil
+}
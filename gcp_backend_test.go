@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeGCPSecretManager stores the latest version of each secret by resource
+// name and records each call.
+type fakeGCPSecretManager struct {
+	secrets map[string]string
+	calls   []string
+}
+
+func (f *fakeGCPSecretManager) CreateSecret(ctx context.Context, req *secretmanagerpb.CreateSecretRequest, opts ...gax.CallOption) (*secretmanagerpb.Secret, error) {
+	name := req.Parent + "/secrets/" + req.SecretId
+	f.calls = append(f.calls, "create "+name)
+	f.secrets[name] = ""
+	return &secretmanagerpb.Secret{Name: name}, nil
+}
+
+func (f *fakeGCPSecretManager) AddSecretVersion(ctx context.Context, req *secretmanagerpb.AddSecretVersionRequest, opts ...gax.CallOption) (*secretmanagerpb.SecretVersion, error) {
+	f.calls = append(f.calls, "add "+req.Parent)
+	if _, ok := f.secrets[req.Parent]; !ok {
+		return nil, status.Error(codes.NotFound, "secret not found")
+	}
+	f.secrets[req.Parent] = string(req.Payload.Data)
+	return &secretmanagerpb.SecretVersion{}, nil
+}
+
+func TestGCPSecretManagerBackendWriteSecrets(t *testing.T) {
+	fake := &fakeGCPSecretManager{secrets: map[string]string{"projects/p/secrets/myapp--db_password": "old"}}
+	backend := &GCPSecretManagerBackend{client: fake, project: "p"}
+
+	data := map[string]interface{}{"db.password": "s3cr3t", "db.port": 5432}
+	written, err := backend.WriteSecrets(context.Background(), "myapp", []string{"db.password", "db.port"}, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if written != 2 {
+		t.Errorf("written = %d, expected 2", written)
+	}
+
+	expectedCalls := []string{
+		"add projects/p/secrets/myapp--db_password",
+		"add projects/p/secrets/myapp--db_port",
+		"create projects/p/secrets/myapp--db_port",
+		"add projects/p/secrets/myapp--db_port",
+	}
+	if !reflect.DeepEqual(fake.calls, expectedCalls) {
+		t.Errorf("calls = %v, expected %v", fake.calls, expectedCalls)
+	}
+	expected := map[string]string{
+		"projects/p/secrets/myapp--db_password": "s3cr3t",
+		"projects/p/secrets/myapp--db_port":     "5432",
+	}
+	if !reflect.DeepEqual(fake.secrets, expected) {
+		t.Errorf("secrets = %v, expected %v", fake.secrets, expected)
+	}
+
+	t.Run("colliding names", func(t *testing.T) {
+		fake := &fakeGCPSecretManager{secrets: map[string]string{}}
+		backend := &GCPSecretManagerBackend{client: fake, project: "p"}
+		data := map[string]interface{}{"db.pass": "a", "db_pass": "b"}
+		_, err := backend.WriteSecrets(context.Background(), "myapp", []string{"db.pass", "db_pass"}, data)
+		if err == nil || !strings.Contains(err.Error(), `"db.pass" and "db_pass"`) {
+			t.Fatalf("expected collision error, got %v", err)
+		}
+		if len(fake.calls) != 0 {
+			t.Errorf("expected no writes, got %v", fake.calls)
+		}
+	})
+}
+
+func TestGCPSecretManagerBackendLocation(t *testing.T) {
+	backend := &GCPSecretManagerBackend{project: "p"}
+	if got := backend.Location("myproject/app/", "db.password"); got != "myproject--app--db_password" {
+		t.Errorf("Location = %q, expected myproject--app--db_password", got)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// printGitHubMasks writes a GitHub Actions ::add-mask:: command for every
+// secret value so later workflow steps never print them. Each value is masked
+// both as-is (escaped per the workflow command rules) and base64-encoded,
+// which covers values containing newlines or other special characters.
+func printGitHubMasks(w io.Writer, data map[string]interface{}) {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		value := formatValue(data[k])
+		if value == "" {
+			continue
+		}
+		fmt.Fprintf(w, "::add-mask::%s\n", escapeWorkflowCommand(value))
+		fmt.Fprintf(w, "::add-mask::%s\n", base64.StdEncoding.EncodeToString([]byte(value)))
+	}
+}
+
+// escapeWorkflowCommand escapes a value for use in a GitHub Actions workflow command.
+func escapeWorkflowCommand(s string) string {
+	s = strings.ReplaceAll(s, "%", "%25")
+	s = strings.ReplaceAll(s, "\r", "%0D")
+	s = strings.ReplaceAll(s, "\n", "%0A")
+	return s
+}
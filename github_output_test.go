@@ -0,0 +1,28 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrintGitHubMasks(t *testing.T) {
+	data := map[string]interface{}{
+		"db.password": "s3cr3t",
+		"api.key":     "line1\nline2%",
+		"port":        5432,
+		"empty":       "",
+	}
+
+	var buf strings.Builder
+	printGitHubMasks(&buf, data)
+
+	expected := "::add-mask::line1%0Aline2%25\n" +
+		"::add-mask::bGluZTEKbGluZTIl\n" +
+		"::add-mask::s3cr3t\n" +
+		"::add-mask::czNjcjN0\n" +
+		"::add-mask::5432\n" +
+		"::add-mask::NTQzMg==\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// formatHelmSecrets is the --output-format that prints a Helm values file
+// referencing the secrets written, for the helm-secrets plugin.
+const formatHelmSecrets = "helm-secrets"
+
+// helmSecretRef builds a helm-secrets reference to field of the secret at
+// fullPath (with the mount). Unlike a vals reference (vaultRefField) it has
+// no scheme.
+func helmSecretRef(fullPath, field string) string {
+	return "secretref:vault:" + fullPath + "#" + field
+}
+
+// printHelmSecretsValues writes a values.yaml with the reference returned by
+// refFor in place of each of keys, nested again on sep (with sequences
+// restored if arrays is set). With release, the values are nested under that
+// key, as a parent chart sets a subchart's values.
+func printHelmSecretsValues(w io.Writer, keys []string, refFor func(key string) string, sep string, arrays bool, release string) error {
+	refs := make(map[string]interface{}, len(keys))
+	for _, k := range keys {
+		refs[k] = refFor(k)
+	}
+	unflatten := Unflatten
+	if arrays {
+		unflatten = UnflattenArrays
+	}
+	values := unflatten(refs, sep)
+	if release != "" {
+		values = map[string]interface{}{release: values}
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(values); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrintHelmSecretsValues(t *testing.T) {
+	refFor := func(key string) string {
+		return helmSecretRef("secret/myproject/"+key, "value")
+	}
+
+	var buf strings.Builder
+	if err := printHelmSecretsValues(&buf, []string{"db.password", "token"}, refFor, ".", false, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "db:\n" +
+		"  password: secretref:vault:secret/myproject/db.password#value\n" +
+		"token: secretref:vault:secret/myproject/token#value\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	t.Run("release name", func(t *testing.T) {
+		var buf strings.Builder
+		if err := printHelmSecretsValues(&buf, []string{"token"}, refFor, ".", false, "myapp"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := "myapp:\n  token: secretref:vault:secret/myproject/token#value\n"
+		if buf.String() != expected {
+			t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", buf.String(), expected)
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// infisicalDefaultAPIURL is the Infisical Cloud base URL. Self-hosted
+// instances are selected with --infisical-url.
+const infisicalDefaultAPIURL = "https://app.infisical.com"
+
+// Secret is a single secret in an Infisical batch write.
+type Secret struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Type  string `json:"type"`
+}
+
+// InfisicalClient is a minimal client for the Infisical API.
+type InfisicalClient struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+}
+
+// NewInfisicalClient creates a client authenticating with an Infisical
+// service token or machine identity access token.
+func NewInfisicalClient(baseURL, token string) *InfisicalClient {
+	return &InfisicalClient{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+	}
+}
+
+// BatchWrite creates or updates secrets in a workspace environment in one
+// request.
+func (c *InfisicalClient) BatchWrite(workspaceID, env string, secrets []Secret) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"workspaceId": workspaceID,
+		"environment": env,
+		"secrets":     secrets,
+	})
+	if err != nil {
+		return fmt.Errorf("marshaling request: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+"/api/v1/secrets/batch", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to write Infisical secrets to %s/%s: %w", workspaceID, env, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var errResp struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return fmt.Errorf("failed to write Infisical secrets to %s/%s: %s: %s",
+			workspaceID, env, resp.Status, errResp.Message)
+	}
+	return nil
+}
+
+// InfisicalBackend writes secrets to an Infisical workspace environment.
+type InfisicalBackend struct {
+	client      *InfisicalClient
+	workspaceID string
+	environment string
+}
+
+// NewInfisicalBackend creates an Infisical backend.
+func NewInfisicalBackend(baseURL, workspaceID, environment, token string) (*InfisicalBackend, error) {
+	if workspaceID == "" {
+		return nil, fmt.Errorf("--infisical-workspace-id is required")
+	}
+	if environment == "" {
+		return nil, fmt.Errorf("--infisical-environment is required")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("Infisical token required (--infisical-token or INFISICAL_TOKEN)")
+	}
+	return &InfisicalBackend{
+		client:      NewInfisicalClient(baseURL, token),
+		workspaceID: workspaceID,
+		environment: environment,
+	}, nil
+}
+
+// Location returns <workspace-id>/<environment>/<NAME> for key.
+func (b *InfisicalBackend) Location(basePath, key string) string {
+	return b.workspaceID + "/" + b.environment + "/" + envVarName(key)
+}
+
+// WriteSecrets writes all keys as shared secrets in a single batch request,
+// so either every secret is written or none are.
+func (b *InfisicalBackend) WriteSecrets(ctx context.Context, basePath string, keys []string, data map[string]interface{}) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, errInterrupted
+	}
+
+	secrets := make([]Secret, 0, len(keys))
+	origin := make(map[string]string, len(keys))
+	for _, key := range keys {
+		name := envVarName(key)
+		if prev, ok := origin[name]; ok {
+			return 0, fmt.Errorf("keys %q and %q both map to secret %s", prev, key, name)
+		}
+		origin[name] = key
+		secrets = append(secrets, Secret{Key: name, Value: formatValue(data[key]), Type: "shared"})
+	}
+
+	if err := b.client.BatchWrite(b.workspaceID, b.environment, secrets); err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInfisicalBackendWriteSecrets(t *testing.T) {
+	var gotAuth, gotPath string
+	var gotBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotPath = r.Method + " " + r.URL.Path
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		writeJSON(w, map[string]interface{}{"secrets": []interface{}{}})
+	}))
+	defer server.Close()
+
+	backend, err := NewInfisicalBackend(server.URL, "ws-123", "prod", "st.test")
+	if err != nil {
+		t.Fatalf("NewInfisicalBackend: %v", err)
+	}
+	data := map[string]interface{}{"db.password": "s3cr3t", "db.port": 5432}
+	written, err := backend.WriteSecrets(context.Background(), "myapp", []string{"db.password", "db.port"}, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if written != 2 {
+		t.Errorf("written = %d, expected 2", written)
+	}
+	if gotPath != "POST /api/v1/secrets/batch" {
+		t.Errorf("request = %s", gotPath)
+	}
+	if gotAuth != "Bearer st.test" {
+		t.Errorf("Authorization = %q", gotAuth)
+	}
+	expected := map[string]interface{}{
+		"workspaceId": "ws-123",
+		"environment": "prod",
+		"secrets": []interface{}{
+			map[string]interface{}{"key": "DB_PASSWORD", "value": "s3cr3t", "type": "shared"},
+			map[string]interface{}{"key": "DB_PORT", "value": "5432", "type": "shared"},
+		},
+	}
+	if !reflect.DeepEqual(gotBody, expected) {
+		t.Errorf("body = %v, expected %v", gotBody, expected)
+	}
+	if loc := backend.Location("myapp", "db.password"); loc != "ws-123/prod/DB_PASSWORD" {
+		t.Errorf("Location = %q", loc)
+	}
+
+	t.Run("api error", func(t *testing.T) {
+		server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			writeJSON(w, map[string]interface{}{"message": "You are not allowed to access this resource"})
+		})
+		if _, err := backend.WriteSecrets(context.Background(), "myapp", []string{"db.password"}, data); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("missing workspace", func(t *testing.T) {
+		if _, err := NewInfisicalBackend(server.URL, "", "prod", "st.test"); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		if _, err := NewInfisicalBackend(server.URL, "ws-123", "prod", ""); err == nil || !strings.Contains(err.Error(), "token required") {
+			t.Fatalf("NewInfisicalBackend: expected missing token error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Modes for --transform-keys.
+const (
+	transformNone       = "none"
+	transformSnake      = "snake"
+	transformUpperSnake = "upper_snake"
+	transformCamel      = "camel"
+	transformKebab      = "kebab"
+)
+
+// validTransform reports whether mode is a supported --transform-keys value.
+func validTransform(mode string) bool {
+	switch mode {
+	case transformNone, transformSnake, transformUpperSnake, transformCamel, transformKebab:
+		return true
+	}
+	return false
+}
+
+// Modes for --validate-keys.
+const (
+	validateStrict = "strict"
+	validateVault  = "vault"
+	validateCustom = "custom"
+)
+
+// strictKeyPattern is the character set --validate-keys=strict allows.
+var strictKeyPattern = regexp.MustCompile(`^[a-z0-9._-]+$`)
+
+// validKeyValidation reports whether mode is a supported --validate-keys
+// value.
+func validKeyValidation(mode string) bool {
+	switch mode {
+	case validateStrict, validateVault, validateCustom:
+		return true
+	}
+	return false
+}
+
+// keyProblem returns why key fails mode (with pattern for custom), or "" if
+// it is valid.
+func keyProblem(key, mode string, pattern *regexp.Regexp) string {
+	switch mode {
+	case validateStrict:
+		if !strictKeyPattern.MatchString(key) {
+			return "only lowercase letters, digits, '-', '_', and '.' are allowed"
+		}
+	case validateVault:
+		return vaultPathProblem(key)
+	case validateCustom:
+		if !pattern.MatchString(key) {
+			return "does not match " + pattern.String()
+		}
+	}
+	return ""
+}
+
+// vaultPathProblem returns why key can't safely be used as (part of) a Vault
+// path, or "" if it can. Empty, "." and ".." segments are rejected or
+// rewritten by Vault; "+" and "*" are wildcards in policy paths; and
+// whitespace, control characters, "#", "?", and "%" get mangled in API URLs.
+func vaultPathProblem(key string) string {
+	for _, segment := range strings.Split(key, "/") {
+		switch segment {
+		case "":
+			return "empty path segment"
+		case ".", "..":
+			return fmt.Sprintf("%q path segment", segment)
+		}
+	}
+	for _, r := range key {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || strings.ContainsRune("#?%+*", r) {
+			return fmt.Sprintf("character %q is not allowed in Vault paths", r)
+		}
+	}
+	return ""
+}
+
+// validateKeys checks every key in data against mode and returns an error
+// listing all the keys that fail, so they can be fixed in one go.
+func validateKeys(data map[string]interface{}, mode string, pattern *regexp.Regexp) error {
+	var problems []string
+	for k := range data {
+		if problem := keyProblem(k, mode, pattern); problem != "" {
+			problems = append(problems, fmt.Sprintf("  %s: %s", k, problem))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("%d keys fail --validate-keys=%s:\n%s", len(problems), mode, strings.Join(problems, "\n"))
+}
+
+// transformKey applies mode to each sep-separated segment of key, so nesting
+// is kept: with snake, "admin.oauth2.clientID" becomes "admin.oauth2.client_id".
+func transformKey(key, mode, sep string) string {
+	if mode == transformNone || mode == "" {
+		return key
+	}
+	segments := strings.Split(key, sep)
+	for i, segment := range segments {
+		segments[i] = transformSegment(segment, mode)
+	}
+	return strings.Join(segments, sep)
+}
+
+func transformSegment(segment, mode string) string {
+	words := splitWords(segment)
+	if len(words) == 0 {
+		return segment
+	}
+	switch mode {
+	case transformSnake:
+		return strings.ToLower(strings.Join(words, "_"))
+	case transformUpperSnake:
+		return strings.ToUpper(strings.Join(words, "_"))
+	case transformKebab:
+		return strings.ToLower(strings.Join(words, "-"))
+	case transformCamel:
+		var b strings.Builder
+		b.WriteString(strings.ToLower(words[0]))
+		for _, w := range words[1:] {
+			first, size := utf8.DecodeRuneInString(w)
+			b.WriteRune(unicode.ToUpper(first))
+			b.WriteString(strings.ToLower(w[size:]))
+		}
+		return b.String()
+	}
+	return segment
+}
+
+// splitWords splits a name into words at underscores, hyphens, spaces, and
+// case changes: "clientID" -> [client ID], "HTTPServer_url" -> [HTTP Server url].
+// Digits stay with the word before them, as in "oauth2".
+func splitWords(s string) []string {
+	var words []string
+	var word []rune
+	runes := []rune(s)
+	for i, r := range runes {
+		if r == '_' || r == '-' || unicode.IsSpace(r) {
+			if len(word) > 0 {
+				words = append(words, string(word))
+				word = nil
+			}
+			continue
+		}
+		if unicode.IsUpper(r) && len(word) > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				words = append(words, string(word))
+				word = nil
+			}
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+// transformKeys applies transformKey to every key in data. It returns the
+// transformed data and the previous name of each key that changed. Two keys
+// that would end up with the same name are an error.
+func transformKeys(data map[string]interface{}, mode, sep string) (map[string]interface{}, map[string]string, error) {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make(map[string]interface{}, len(data))
+	from := make(map[string]string, len(data))
+	renamed := make(map[string]string)
+	for _, k := range keys {
+		name := transformKey(k, mode, sep)
+		if prev, dup := from[name]; dup {
+			return nil, nil, fmt.Errorf("keys %s and %s both become %s with --transform-keys=%s", prev, k, name, mode)
+		}
+		from[name] = k
+		result[name] = data[k]
+		if name != k {
+			renamed[name] = k
+		}
+	}
+	return result, renamed, nil
+}
+
+// lowercaseKeys lowercases every key in data for --path-lowercase. It returns
+// the new data, the previous name of each key that changed, and a warning
+// for each key dropped because its lowercased name was already taken. A key
+// that is already lowercase wins over the keys that lowercase to it.
+func lowercaseKeys(data map[string]interface{}) (map[string]interface{}, map[string]string, []string) {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		iLower, jLower := keys[i] == strings.ToLower(keys[i]), keys[j] == strings.ToLower(keys[j])
+		if iLower != jLower {
+			return iLower
+		}
+		return keys[i] < keys[j]
+	})
+
+	result := make(map[string]interface{}, len(data))
+	from := make(map[string]string, len(data))
+	renamed := make(map[string]string)
+	var warnings []string
+	for _, k := range keys {
+		name := strings.ToLower(k)
+		if prev, dup := from[name]; dup {
+			warnings = append(warnings, fmt.Sprintf("Key '%s' collides with '%s' when lowercased, skipping it", k, prev))
+			continue
+		}
+		from[name] = k
+		result[name] = data[k]
+		if name != k {
+			renamed[name] = k
+		}
+	}
+	return result, renamed, warnings
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTransformKey(t *testing.T) {
+	tests := []struct {
+		key      string
+		mode     string
+		expected string
+	}{
+		{"admin.oauth2.clientID", transformNone, "admin.oauth2.clientID"},
+
+		{"admin.oauth2.clientID", transformSnake, "admin.oauth2.client_id"},
+		{"db.HTTPServer-url", transformSnake, "db.http_server_url"},
+		{"api_key", transformSnake, "api_key"},
+
+		{"admin.oauth2.clientID", transformUpperSnake, "ADMIN.OAUTH2.CLIENT_ID"},
+		{"db.max-connections", transformUpperSnake, "DB.MAX_CONNECTIONS"},
+
+		{"db.max_connections", transformCamel, "db.maxConnections"},
+		{"db.HTTPServer-url", transformCamel, "db.httpServerUrl"},
+		{"API_KEY", transformCamel, "apiKey"},
+		{"dessert_éclair_crème", transformCamel, "dessertÉclairCrème"},
+
+		{"admin.oauth2.clientID", transformKebab, "admin.oauth2.client-id"},
+		{"db.max_connections", transformKebab, "db.max-connections"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode+"/"+tt.key, func(t *testing.T) {
+			if result := transformKey(tt.key, tt.mode, "."); result != tt.expected {
+				t.Errorf("transformKey(%q, %q) = %q, expected %q", tt.key, tt.mode, result, tt.expected)
+			}
+		})
+	}
+
+	t.Run("custom separator", func(t *testing.T) {
+		if result := transformKey("db__maxConns", transformSnake, "__"); result != "db__max_conns" {
+			t.Errorf("got %q, expected db__max_conns", result)
+		}
+	})
+}
+
+func TestTransformKeys(t *testing.T) {
+	data := map[string]interface{}{"db.userName": "u", "token": "t"}
+	result, renamed, err := transformKeys(data, transformSnake, ".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := map[string]interface{}{"db.user_name": "u", "token": "t"}; !reflect.DeepEqual(result, expected) {
+		t.Errorf("result = %v, expected %v", result, expected)
+	}
+	if expected := map[string]string{"db.user_name": "db.userName"}; !reflect.DeepEqual(renamed, expected) {
+		t.Errorf("renamed = %v, expected %v", renamed, expected)
+	}
+
+	t.Run("clash", func(t *testing.T) {
+		data := map[string]interface{}{"db.userName": "u", "db.user_name": "v"}
+		if _, _, err := transformKeys(data, transformSnake, "."); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestValidateKeys(t *testing.T) {
+	tests := []struct {
+		mode    string
+		pattern string
+		key     string
+		valid   bool
+	}{
+		{validateStrict, "", "db.max-conns_2", true},
+		{validateStrict, "", "db.userName", false},
+		{validateStrict, "", "db/password", false},
+		{validateVault, "", "db/userName.v2", true},
+		{validateVault, "", "db//password", false},
+		{validateVault, "", "db/../password", false},
+		{validateVault, "", "api key", false},
+		{validateVault, "", "tokens.*", false},
+		{validateVault, "", "a?b", false},
+		{validateCustom, `^[A-Z_]+$`, "DB_PASSWORD", true},
+		{validateCustom, `^[A-Z_]+$`, "db.password", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+"/"+tt.key, func(t *testing.T) {
+			var pattern *regexp.Regexp
+			if tt.pattern != "" {
+				pattern = regexp.MustCompile(tt.pattern)
+			}
+			err := validateKeys(map[string]interface{}{tt.key: "v"}, tt.mode, pattern)
+			if tt.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+
+	t.Run("lists every invalid key", func(t *testing.T) {
+		data := map[string]interface{}{"B": 1, "ok": 2, "A": 3}
+		err := validateKeys(data, validateStrict, nil)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if !strings.Contains(err.Error(), "2 keys") || !strings.Contains(err.Error(), "  A: ") || !strings.Contains(err.Error(), "  B: ") {
+			t.Errorf("error should list A and B, got %v", err)
+		}
+	})
+}
+
+func TestLowercaseKeys(t *testing.T) {
+	data := map[string]interface{}{"db.maxConns": 1, "DB.Password": "p", "db.password": "q", "Token": "t"}
+	result, renamed, warnings := lowercaseKeys(data)
+
+	if expected := map[string]interface{}{"db.maxconns": 1, "db.password": "q", "token": "t"}; !reflect.DeepEqual(result, expected) {
+		t.Errorf("result = %v, expected %v", result, expected)
+	}
+	if expected := map[string]string{"db.maxconns": "db.maxConns", "token": "Token"}; !reflect.DeepEqual(renamed, expected) {
+		t.Errorf("renamed = %v, expected %v", renamed, expected)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "DB.Password") {
+		t.Errorf("warnings = %v, expected one for DB.Password", warnings)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// runKubectl executes kubectl with args, feeding it stdin, and returns its
+// stdout. It is a variable so tests can substitute a fake executor.
+var runKubectl = func(stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("kubectl", args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("kubectl %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// k8sMaxDataKey is the longest Secret data key Kubernetes accepts.
+const k8sMaxDataKey = 253
+
+// k8sValidDataKey matches the characters Kubernetes allows in a Secret data
+// key.
+var k8sValidDataKey = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// validK8sDataKey returns an error if key can't be a Secret data key, so a
+// manifest kubectl would reject is never generated.
+func validK8sDataKey(key string) error {
+	switch {
+	case !k8sValidDataKey.MatchString(key):
+		return fmt.Errorf("key %q isn't a valid Secret data key: only letters, digits, '-', '_', and '.' are allowed (rename it with --key-rename-map or choose another --separator)", key)
+	case len(key) > k8sMaxDataKey:
+		return fmt.Errorf("key %q is longer than the %d characters a Secret data key allows", key, k8sMaxDataKey)
+	case key == "." || key == ".." || strings.HasPrefix(key, ".."):
+		return fmt.Errorf("key %q isn't a valid Secret data key: it can't be '.' or start with '..'", key)
+	}
+	return nil
+}
+
+// k8sSecret is the subset of a v1 Secret manifest that gets generated.
+type k8sSecret struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   k8sObjectMeta     `yaml:"metadata"`
+	Type       string            `yaml:"type"`
+	Data       map[string]string `yaml:"data"`
+}
+
+type k8sObjectMeta struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// KubernetesBackend generates a Kubernetes Secret manifest holding every
+// key, writing it to a file or stdout and optionally applying it with
+// kubectl.
+type KubernetesBackend struct {
+	namespace  string
+	name       string
+	outputFile string
+	apply      bool
+}
+
+// NewKubernetesBackend creates a Kubernetes backend. If name is empty, the
+// Secret is named after the <vault-path> argument. The manifest is written
+// to outputFile, or to stdout unless apply is set.
+func NewKubernetesBackend(namespace, name, outputFile string, apply bool) *KubernetesBackend {
+	return &KubernetesBackend{namespace: namespace, name: name, outputFile: outputFile, apply: apply}
+}
+
+// secretName returns the Secret's name: --k8s-secret-name, or basePath
+// lowercased with slashes as dashes ("myproject/App" -> "myproject-app").
+func (k *KubernetesBackend) secretName(basePath string) string {
+	if k.name != "" {
+		return k.name
+	}
+	return strings.ToLower(strings.ReplaceAll(strings.Trim(basePath, "/"), "/", "-"))
+}
+
+// Location returns the Secret and data key for key, e.g.
+// "default/app[db.password]".
+func (k *KubernetesBackend) Location(basePath, key string) string {
+	name := k.secretName(basePath)
+	if k.namespace != "" {
+		name = k.namespace + "/" + name
+	}
+	return name + "[" + key + "]"
+}
+
+// Manifest returns the Secret manifest for keys, with values base64-encoded.
+// Keys that aren't valid Secret data keys are rejected.
+func (k *KubernetesBackend) Manifest(basePath string, keys []string, data map[string]interface{}) ([]byte, error) {
+	secret := k8sSecret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata:   k8sObjectMeta{Name: k.secretName(basePath), Namespace: k.namespace},
+		Type:       "Opaque",
+		Data:       make(map[string]string, len(keys)),
+	}
+	for _, key := range keys {
+		if err := validK8sDataKey(key); err != nil {
+			return nil, err
+		}
+		secret.Data[key] = base64.StdEncoding.EncodeToString([]byte(formatValue(data[key])))
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(secret); err != nil {
+		return nil, fmt.Errorf("marshaling Secret manifest: %w", err)
+	}
+	enc.Close()
+	return buf.Bytes(), nil
+}
+
+// WriteSecrets writes the Secret manifest and, with apply, applies it.
+func (k *KubernetesBackend) WriteSecrets(ctx context.Context, basePath string, keys []string, data map[string]interface{}) (int, error) {
+	manifest, err := k.Manifest(basePath, keys, data)
+	if err != nil {
+		return 0, err
+	}
+
+	if k.outputFile != "" || !k.apply {
+		out, err := openOutput(k.outputFile)
+		if err != nil {
+			return 0, fmt.Errorf("opening output file: %w", err)
+		}
+		_, err = out.Write(manifest)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return 0, fmt.Errorf("writing Secret manifest: %w", err)
+		}
+	}
+
+	if k.apply {
+		if _, err := runKubectl(manifest, "apply", "-f", "-"); err != nil {
+			return 0, fmt.Errorf("applying Secret %s: %w", k.secretName(basePath), err)
+		}
+	}
+	return len(keys), nil
+}
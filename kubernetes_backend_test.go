@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKubernetesBackendManifest(t *testing.T) {
+	backend := NewKubernetesBackend("prod", "", "", false)
+	data := map[string]interface{}{"db.password": "s3cr3t", "db.port": 5432}
+
+	got, err := backend.Manifest("myproject/App", []string{"db.password", "db.port"}, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `apiVersion: v1
+kind: Secret
+metadata:
+  name: myproject-app
+  namespace: prod
+type: Opaque
+data:
+  db.password: czNjcjN0
+  db.port: NTQzMg==
+`
+	if string(got) != expected {
+		t.Errorf("manifest:\ngot:\n%s\nexpected:\n%s", got, expected)
+	}
+	if loc := backend.Location("myproject/App", "db.port"); loc != "prod/myproject-app[db.port]" {
+		t.Errorf("Location = %q", loc)
+	}
+}
+
+func TestKubernetesBackendManifestInvalidKeys(t *testing.T) {
+	backend := NewKubernetesBackend("", "app", "", false)
+	for _, key := range []string{"db/password", "db password", "..hidden", ".", strings.Repeat("k", k8sMaxDataKey+1)} {
+		t.Run(key, func(t *testing.T) {
+			if _, err := backend.Manifest("myproject", []string{key}, map[string]interface{}{key: "v"}); err == nil {
+				t.Errorf("expected error for key %q", key)
+			}
+		})
+	}
+}
+
+func TestKubernetesBackendWriteSecrets(t *testing.T) {
+	data := map[string]interface{}{"token": "t"}
+
+	t.Run("output file", func(t *testing.T) {
+		outputFile := filepath.Join(t.TempDir(), "secret.yaml")
+		backend := NewKubernetesBackend("", "app", outputFile, false)
+		if _, err := backend.WriteSecrets(context.Background(), "myproject", []string{"token"}, data); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		content, _ := os.ReadFile(outputFile)
+		expected, _ := backend.Manifest("myproject", []string{"token"}, data)
+		if string(content) != string(expected) {
+			t.Errorf("output file:\n%s\nexpected:\n%s", content, expected)
+		}
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		var gotArgs []string
+		var gotStdin []byte
+		orig := runKubectl
+		runKubectl = func(stdin []byte, args ...string) ([]byte, error) {
+			gotArgs, gotStdin = args, stdin
+			return nil, nil
+		}
+		t.Cleanup(func() { runKubectl = orig })
+
+		backend := NewKubernetesBackend("", "app", "", true)
+		written, err := backend.WriteSecrets(context.Background(), "myproject", []string{"token"}, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if written != 1 {
+			t.Errorf("written = %d, expected 1", written)
+		}
+		if !reflect.DeepEqual(gotArgs, []string{"apply", "-f", "-"}) {
+			t.Errorf("kubectl args = %v", gotArgs)
+		}
+		expected, _ := backend.Manifest("myproject", []string{"token"}, data)
+		if string(gotStdin) != string(expected) {
+			t.Errorf("kubectl stdin:\n%s\nexpected:\n%s", gotStdin, expected)
+		}
+	})
+}
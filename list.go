@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// listEntry is one name under a listed Vault path.
+type listEntry struct {
+	Key         string `json:"key"`
+	Version     int    `json:"version,omitempty"`
+	UpdatedTime string `json:"updated_time,omitempty"`
+}
+
+// listSecrets lists the names under path. With versions, the current version
+// and update time of each secret (not sub-path) are looked up as well.
+func listSecrets(client *VaultClient, path string, versions bool) ([]listEntry, error) {
+	keys, err := client.ListKV(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]listEntry, 0, len(keys))
+	for _, k := range keys {
+		entry := listEntry{Key: k}
+		if versions && !strings.HasSuffix(k, "/") {
+			metadata, err := client.ReadKVMetadata(strings.TrimSuffix(path, "/") + "/" + k)
+			if err != nil {
+				return nil, err
+			}
+			if metadata != nil {
+				entry.Version = metadata.CurrentVersion
+				if !metadata.UpdatedTime.IsZero() {
+					entry.UpdatedTime = metadata.UpdatedTime.Format(time.RFC3339)
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// printList writes the entries of a --list run as text or JSON.
+func printList(w io.Writer, format, mount, path string, entries []listEntry) error {
+	if format == formatJSON {
+		return json.NewEncoder(w).Encode(struct {
+			Mount string      `json:"mount"`
+			Path  string      `json:"path"`
+			Keys  []listEntry `json:"keys"`
+		}{mount, path, entries})
+	}
+
+	fmt.Fprintf(w, "%d entries under %s/%s:\n", len(entries), mount, path)
+	for _, e := range entries {
+		if e.Version > 0 {
+			fmt.Fprintf(w, "  %s (version %d, updated %s)\n", e.Key, e.Version, e.UpdatedTime)
+		} else {
+			fmt.Fprintf(w, "  %s\n", e.Key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListSecrets(t *testing.T) {
+	mv := newMockVault(t)
+	var gotQuery string
+	mv.handle("GET", "/v1/secret/metadata/app", func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		writeJSON(w, map[string]interface{}{"data": map[string]interface{}{
+			"keys": []string{"db.password", "db/", "token"},
+		}})
+	})
+	mv.handle("GET", "/v1/secret/metadata/app/db.password", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"data": map[string]interface{}{
+			"current_version": 3,
+			"updated_time":    "2025-03-01T10:00:00.123Z",
+		}})
+	})
+	mv.handle("GET", "/v1/secret/metadata/app/token", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"data": map[string]interface{}{"current_version": 1}})
+	})
+	client := mv.client(t, "secret")
+
+	entries, err := listSecrets(client, "app", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotQuery != "list=true" {
+		t.Errorf("query = %q, expected list=true", gotQuery)
+	}
+	expected := []listEntry{{Key: "db.password"}, {Key: "db/"}, {Key: "token"}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("entries = %+v, expected %+v", entries, expected)
+	}
+
+	entries, err = listSecrets(client, "app", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = []listEntry{
+		{Key: "db.password", Version: 3, UpdatedTime: "2025-03-01T10:00:00Z"},
+		{Key: "db/"},
+		{Key: "token", Version: 1},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("entries = %+v, expected %+v", entries, expected)
+	}
+
+	t.Run("missing path", func(t *testing.T) {
+		entries, err := listSecrets(client, "nothing", false)
+		if err != nil || len(entries) != 0 {
+			t.Errorf("got (%v, %v), expected no entries", entries, err)
+		}
+	})
+}
+
+func TestPrintList(t *testing.T) {
+	entries := []listEntry{{Key: "db.password", Version: 3, UpdatedTime: "2025-03-01T10:00:00Z"}, {Key: "db/"}}
+
+	var text strings.Builder
+	printList(&text, formatText, "secret", "app", entries)
+	expected := "2 entries under secret/app:\n" +
+		"  db.password (version 3, updated 2025-03-01T10:00:00Z)\n" +
+		"  db/\n"
+	if text.String() != expected {
+		t.Errorf("text output:\n%s\nexpected:\n%s", text.String(), expected)
+	}
+
+	var js strings.Builder
+	printList(&js, formatJSON, "secret", "app", entries)
+	expectedJSON := `{"mount":"secret","path":"app","keys":[{"key":"db.password","version":3,"updated_time":"2025-03-01T10:00:00Z"},{"key":"db/"}]}` + "\n"
+	if js.String() != expectedJSON {
+		t.Errorf("JSON output = %s, expected %s", js.String(), expectedJSON)
+	}
+}
@@ -1,145 +1,2224 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/getsops/sops/v3/decrypt"
+	"github.com/hashicorp/vault/api"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/yaml.v3"
 )
 
+// Config holds the options that apply to every SOPS file processed in a run.
+type Config struct {
+	VaultAddr            string
+	VaultToken           string
+	VaultNamespace       string
+	VaultCACert          string
+	VaultClientCert      string
+	VaultClientKey       string
+	VaultSkipVerify      bool
+	Mount                string
+	DryRun               bool
+	AppendName           bool
+	NameOverride         string
+	UpdateCounterpart    bool
+	ShowTokenExpiry      bool
+	MinTokenTTL          time.Duration
+	DeprecationFile      string
+	DeprecationRename    bool
+	GitHubMask           bool
+	ExportEnv            bool
+	OutputFile           string
+	ExistsStrategy       string
+	SopsFileHash         string
+	CompareHash          bool
+	SplitTopLevel        bool
+	EncryptedJSON        string
+	CounterpartFormat    string
+	RollbackOnError      bool
+	Atomic               bool
+	KeyOrderingFile      string
+	ForceRecreate        bool
+	OutputFormat         string
+	MaskValueLength      string
+	HelmReleaseName      string
+	MarkdownTitle        string
+	Backend              string
+	ChamberService       string
+	ChamberKMSKeyAlias   string
+	PartialUpdateKeys    []string
+	KeyFilter            *regexp.Regexp
+	KeyExclude           *regexp.Regexp
+	CDKContextFile       string
+	CDKContextKey        string
+	DopplerProject       string
+	DopplerConfig        string
+	DopplerToken         string
+	InfisicalURL         string
+	InfisicalWorkspaceID string
+	InfisicalEnvironment string
+	InfisicalToken       string
+	GCPProject           string
+	AzureKeyVaultURL     string
+	OnePasswordHost      string
+	OnePasswordToken     string
+	ConsulAddr           string
+	ConsulToken          string
+	K8sNamespace         string
+	K8sSecretName        string
+	K8sApply             bool
+	KVVersion            int
+	Parallelism          int
+	Format               string
+	RetryAttempts        int
+	RetryInitialDelay    time.Duration
+	Bundle               bool
+	ReadVerify           bool
+	Delete               bool
+	Strict               bool
+	Separator            string
+	PrefixStrip          string
+	KeyRenameFile        string
+	AgeKeyFile           string
+	IgnoreMissingSopsKey bool
+	TransformKeys        string
+	PathLowercase        bool
+	ValidateKeys         string
+	KeyPattern           *regexp.Regexp
+	Sync                 bool
+	IncludeSopsMetadata  bool
+	MaxDepth             int
+	Routing              *routingConfig
+	PathTemplate         *template.Template
+	Env                  string
+	RotateKeys           []string
+	RotateLength         int
+	RotateCharset        string
+	StripSuffixes        []string
+	Progress             bool
+	BackupFile           string
+	Tags                 map[string]string
+	Overrides            map[string]string
+	Verbose              bool
+	FlattenArrays        bool
+	JSONEncodeComplex    bool
+	ValueTemplate        *template.Template
+	VaultKeyName         string
+	PolicyFile           string
+	Diff                 bool
+	VerifyOnly           bool
+	CAS                  bool
+	// AuditLog, if set, records every Vault write attempted (or skipped by
+	// dry-run). It is shared by all files in a run.
+	AuditLog *auditLog
+	// TokenSink, if set, is the Vault Agent sink the token is read from.
+	// Clients from newVaultClient follow its token.
+	TokenSink *tokenSink
+}
+
+// addTags adds tags to the custom metadata set on each secret written, for
+// --tags and --label. Later values for a key win.
+func (c *Config) addTags(tags map[string]string) {
+	if c.Tags == nil {
+		c.Tags = make(map[string]string)
+	}
+	for k, v := range tags {
+		c.Tags[k] = v
+	}
+}
+
+// tlsSkipVerifyWarning is printed when --vault-tls-skip-verify or
+// VAULT_SKIP_VERIFY is in effect, so it isn't left on by accident.
+const tlsSkipVerifyWarning = `
+******************************************************************
+* WARNING: TLS verification is disabled
+* The Vault server's certificate is not checked, so anyone on the
+* network path can read or alter the secrets sent. Outside of
+* development, use --vault-tls-ca-cert instead.
+******************************************************************
+
+`
+
+// vaultConn returns how to reach Vault. TLS settings are only included when
+// a TLS flag was given, so VAULT_CACERT and friends apply otherwise.
+// VAULT_SKIP_VERIFY is resolved into VaultSkipVerify beforehand, so it still
+// applies alongside the TLS flags.
+func (c Config) vaultConn() vaultConn {
+	conn := vaultConn{Addr: c.VaultAddr, Namespace: c.VaultNamespace}
+	if c.Verbose {
+		conn.Log = os.Stderr
+	}
+	if c.VaultCACert != "" || c.VaultClientCert != "" || c.VaultClientKey != "" || c.VaultSkipVerify {
+		conn.TLS = &api.TLSConfig{
+			CACert:     c.VaultCACert,
+			ClientCert: c.VaultClientCert,
+			ClientKey:  c.VaultClientKey,
+			Insecure:   c.VaultSkipVerify,
+		}
+	}
+	return conn
+}
+
+// newVaultClient creates a Vault client for the configured server, token,
+// and mount, following the token sink if there is one.
+func (c Config) newVaultClient() (*VaultClient, error) {
+	client, err := NewVaultClient(c.vaultConn(), c.VaultToken, c.Mount, c.KVVersion)
+	if err != nil {
+		return nil, err
+	}
+	c.TokenSink.attach(client)
+	return client, nil
+}
+
+// envPath prefixes vaultPath with the --env name, if any: prod and
+// myproject give prod/myproject.
+func (c Config) envPath(vaultPath string) string {
+	if c.Env == "" {
+		return vaultPath
+	}
+	return strings.Trim(c.Env, "/") + "/" + vaultPath
+}
+
+// decryptData decrypts SOPS-encrypted content. It is a variable so tests can
+// run the pipeline without real key material.
+var decryptData = decrypt.Data
+
 func main() {
 	var (
-		vaultAddr         = flag.String("vault-addr", "", "Vault server address (env: VAULT_ADDR)")
-		vaultToken        = flag.String("vault-token", "", "Vault token (env: VAULT_TOKEN, VAULT_TOKEN_FILE)")
-		mountPath         = flag.String("mount", "secret", "Vault KV v2 mount path")
-		dryRun            = flag.Bool("dry-run", false, "Print secrets without writing to Vault")
-		appendName        = flag.Bool("append-name", false, "Append cleaned filename to vault path")
-		nameOverride      = flag.String("name", "", "Override the derived name (use with --append-name)")
-		updateCounterpart = flag.Bool("update-counterpart", false, "Update counterpart YAML file with vault_path")
+		cfg               Config
+		printSopsHash     bool
+		verifyHash        bool
+		batchFile         string
+		batchConcurrency  int
+		manifestFile      string
+		dir               string
+		dirGlob           string
+		auditLogFile      string
+		otelEndpoint      string
+		gracefulInterrupt bool
+		assumeYes         bool
+		jwtToken          string
+		jwtRole           string
+		jwtAuthPath       string
+		roleID            string
+		secretID          string
+		k8sRole           string
+		k8sJWTPath        string
+		ldapUsername      string
+		ldapPassword      string
+		mfaPasscode       string
+		tokenFile         string
+		tokenSinkFile     string
+		noTokenRenew      bool
+		noOverwrite       bool
+		rotate            bool
+		backupVault       bool
+		backupFile        string
+		configFile        string
+		mountAutoDetect   bool
+		completion        string
+		simulate          bool
+		showSecrets       bool
+		listMode          bool
+		listVersions      bool
+		reverse           bool
+		merge             bool
+		vaultPathFromFile bool
 	)
 
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <sops-file> <vault-path>\n\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Import secrets from a SOPS-encrypted YAML file to Vault KV v2.\n\n")
-		fmt.Fprintf(os.Stderr, "Arguments:\n")
-		fmt.Fprintf(os.Stderr, "  sops-file    Path to SOPS-encrypted YAML file\n")
-		fmt.Fprintf(os.Stderr, "  vault-path   Destination path in Vault (under the mount)\n\n")
-		fmt.Fprintf(os.Stderr, "Flags:\n")
-		flag.PrintDefaults()
+	flag.StringVar(&configFile, "config", "", "TOML file of flag values keyed by flag name, e.g. vault_addr = \"...\" (default: ~/.sops-to-vault.toml if it exists); flags given on the command line override it")
+	flag.StringVar(&cfg.VaultAddr, "vault-addr", "", "Vault server address (env: VAULT_ADDR)")
+	flag.StringVar(&cfg.VaultToken, "vault-token", "", "Vault token (env: VAULT_TOKEN, VAULT_TOKEN_FILE)")
+	flag.StringVar(&tokenFile, "vault-token-file", "", "File to read the Vault token from, e.g. a Docker or Kubernetes secret")
+	flag.StringVar(&tokenSinkFile, "vault-agent-token-sink", "", "Vault Agent token sink file to read the token from, switching to each new token the agent writes")
+	flag.StringVar(&cfg.VaultNamespace, "vault-namespace", "", "Vault Enterprise/HCP namespace for all requests (env: VAULT_NAMESPACE)")
+	flag.StringVar(&cfg.VaultCACert, "vault-tls-ca-cert", "", "PEM CA certificate to verify the Vault server with")
+	flag.StringVar(&cfg.VaultClientCert, "vault-tls-client-cert", "", "PEM client certificate for TLS authentication to Vault (use with --vault-tls-client-key)")
+	flag.StringVar(&cfg.VaultClientKey, "vault-tls-client-key", "", "PEM private key for --vault-tls-client-cert")
+	flag.BoolVar(&cfg.VaultSkipVerify, "vault-tls-skip-verify", false, "Don't verify the Vault server's TLS certificate (development only) (env: VAULT_SKIP_VERIFY)")
+	flag.StringVar(&cfg.Mount, "mount", "secret", "Vault KV mount path")
+	flag.IntVar(&cfg.KVVersion, "kv-version", 2, "Version of the KV secrets engine at --mount: 1 or 2")
+	flag.BoolVar(&mountAutoDetect, "vault-mount-auto-detect", false, "Look up --mount in sys/mounts and use its KV version instead of --kv-version")
+	flag.StringVar(&cfg.AgeKeyFile, "age-key-file", "", "age identity file to decrypt the SOPS file with (sets SOPS_AGE_KEY_FILE while decrypting)")
+	flag.BoolVar(&cfg.IgnoreMissingSopsKey, "ignore-missing-sops-key", false, "Exit 2 instead of 1 when no local key can decrypt the SOPS file; with --batch or --dir, skip such files")
+	flag.StringVar(&cfg.Format, "format", "", "SOPS file format: yaml, json, dotenv, toml (default: detected from the file extension)")
+	flag.StringVar(&cfg.Separator, "separator", defaultSeparator, "Separator joining nested key names when flattening")
+	flag.IntVar(&cfg.MaxDepth, "max-depth", 0, "Flatten at most this many levels of keys, keeping deeper maps as JSON strings (0 = unlimited)")
+	flag.BoolVar(&cfg.FlattenArrays, "flatten-arrays", false, "Flatten arrays too, one key per element with its index as the last segment (allowedIPs.0, allowedIPs.1, ...)")
+	flag.BoolVar(&cfg.JSONEncodeComplex, "json-encode-complex", false, "Write arrays (and maps kept whole) as JSON strings instead of Go formatting such as [a b]")
+	flag.StringVar(&cfg.KeyRenameFile, "key-rename-map", "", "YAML map of flattened key names to the names to write them as")
+	flag.StringVar(&cfg.TransformKeys, "transform-keys", transformNone, "Rewrite each segment of the flattened keys: none, snake, upper_snake, camel, or kebab")
+	flag.BoolVar(&cfg.PathLowercase, "path-lowercase", false, "Lowercase every key, and so its Vault path, after flattening and --transform-keys")
+	flag.StringVar(&cfg.ValidateKeys, "validate-keys", "", "Check every key before writing anything: strict (lowercase letters, digits, -, _, and .), vault (safe in Vault paths), or custom (matches --key-pattern)")
+	flag.Func("key-pattern", "Regular expression every key must match (use with --validate-keys=custom)", func(v string) error {
+		re, err := regexp.Compile(v)
+		cfg.KeyPattern = re
+		return err
+	})
+	flag.StringVar(&cfg.PrefixStrip, "prefix-strip", "", "Remove this prefix from each flattened key before writing, e.g. app.")
+	flag.Func("value-template", "Go template for the value stored in Vault, with .Key and .Value (default: {{.Value}})", func(v string) error {
+		tmpl, err := parseValueTemplate(v)
+		cfg.ValueTemplate = tmpl
+		return err
+	})
+	flag.Func("routing-config", "YAML file of rules routing keys matching a glob or regex to other Vault paths", func(v string) error {
+		routing, err := loadRoutingConfig(v)
+		cfg.Routing = routing
+		return err
+	})
+	flag.Func("vault-path-template", "Go template for each key's Vault path, with .VaultPath, .Key, .Filename, .Mount, and .Env (default: {{.VaultPath}}/{{.Key}})", func(v string) error {
+		tmpl, err := parsePathTemplate(v)
+		cfg.PathTemplate = tmpl
+		return err
+	})
+	flag.StringVar(&cfg.Env, "env", "", "Environment name prefixed to the vault path: secrets go to <env>/<vault-path>/<key>, or <env>/<vault-path>/<name>/<key> with --append-name (with --vault-path-template, only available as {{.Env}})")
+	flag.StringVar(&cfg.VaultKeyName, "vault-key-name", defaultValueField, "Secret field each value is stored under")
+	flag.Func("set", "Override or add a flattened key with a string value, as key=value (repeatable)", func(v string) error {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("expected key=value")
+		}
+		if cfg.Overrides == nil {
+			cfg.Overrides = make(map[string]string)
+		}
+		cfg.Overrides[key] = value
+		return nil
+	})
+	flag.Func("tags", "Comma-separated key=value pairs to set as custom metadata on each secret written, e.g. environment=prod,team=platform (KV v2 only)", func(v string) error {
+		tags, err := parseTags(v)
+		if err != nil {
+			return err
+		}
+		cfg.addTags(tags)
+		return nil
+	})
+	flag.Func("label", "Add a key=value to the custom metadata of each secret written, e.g. git_commit=$GIT_SHA, to trace which deployment wrote it (repeatable, KV v2 only)", func(v string) error {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("expected key=value")
+		}
+		cfg.addTags(map[string]string{key: value})
+		return nil
+	})
+	flag.BoolVar(&cfg.Diff, "diff", false, "Show which secrets differ from Vault without writing; exit 1 if any do")
+	flag.BoolVar(&cfg.VerifyOnly, "verify-only", false, "Check that every value in Vault matches the SOPS file, printing mismatches with values masked to their lengths; exit 1 if any don't")
+	flag.BoolVar(&cfg.Progress, "progress", false, "Show a progress bar on stderr while writing secrets")
+	flag.BoolVar(&cfg.Verbose, "verbose", false, "Log the method and URL of each Vault API request to stderr (never values); with --dry-run, list the requests that would write the secrets")
+	flag.BoolVar(&simulate, "simulate", false, "Run the full write against an empty in-memory Vault instead of a real one, then print the resulting secrets (values masked) as JSON")
+	flag.BoolVar(&cfg.DryRun, "dry-run", false, "Print secrets without writing to Vault")
+	flag.BoolVar(&cfg.AppendName, "append-name", false, "Append cleaned filename to vault path")
+	flag.Func("strip-suffixes", "Comma-separated suffixes stripped from the end of SOPS filenames to derive names (default: -secrets,.enc,.sops,.prod,.staging,.dev)", func(v string) error {
+		// Non-nil even if empty, so --strip-suffixes "" turns stripping off
+		cfg.StripSuffixes = append([]string{}, splitList(v)...)
+		return nil
+	})
+	flag.StringVar(&cfg.NameOverride, "name", "", "Override the derived name (use with --append-name)")
+	flag.BoolVar(&cfg.UpdateCounterpart, "update-counterpart", false, "Update counterpart YAML file with vault_path")
+	flag.BoolVar(&noTokenRenew, "no-token-renew", false, "Don't renew the Vault token in the background (by default it is renewed every half of its TTL)")
+	flag.BoolVar(&cfg.ShowTokenExpiry, "show-token-expiry", false, "Print Vault token TTL and expiration time on startup")
+	flag.DurationVar(&cfg.MinTokenTTL, "min-token-ttl", 5*time.Minute, "Warn if the Vault token TTL is below this (use with --show-token-expiry)")
+	flag.StringVar(&cfg.DeprecationFile, "key-deprecation-file", "", "YAML file mapping deprecated key names to their replacements")
+	flag.BoolVar(&cfg.DeprecationRename, "key-deprecation-rename", false, "Rename deprecated keys to their replacements before writing")
+	flag.BoolVar(&cfg.GitHubMask, "output-github-actions-mask", false, "Print ::add-mask:: commands for each secret value and exit")
+	flag.BoolVar(&cfg.ExportEnv, "export-env", false, "Print shell export statements for each secret and exit")
+	flag.StringVar(&cfg.PolicyFile, "generate-policy", "", "Write a Vault policy granting read on every path that would be written to this file and exit")
+	flag.StringVar(&cfg.OutputFile, "output-file", "", "Write generated output to this file instead of stdout. With --dry-run, write the secrets that would be written, nested again and masked, as YAML")
+	flag.StringVar(&cfg.ExistsStrategy, "vault-path-exists-strategy", strategyOverwrite, "How to handle paths that already exist: overwrite, skip, merge, error")
+	flag.BoolVar(&noOverwrite, "no-overwrite", false, "Skip keys whose Vault path already holds data (same as --vault-path-exists-strategy=skip)")
+	flag.BoolVar(&cfg.CAS, "cas", false, "Overwrite each secret with check-and-set against the version read just before; secrets changed in between are skipped")
+	flag.StringVar(&otelEndpoint, "otel-endpoint", "", "Export OpenTelemetry traces of the decrypt, flatten, and Vault write steps to this OTLP endpoint: http(s)://host:4318 for OTLP/HTTP or grpc(s)://host:4317 for OTLP/gRPC")
+	flag.StringVar(&auditLogFile, "audit-log", "", "Append a JSON line per attempted Vault write (path, key, status, error) to this file")
+	flag.StringVar(&cfg.SopsFileHash, "sops-file-hash", "", "Expected SHA256 (hex) of the SOPS file; abort if it differs")
+	flag.BoolVar(&cfg.CompareHash, "compare-hash", false, "Write sha256:<hex> of each value instead of the value itself, so Vault can be checked against the SOPS file with --verify-hash without holding the plaintext")
+	flag.BoolVar(&verifyHash, "verify-hash", false, "Check that every value in Vault is the sha256:<hex> hash of the SOPS file's value, as written with --compare-hash; exit 1 if any aren't")
+	flag.StringVar(&completion, "completion", "", "Print the shell completion script for bash, zsh, or fish and exit")
+	flag.BoolVar(&printSopsHash, "print-sops-hash", false, "Print the SHA256 of the SOPS file and exit")
+	flag.BoolVar(&cfg.Bundle, "bundle", false, "Write all keys as one secret at <vault-path> (one per section with --split-by-top-level-key) instead of a path per key")
+	flag.BoolVar(&cfg.SplitTopLevel, "split-by-top-level-key", false, "Write each top-level YAML section to its own path (<vault-path>/<section>/<key>)")
+	flag.BoolVar(&backupVault, "backup-vault", false, "Before writing, save what Vault holds at every target path to --backup-file")
+	flag.StringVar(&backupFile, "backup-file", "", "JSON file --backup-vault saves existing secrets to")
+	flag.StringVar(&cfg.EncryptedJSON, "output-encrypted-json", "", "After writing, save a SOPS-encrypted JSON copy of the secrets to this file (requires sops binary)")
+	flag.StringVar(&cfg.CounterpartFormat, "counterpart-format", "", "Counterpart file format: yaml, json, toml, or dotenv (default: yaml, or dotenv if only <name>.env exists)")
+	flag.BoolFunc("counterpart-format-toml", "Same as --counterpart-format=toml", func(string) error {
+		cfg.CounterpartFormat = inputFormatTOML
+		return nil
+	})
+	flag.BoolVar(&gracefulInterrupt, "graceful-interrupt", true, "On SIGINT/SIGTERM, finish the current write, report progress, and exit 130")
+	flag.BoolVar(&cfg.RollbackOnError, "rollback-on-error", false, "Restore previous values of written secrets if the run fails or is interrupted")
+	flag.BoolVar(&cfg.Atomic, "atomic", false, "Trial-write every secret to a staging path first and only write for real if all succeed; then roll back on error (best-effort)")
+	flag.StringVar(&cfg.KeyOrderingFile, "key-ordering-file", "", "YAML list of keys to write first, in order (remaining keys follow alphabetically)")
+	flag.BoolVar(&cfg.Sync, "sync", false, "Also delete secrets under <vault-path> whose keys are no longer in the SOPS file")
+	flag.BoolVar(&cfg.Delete, "delete", false, "Permanently delete the Vault path of every key in the SOPS file instead of writing")
+	flag.BoolVar(&cfg.ForceRecreate, "force-recreate", false, "Permanently delete each path (all versions) before writing it, so it restarts at version 1")
+	flag.BoolVar(&assumeYes, "yes", false, "Don't ask for confirmation of destructive operations")
+	flag.StringVar(&cfg.OutputFormat, "output-format", formatText, "Output format: text, json, markdown (dry-run only), terraform (print Terraform variables and tfvars instead of writing), or helm-secrets (a values.yaml referencing the secrets written)")
+	flag.StringVar(&cfg.OutputFormat, "output", formatText, "Alias for --output-format")
+	flag.StringVar(&cfg.MaskValueLength, "mask-value-length", maskModeLength, "How much of each value dry-run output shows: none (<secret>), length (type and length), hint (first and last character), or full (the value, requires --show-secrets)")
+	flag.BoolVar(&showSecrets, "show-secrets", false, "Allow --mask-value-length=full to print secret values")
+	flag.StringVar(&cfg.HelmReleaseName, "helm-release-name", "", "Nest the helm-secrets values under this key (use with --output-format=helm-secrets)")
+	flag.StringVar(&cfg.MarkdownTitle, "markdown-title", "", "Heading printed above the table (use with --output-format=markdown)")
+	flag.StringVar(&jwtToken, "vault-jwt-token", "", "JWT/OIDC token, or path to a file containing it, to log in with")
+	flag.StringVar(&jwtRole, "vault-jwt-role", "", "Vault role to log in as (use with --vault-jwt-token)")
+	flag.StringVar(&roleID, "vault-role-id", "", "AppRole role ID to log in with (env: VAULT_ROLE_ID)")
+	flag.StringVar(&secretID, "vault-secret-id", "", "AppRole secret ID to log in with (env: VAULT_SECRET_ID)")
+	flag.StringVar(&k8sRole, "vault-k8s-role", "", "Vault Kubernetes auth role to log in as, using the pod's service account token")
+	flag.StringVar(&k8sJWTPath, "vault-k8s-jwt-path", k8sServiceAccountTokenPath, "Service account token file (use with --vault-k8s-role)")
+	flag.StringVar(&ldapUsername, "vault-ldap-username", "", "LDAP username to log in with (env: VAULT_LDAP_USERNAME)")
+	flag.StringVar(&ldapPassword, "vault-ldap-password", "", "LDAP password to log in with (env: VAULT_LDAP_PASSWORD)")
+	flag.StringVar(&mfaPasscode, "vault-mfa-passcode", "", "One-time passcode for Vault login MFA; prompted for if needed and not given (env: VAULT_MFA_PASSCODE)")
+	flag.StringVar(&jwtAuthPath, "vault-jwt-auth-path", "jwt", "Mount path of the JWT/OIDC auth method")
+	flag.StringVar(&cfg.Backend, "backend", backendVault, "Where to write secrets: vault, chamber, doppler, infisical, aws-secrets-manager, gcp-secret-manager, azure-keyvault, 1password, consul, kubernetes")
+	flag.StringVar(&cfg.ChamberService, "chamber-service", "", "Chamber service name (default: <vault-path>) (use with --backend=chamber)")
+	flag.StringVar(&cfg.ChamberKMSKeyAlias, "chamber-kms-key-alias", chamberDefaultKMSKeyAlias, "KMS key alias for chamber SecureString parameters")
+	flag.StringVar(&cfg.DopplerProject, "doppler-project", "", "Doppler project (default: <vault-path>) (use with --backend=doppler)")
+	flag.StringVar(&cfg.DopplerConfig, "doppler-config", "", "Doppler config, e.g. dev or prd (use with --backend=doppler)")
+	flag.StringVar(&cfg.DopplerToken, "doppler-token", "", "Doppler API token (env: DOPPLER_TOKEN)")
+	flag.StringVar(&cfg.InfisicalWorkspaceID, "infisical-workspace-id", "", "Infisical workspace (project) ID (use with --backend=infisical)")
+	flag.StringVar(&cfg.InfisicalEnvironment, "infisical-environment", "", "Infisical environment slug, e.g. dev or prod (use with --backend=infisical)")
+	flag.StringVar(&cfg.InfisicalToken, "infisical-token", "", "Infisical API token (env: INFISICAL_TOKEN)")
+	flag.StringVar(&cfg.GCPProject, "gcp-project", "", "GCP project ID (use with --backend=gcp-secret-manager) (env: GOOGLE_CLOUD_PROJECT)")
+	flag.StringVar(&cfg.AzureKeyVaultURL, "azure-keyvault-url", "", "Azure Key Vault URL, e.g. https://myvault.vault.azure.net/ (use with --backend=azure-keyvault)")
+	flag.StringVar(&cfg.OnePasswordHost, "1password-connect-host", "", "1Password Connect server URL (use with --backend=1password) (env: OP_CONNECT_HOST)")
+	flag.StringVar(&cfg.OnePasswordToken, "1password-service-account-token", "", "Access token for the 1Password Connect server (env: OP_CONNECT_TOKEN)")
+	flag.StringVar(&cfg.ConsulAddr, "consul-addr", "", "Consul HTTP address (use with --backend=consul) (env: CONSUL_HTTP_ADDR)")
+	flag.StringVar(&cfg.ConsulToken, "consul-token", "", "Consul ACL token (env: CONSUL_HTTP_TOKEN)")
+	flag.StringVar(&cfg.K8sNamespace, "k8s-namespace", "", "Namespace of the generated Kubernetes Secret (use with --backend=kubernetes)")
+	flag.StringVar(&cfg.K8sSecretName, "k8s-secret-name", "", "Name of the generated Kubernetes Secret (default: <vault-path> with slashes as dashes)")
+	flag.BoolVar(&cfg.K8sApply, "k8s-apply", false, "Apply the generated Kubernetes Secret with kubectl instead of printing it")
+	flag.StringVar(&cfg.InfisicalURL, "infisical-url", infisicalDefaultAPIURL, "Infisical API URL, for self-hosted instances")
+	flag.Func("partial-update-keys", "Comma-separated list of keys to write; all other keys are skipped", func(v string) error {
+		cfg.PartialUpdateKeys = splitList(v)
+		return nil
+	})
+	flag.BoolVar(&rotate, "rotate", false, "Replace the --rotate-keys with new random values in the SOPS file, then write them to Vault")
+	flag.Func("rotate-keys", "Comma-separated list of keys to rotate (use with --rotate)", func(v string) error {
+		cfg.RotateKeys = splitList(v)
+		return nil
+	})
+	flag.IntVar(&cfg.RotateLength, "rotate-length", defaultRotateLength, "Length of the values --rotate generates")
+	flag.StringVar(&cfg.RotateCharset, "rotate-charset", defaultRotateCharset, "Characters --rotate generates values from: alphanumeric, hex, base64url, or ascii")
+	flag.Func("key-filter", "Only write keys matching this regular expression", func(v string) error {
+		re, err := regexp.Compile(v)
+		cfg.KeyFilter = re
+		return err
+	})
+	flag.BoolVar(&cfg.IncludeSopsMetadata, "include-sops-metadata", false, "Keep the sops metadata key (kms, pgp, lastmodified, ...) if it appears in the decrypted data")
+	flag.Func("key-exclude", "Skip keys matching this regular expression", func(v string) error {
+		re, err := regexp.Compile(v)
+		cfg.KeyExclude = re
+		return err
+	})
+	flag.StringVar(&cfg.CDKContextFile, "output-cdk-context", "", "Merge the secrets into this AWS CDK context file (e.g. cdk.context.json) and exit")
+	flag.StringVar(&cfg.CDKContextKey, "cdk-context-key", cdkDefaultContextKey, "Context key to write secrets under (use with --output-cdk-context)")
+	flag.IntVar(&cfg.RetryAttempts, "retry-attempts", 3, "Times to retry a Vault write that fails with 429, 503, or connection refused (0 disables)")
+	flag.DurationVar(&cfg.RetryInitialDelay, "retry-initial-delay", 500*time.Millisecond, "Wait before the first retry; doubles with each further retry")
+	flag.BoolVar(&cfg.ReadVerify, "read-verify", false, "Read each secret back after writing and warn if it differs from what was written")
+	flag.BoolVar(&cfg.Strict, "strict", false, "Exit non-zero if --read-verify finds a mismatch")
+	flag.IntVar(&cfg.Parallelism, "parallelism", 1, "Number of secrets to write at once; with more than 1, all writes are attempted and failures reported together")
+	flag.BoolVar(&listMode, "list", false, "List the secrets under <vault-path> instead of writing (takes only the vault-path argument)")
+	flag.BoolVar(&listVersions, "list-versions", false, "Include each secret's current version and update time (use with --list)")
+	flag.BoolVar(&merge, "merge", false, "Merge several SOPS files into one vault path, later files overriding earlier ones (args: <sops-file>... <vault-path>)")
+	flag.BoolVar(&vaultPathFromFile, "vault-path-from-file", false, "Read the vault path from a .vaultpath file in the SOPS file's directory or the nearest parent with one, making the vault-path argument optional")
+	flag.BoolVar(&reverse, "reverse", false, "Read the secrets under <vault-path> back into a SOPS-encrypted YAML file (args: <vault-path> <sops-output-file>)")
+	flag.StringVar(&batchFile, "batch-file", "", "File listing '<sops-file> <vault-path>' pairs to process, one per line")
+	flag.IntVar(&batchConcurrency, "batch-concurrency", 1, "Number of batch files to process at once (use with --batch-file)")
+	flag.StringVar(&manifestFile, "manifest", "", "YAML manifest of SOPS files to process, with optional per-entry overrides (format below)")
+	flag.StringVar(&dir, "dir", "", "Process every SOPS file in this directory, writing each to <vault-path>/<cleaned filename> (takes only the vault-path argument)")
+	flag.StringVar(&dirGlob, "dir-glob", defaultDirGlob, "Comma-separated file name patterns to process (use with --dir)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <sops-file> <vault-path>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [flags] --vault-path-from-file <sops-file> [<vault-path>]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [flags] --merge <sops-file>... <vault-path>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [flags] --batch-file <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [flags] --manifest <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [flags] --dir <directory> <vault-path>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [flags] --list <vault-path>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [flags] --reverse <vault-path> <sops-output-file>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Import secrets from a SOPS-encrypted file to Vault KV.\n\n")
+		fmt.Fprintf(os.Stderr, "Arguments:\n")
+		fmt.Fprintf(os.Stderr, "  sops-file    Path to SOPS-encrypted YAML file, or - to read it from stdin\n")
+		fmt.Fprintf(os.Stderr, "  vault-path   Destination path in Vault (under the mount); secrets are written to\n")
+		fmt.Fprintf(os.Stderr, "               [<env>/]<vault-path>[/<name>]/<key>, with --env and --append-name\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\n%s", manifestHelp)
+	}
+
+	flag.Parse()
+
+	configRequired := configFile != ""
+	if !configRequired {
+		configFile = defaultConfigPath()
+	}
+	if configFile != "" {
+		if err := applyConfigFile(flag.CommandLine, configFile, configRequired); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if completion != "" {
+		if err := writeCompletion(os.Stdout, completion, flag.CommandLine); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if printSopsHash && flag.NArg() >= 1 {
+		sum, err := hashFile(flag.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(sum)
+		return
+	}
+
+	// --verify-hash is a --verify-only against values written with
+	// --compare-hash
+	if verifyHash {
+		if cfg.Diff || cfg.VerifyOnly {
+			fmt.Fprintln(os.Stderr, "Error: --verify-hash can't be combined with --diff or --verify-only")
+			os.Exit(1)
+		}
+		cfg.CompareHash = true
+		cfg.VerifyOnly = true
+	}
+
+	// --verify-only is a --diff that reports only mismatches
+	if cfg.VerifyOnly {
+		if cfg.Diff {
+			fmt.Fprintln(os.Stderr, "Error: --verify-only and --diff are mutually exclusive")
+			os.Exit(1)
+		}
+		cfg.Diff = true
+	}
+
+	// --vault-path-from-file supplies the vault-path argument from the
+	// nearest .vaultpath file, falling back to the argument if there's none
+	args := flag.Args()
+	if vaultPathFromFile {
+		switch {
+		case listMode || merge || reverse || batchFile != "" || manifestFile != "" || dir != "":
+			fmt.Fprintln(os.Stderr, "Error: --vault-path-from-file takes a single SOPS file; it can't be combined with --list, --merge, --reverse, --batch-file, --manifest, or --dir")
+			os.Exit(1)
+		case len(args) != 1 && len(args) != 2:
+			flag.Usage()
+			os.Exit(1)
+		case args[0] == stdinArg:
+			fmt.Fprintln(os.Stderr, "Error: --vault-path-from-file needs a SOPS file path, not stdin")
+			os.Exit(1)
+		}
+		vaultPath, _, err := findVaultPath(args[0])
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		case vaultPath != "":
+			args = []string{args[0], vaultPath}
+		case len(args) == 1:
+			fmt.Fprintf(os.Stderr, "Error: no %s file found for %s, and no vault-path argument given\n", vaultPathFile, args[0])
+			os.Exit(1)
+		}
+	}
+
+	switch {
+	case listMode && flag.NArg() != 1,
+		dir != "" && flag.NArg() != 1,
+		merge && flag.NArg() < 2,
+		!listMode && !merge && batchFile == "" && manifestFile == "" && dir == "" && len(args) != 2,
+		(batchFile != "" || manifestFile != "") && flag.NArg() != 0:
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if noOverwrite {
+		if cfg.ExistsStrategy != strategyOverwrite && cfg.ExistsStrategy != strategySkip {
+			fmt.Fprintln(os.Stderr, "Error: --no-overwrite can't be combined with --vault-path-exists-strategy")
+			os.Exit(1)
+		}
+		cfg.ExistsStrategy = strategySkip
+	}
+
+	switch cfg.ExistsStrategy {
+	case strategyOverwrite, strategySkip, strategyMerge, strategyError:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --vault-path-exists-strategy %q (expected overwrite, skip, merge, or error)\n", cfg.ExistsStrategy)
+		os.Exit(1)
+	}
+
+	if cfg.Format != "" && !validInputFormat(cfg.Format) {
+		fmt.Fprintf(os.Stderr, "Error: invalid --format %q (expected yaml, json, dotenv, or toml)\n", cfg.Format)
+		os.Exit(1)
+	}
+
+	switch cfg.CounterpartFormat {
+	case "", inputFormatYAML, inputFormatJSON, inputFormatTOML, inputFormatDotenv:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --counterpart-format %q (expected yaml, json, toml, or dotenv)\n", cfg.CounterpartFormat)
+		os.Exit(1)
+	}
+
+	if !validTransform(cfg.TransformKeys) {
+		fmt.Fprintf(os.Stderr, "Error: invalid --transform-keys %q (expected none, snake, upper_snake, camel, or kebab)\n", cfg.TransformKeys)
+		os.Exit(1)
+	}
+
+	if cfg.ValidateKeys != "" && !validKeyValidation(cfg.ValidateKeys) {
+		fmt.Fprintf(os.Stderr, "Error: invalid --validate-keys %q (expected strict, vault, or custom)\n", cfg.ValidateKeys)
+		os.Exit(1)
+	}
+	if (cfg.ValidateKeys == validateCustom) != (cfg.KeyPattern != nil) {
+		fmt.Fprintln(os.Stderr, "Error: --key-pattern is required with, and only used by, --validate-keys=custom")
+		os.Exit(1)
+	}
+
+	if cfg.Separator == "" {
+		fmt.Fprintln(os.Stderr, "Error: --separator must not be empty")
+		os.Exit(1)
+	}
+	if cfg.MaxDepth < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --max-depth must not be negative")
+		os.Exit(1)
+	}
+	if cfg.AgeKeyFile != "" {
+		f, err := os.Open(cfg.AgeKeyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --age-key-file: %v\n", err)
+			os.Exit(1)
+		}
+		f.Close()
+	}
+
+	if cfg.VaultKeyName == "" {
+		fmt.Fprintln(os.Stderr, "Error: --vault-key-name must not be empty")
+		os.Exit(1)
+	}
+	if cfg.Parallelism < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --parallelism must be at least 1")
+		os.Exit(1)
+	}
+
+	if cfg.KVVersion != 1 && cfg.KVVersion != 2 {
+		fmt.Fprintf(os.Stderr, "Error: invalid --kv-version %d (expected 1 or 2)\n", cfg.KVVersion)
+		os.Exit(1)
+	}
+
+	switch cfg.OutputFormat {
+	case formatText, formatJSON, formatMarkdown, formatTerraform, formatHelmSecrets:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --output-format %q (expected text, json, markdown, terraform, or helm-secrets)\n", cfg.OutputFormat)
+		os.Exit(1)
+	}
+	if !validMaskMode(cfg.MaskValueLength) {
+		fmt.Fprintf(os.Stderr, "Error: invalid --mask-value-length %q (expected none, length, hint, or full)\n", cfg.MaskValueLength)
+		os.Exit(1)
+	}
+	if cfg.MaskValueLength == maskModeFull && !showSecrets {
+		fmt.Fprintln(os.Stderr, "Error: --mask-value-length=full prints secret values; add --show-secrets to confirm")
+		os.Exit(1)
+	}
+
+	if cfg.OutputFormat == formatHelmSecrets && (cfg.Diff || cfg.Delete || listMode || reverse || cfg.Backend != backendVault) {
+		fmt.Fprintln(os.Stderr, "Error: --output-format=helm-secrets cannot be used with --diff, --delete, --list, --reverse, or other backends")
+		os.Exit(1)
+	}
+	if cfg.HelmReleaseName != "" && cfg.OutputFormat != formatHelmSecrets {
+		fmt.Fprintln(os.Stderr, "Error: --helm-release-name requires --output-format=helm-secrets")
+		os.Exit(1)
+	}
+	if cfg.OutputFormat == formatTerraform && (cfg.DryRun || cfg.Diff || cfg.Delete || listMode || reverse || cfg.Backend != backendVault) {
+		fmt.Fprintln(os.Stderr, "Error: --output-format=terraform cannot be used with --dry-run, --diff, --delete, --list, --reverse, or other backends")
+		os.Exit(1)
+	}
+
+	if !validBackend(cfg.Backend) {
+		fmt.Fprintf(os.Stderr, "Error: invalid --backend %q (expected vault, chamber, doppler, infisical, aws-secrets-manager, gcp-secret-manager, azure-keyvault, 1password, consul, or kubernetes)\n", cfg.Backend)
+		os.Exit(1)
+	}
+
+	// Other backends write each key as given, so the Vault write options and
+	// reports don't apply to them
+	if cfg.Backend != backendVault && (cfg.Bundle || cfg.SplitTopLevel || cfg.ExistsStrategy != strategyOverwrite || cfg.RollbackOnError || cfg.ForceRecreate || cfg.CAS || cfg.Parallelism > 1 || cfg.ReadVerify || backupVault || cfg.Progress || cfg.OutputFormat != formatText || cfg.UpdateCounterpart || cfg.EncryptedJSON != "") {
+		fmt.Fprintln(os.Stderr, "Error: --bundle, --split-by-top-level-key, --vault-path-exists-strategy, --no-overwrite, --rollback-on-error, --force-recreate, --cas, --parallelism, --read-verify, --backup-vault, --progress, --output-format, --update-counterpart, and --output-encrypted-json are only supported with --backend=vault")
+		os.Exit(1)
+	}
+
+	if cfg.ForceRecreate && cfg.ExistsStrategy != strategyOverwrite {
+		fmt.Fprintln(os.Stderr, "Error: --force-recreate can only be used with --vault-path-exists-strategy=overwrite")
+		os.Exit(1)
+	}
+
+	if cfg.CAS && ((cfg.KVVersion != 2 && !mountAutoDetect) || cfg.ExistsStrategy != strategyOverwrite || cfg.ForceRecreate) {
+		fmt.Fprintln(os.Stderr, "Error: --cas requires --kv-version=2 and --vault-path-exists-strategy=overwrite, without --force-recreate")
+		os.Exit(1)
+	}
+
+	if simulate && (cfg.DryRun || cfg.Diff || cfg.Delete || listMode || reverse || batchFile != "" || manifestFile != "" || dir != "" || cfg.Backend != backendVault) {
+		fmt.Fprintln(os.Stderr, "Error: --simulate writes one SOPS file (or --merge set) to Vault; it can't be combined with --dry-run, --diff, --delete, --list, --reverse, --batch-file, --manifest, --dir, or other backends")
+		os.Exit(1)
+	}
+
+	if cfg.FlattenArrays && cfg.UpdateCounterpart {
+		fmt.Fprintln(os.Stderr, "Error: --flatten-arrays can't be used with --update-counterpart")
+		os.Exit(1)
+	}
+
+	if len(cfg.Tags) > 0 && ((cfg.KVVersion != 2 && !mountAutoDetect) || cfg.Backend != backendVault || cfg.Delete) {
+		fmt.Fprintln(os.Stderr, "Error: --tags and --label require --kv-version=2 and --backend=vault, and can't be used with --delete")
+		os.Exit(1)
+	}
+
+	if cfg.Atomic && (cfg.Sync || cfg.Delete || cfg.Backend != backendVault) {
+		fmt.Fprintln(os.Stderr, "Error: --atomic can't be used with --sync, --delete, or other backends")
+		os.Exit(1)
+	}
+	// --atomic undoes a failed run the same way
+	cfg.RollbackOnError = cfg.RollbackOnError || cfg.Atomic
+
+	if cfg.Delete && (cfg.ForceRecreate || cfg.ReadVerify || cfg.RollbackOnError || cfg.UpdateCounterpart || cfg.EncryptedJSON != "") {
+		fmt.Fprintln(os.Stderr, "Error: --delete can't be combined with write options (--force-recreate, --read-verify, --rollback-on-error, --update-counterpart, --output-encrypted-json)")
+		os.Exit(1)
+	}
+
+	if dir != "" && (batchFile != "" || listMode) {
+		fmt.Fprintln(os.Stderr, "Error: --dir can't be combined with --batch-file or --list")
+		os.Exit(1)
+	}
+
+	if manifestFile != "" && (batchFile != "" || dir != "" || listMode) {
+		fmt.Fprintln(os.Stderr, "Error: --manifest can't be combined with --batch-file, --dir, or --list")
+		os.Exit(1)
+	}
+
+	if merge && (batchFile != "" || manifestFile != "" || dir != "" || listMode || reverse || cfg.SopsFileHash != "") {
+		fmt.Fprintln(os.Stderr, "Error: --merge can't be combined with --batch-file, --manifest, --dir, --list, --reverse, or --sops-file-hash")
+		os.Exit(1)
+	}
+
+	if backupVault {
+		switch {
+		case backupFile == "":
+			fmt.Fprintln(os.Stderr, "Error: --backup-vault requires --backup-file")
+			os.Exit(1)
+		case cfg.Backend != backendVault || cfg.Delete || batchFile != "" || manifestFile != "" || dir != "":
+			fmt.Fprintln(os.Stderr, "Error: --backup-vault is only supported with --backend=vault for a single write, not with --delete, --batch-file, --manifest, or --dir")
+			os.Exit(1)
+		}
+		cfg.BackupFile = backupFile
+	} else if backupFile != "" {
+		fmt.Fprintln(os.Stderr, "Error: --backup-file requires --backup-vault")
+		os.Exit(1)
+	}
+
+	if rotate {
+		switch {
+		case len(cfg.RotateKeys) == 0:
+			fmt.Fprintln(os.Stderr, "Error: --rotate requires --rotate-keys")
+			os.Exit(1)
+		case cfg.RotateLength < 1:
+			fmt.Fprintln(os.Stderr, "Error: --rotate-length must be at least 1")
+			os.Exit(1)
+		case rotateCharsets[cfg.RotateCharset] == "":
+			fmt.Fprintf(os.Stderr, "Error: invalid --rotate-charset %q (expected alphanumeric, hex, base64url, or ascii)\n", cfg.RotateCharset)
+			os.Exit(1)
+		case batchFile != "" || manifestFile != "" || dir != "" || listMode || reverse || merge || cfg.Delete || cfg.Diff || len(cfg.PartialUpdateKeys) > 0 || len(cfg.Overrides) > 0:
+			fmt.Fprintln(os.Stderr, "Error: --rotate can't be combined with --batch-file, --manifest, --dir, --list, --reverse, --merge, --delete, --diff, --partial-update-keys, or --set")
+			os.Exit(1)
+		}
+	} else if len(cfg.RotateKeys) > 0 {
+		fmt.Fprintln(os.Stderr, "Error: --rotate-keys requires --rotate")
+		os.Exit(1)
+	}
+
+	if reverse && (batchFile != "" || manifestFile != "" || dir != "" || listMode || cfg.Delete || cfg.Diff || cfg.Backend != backendVault) {
+		fmt.Fprintln(os.Stderr, "Error: --reverse can't be combined with --batch-file, --manifest, --dir, --list, --delete, --diff, or another --backend")
+		os.Exit(1)
+	}
+
+	if dir != "" && (cfg.AppendName || cfg.NameOverride != "") {
+		fmt.Fprintln(os.Stderr, "Error: --append-name and --name can't be used with --dir, which always appends each file's cleaned name")
+		os.Exit(1)
+	}
+
+	if cfg.PathTemplate != nil && (cfg.Bundle || cfg.SplitTopLevel || cfg.Routing != nil || cfg.Sync || cfg.Backend != backendVault) {
+		fmt.Fprintln(os.Stderr, "Error: --vault-path-template is only supported with --backend=vault and can't be combined with --bundle, --split-by-top-level-key, --routing-config, or --sync")
+		os.Exit(1)
+	}
+
+	if cfg.Routing != nil && (cfg.Sync || cfg.Backend != backendVault) {
+		fmt.Fprintln(os.Stderr, "Error: --routing-config is only supported with --backend=vault and can't be combined with --sync")
+		os.Exit(1)
+	}
+
+	if cfg.Sync && (cfg.Delete || cfg.Diff || cfg.Backend != backendVault || len(cfg.PartialUpdateKeys) > 0 || cfg.KeyFilter != nil || cfg.KeyExclude != nil) {
+		fmt.Fprintln(os.Stderr, "Error: --sync is only supported with --backend=vault and can't be combined with --delete, --diff, or key selection (--partial-update-keys, --key-filter, --key-exclude)")
+		os.Exit(1)
+	}
+
+	if cfg.Diff && (cfg.Delete || cfg.Backend != backendVault) {
+		fmt.Fprintln(os.Stderr, "Error: --diff is only supported with --backend=vault and can't be combined with --delete")
+		os.Exit(1)
+	}
+
+	if cfg.CompareHash && (cfg.Backend != backendVault || cfg.GitHubMask || cfg.ExportEnv || cfg.OutputFormat == formatTerraform || cfg.CDKContextFile != "" || rotate) {
+		fmt.Fprintln(os.Stderr, "Error: --compare-hash and --verify-hash are only supported with --backend=vault, and can't be combined with --output-github-actions-mask, --export-env, --output-format=terraform, --output-cdk-context, or --rotate")
+		os.Exit(1)
+	}
+
+	if (cfg.ValueTemplate != nil || cfg.VaultKeyName != defaultValueField) && cfg.Backend != backendVault {
+		fmt.Fprintln(os.Stderr, "Error: --value-template and --vault-key-name are only supported with --backend=vault")
+		os.Exit(1)
+	}
+
+	if cfg.PolicyFile != "" && cfg.Backend != backendVault {
+		fmt.Fprintln(os.Stderr, "Error: --generate-policy is only supported with --backend=vault")
+		os.Exit(1)
+	}
+
+	if auditLogFile != "" && cfg.Backend != backendVault {
+		fmt.Fprintln(os.Stderr, "Error: --audit-log is only supported with --backend=vault")
+		os.Exit(1)
+	}
+
+	if cfg.Delete && cfg.Backend != backendVault {
+		fmt.Fprintln(os.Stderr, "Error: --delete is only supported with --backend=vault")
+		os.Exit(1)
+	}
+
+	// A sops-file of "-" reads the encrypted data from stdin, so nothing
+	// else can read from stdin or use the SOPS file's path
+	stdinFiles := 0
+	if !listMode && !reverse && batchFile == "" && manifestFile == "" && dir == "" {
+		for _, f := range args[:len(args)-1] {
+			if f == stdinArg {
+				stdinFiles++
+			}
+		}
+	}
+	if stdinFiles > 0 {
+		switch {
+		case stdinFiles > 1:
+			fmt.Fprintln(os.Stderr, "Error: stdin (-) can only be given once")
+			os.Exit(1)
+		case cfg.AppendName && cfg.NameOverride == "":
+			fmt.Fprintln(os.Stderr, "Error: --append-name needs --name when reading the SOPS file from stdin")
+			os.Exit(1)
+		case cfg.UpdateCounterpart || cfg.EncryptedJSON != "" || rotate:
+			fmt.Fprintln(os.Stderr, "Error: --update-counterpart, --output-encrypted-json, and --rotate need a SOPS file path, not stdin")
+			os.Exit(1)
+		case (cfg.Delete || cfg.ForceRecreate) && !cfg.DryRun && !assumeYes:
+			fmt.Fprintln(os.Stderr, "Error: --delete and --force-recreate need --yes when reading the SOPS file from stdin")
+			os.Exit(1)
+		}
+	}
+
+	if cfg.Delete && !cfg.DryRun && !assumeYes {
+		if !confirm(os.Stdin, os.Stderr, "--delete permanently destroys all versions of every secret in the SOPS file. Continue?") {
+			fmt.Fprintln(os.Stderr, "Aborted")
+			os.Exit(1)
+		}
+	}
+
+	if cfg.ForceRecreate && !cfg.DryRun && !assumeYes {
+		if !confirm(os.Stdin, os.Stderr, "--force-recreate permanently destroys all existing versions of every secret written. Continue?") {
+			fmt.Fprintln(os.Stderr, "Aborted")
+			os.Exit(1)
+		}
+	}
+
+	// Resolve config with precedence: flags > env vars
+	cfg.VaultAddr = resolveConfig(cfg.VaultAddr, "VAULT_ADDR")
+	cfg.VaultNamespace = resolveConfig(cfg.VaultNamespace, "VAULT_NAMESPACE")
+	skipVerify, err := resolveBoolConfig(cfg.VaultSkipVerify, "VAULT_SKIP_VERIFY")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	cfg.VaultSkipVerify = skipVerify
+	if tokenFile != "" {
+		if cfg.VaultToken != "" {
+			fmt.Fprintln(os.Stderr, "Error: --vault-token and --vault-token-file are mutually exclusive")
+			os.Exit(1)
+		}
+		token, err := readTokenFile(tokenFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --vault-token-file: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.VaultToken = token
+	}
+	if tokenSinkFile != "" {
+		if cfg.VaultToken != "" || tokenFile != "" || jwtToken != "" {
+			fmt.Fprintln(os.Stderr, "Error: --vault-agent-token-sink can't be combined with --vault-token, --vault-token-file, or --vault-jwt-token")
+			os.Exit(1)
+		}
+		sink, err := newTokenSink(tokenSinkFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --vault-agent-token-sink: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.TokenSink = sink
+		cfg.VaultToken = sink.Token()
+	}
+	cfg.VaultToken = resolveToken(cfg.VaultToken)
+	roleID = resolveConfig(roleID, "VAULT_ROLE_ID")
+	secretID = resolveConfig(secretID, "VAULT_SECRET_ID")
+	ldapUsername = resolveConfig(ldapUsername, "VAULT_LDAP_USERNAME")
+	ldapPassword = resolveConfig(ldapPassword, "VAULT_LDAP_PASSWORD")
+	mfaPasscode = resolveConfig(mfaPasscode, "VAULT_MFA_PASSCODE")
+	cfg.DopplerToken = resolveConfig(cfg.DopplerToken, "DOPPLER_TOKEN")
+	cfg.InfisicalToken = resolveConfig(cfg.InfisicalToken, "INFISICAL_TOKEN")
+	cfg.GCPProject = resolveConfig(cfg.GCPProject, "GOOGLE_CLOUD_PROJECT")
+	cfg.OnePasswordHost = resolveConfig(cfg.OnePasswordHost, "OP_CONNECT_HOST")
+	cfg.OnePasswordToken = resolveConfig(cfg.OnePasswordToken, "OP_CONNECT_TOKEN")
+
+	// Validate required config (unless not talking to Vault)
+	needsVault := (!cfg.DryRun || cfg.Diff || cfg.Sync || reverse) && !simulate && !cfg.GitHubMask && !cfg.ExportEnv && cfg.OutputFormat != formatTerraform && cfg.CDKContextFile == "" && cfg.PolicyFile == "" && cfg.Backend == backendVault
+	if needsVault {
+		if cfg.VaultAddr == "" {
+			fmt.Fprintln(os.Stderr, "Error: Vault address required (--vault-addr or VAULT_ADDR)")
+			os.Exit(1)
+		}
+		if cfg.VaultSkipVerify {
+			fmt.Fprint(os.Stderr, tlsSkipVerifyWarning)
+		}
+		if err := checkTLSFiles(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if jwtToken != "" {
+			if jwtRole == "" {
+				fmt.Fprintln(os.Stderr, "Error: --vault-jwt-role is required with --vault-jwt-token")
+				os.Exit(1)
+			}
+			token, err := loginJWT(cfg.vaultConn(), jwtAuthPath, jwtRole, jwtToken)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			cfg.VaultToken = token
+		}
+		if roleID != "" || secretID != "" {
+			if roleID == "" || secretID == "" {
+				fmt.Fprintln(os.Stderr, "Error: --vault-role-id and --vault-secret-id must be used together")
+				os.Exit(1)
+			}
+			if cfg.VaultToken != "" {
+				fmt.Fprintln(os.Stderr, "Error: AppRole login and a Vault token are mutually exclusive; unset the token (--vault-token, --vault-token-file, VAULT_TOKEN, VAULT_TOKEN_FILE) or the role/secret IDs")
+				os.Exit(1)
+			}
+			token, err := loginAppRole(cfg.vaultConn(), roleID, secretID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			cfg.VaultToken = token
+		}
+		if ldapUsername != "" || ldapPassword != "" {
+			if ldapUsername == "" || ldapPassword == "" {
+				fmt.Fprintln(os.Stderr, "Error: --vault-ldap-username and --vault-ldap-password must be used together")
+				os.Exit(1)
+			}
+			if cfg.VaultToken != "" {
+				fmt.Fprintln(os.Stderr, "Error: LDAP login can't be combined with a Vault token or another login method")
+				os.Exit(1)
+			}
+			passcode := func() (string, error) {
+				if mfaPasscode != "" {
+					return mfaPasscode, nil
+				}
+				return promptPasscode(os.Stdin, os.Stderr)
+			}
+			token, err := loginLDAP(cfg.vaultConn(), ldapUsername, ldapPassword, passcode)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			cfg.VaultToken = token
+		}
+		if k8sRole != "" {
+			if cfg.VaultToken != "" {
+				fmt.Fprintln(os.Stderr, "Error: Kubernetes login can't be combined with a Vault token or another login method")
+				os.Exit(1)
+			}
+			token, err := loginKubernetes(cfg.vaultConn(), k8sRole, k8sJWTPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			cfg.VaultToken = token
+		}
+		if cfg.VaultToken == "" {
+			// Like the Vault CLI, fall back to the token saved by `vault login`
+			if token, path := readHomeVaultToken(); token != "" {
+				fmt.Fprintf(os.Stderr, "Using Vault token from %s\n", path)
+				cfg.VaultToken = token
+			}
+		}
+		if cfg.VaultToken == "" {
+			fmt.Fprintln(os.Stderr, "Error: Vault token required (--vault-token, --vault-token-file, VAULT_TOKEN, VAULT_TOKEN_FILE, or ~/.vault-token)")
+			os.Exit(1)
+		}
+		if mountAutoDetect {
+			client, err := cfg.newVaultClient()
+			if err == nil {
+				cfg.KVVersion, err = client.DetectKVVersion()
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: detecting the KV version of --mount: %v\n", err)
+				os.Exit(1)
+			}
+			if cfg.KVVersion == 1 && (cfg.CAS || len(cfg.Tags) > 0) {
+				fmt.Fprintf(os.Stderr, "Error: %s is a KV v1 mount, but --cas, --tags, and --label require KV v2\n", cfg.Mount)
+				os.Exit(1)
+			}
+		}
+	}
+
+	ctx := context.Background()
+	if gracefulInterrupt {
+		var stop context.CancelFunc
+		ctx, stop = notifyInterrupt()
+		defer stop()
+	}
+
+	if listMode {
+		client, err := cfg.newVaultClient()
+		if err == nil {
+			var entries []listEntry
+			if entries, err = listSecrets(client, cfg.envPath(flag.Arg(0)), listVersions); err == nil {
+				err = printList(os.Stdout, cfg.OutputFormat, cfg.Mount, cfg.envPath(flag.Arg(0)), entries)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Report on the token once, before any file is processed (dry runs
+	// included), on stderr so stdout output formats stay clean
+	if cfg.ShowTokenExpiry && cfg.Backend == backendVault && !simulate {
+		client, err := cfg.newVaultClient()
+		var info *TokenInfo
+		if err == nil {
+			info, err = client.WhoAmI()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		} else {
+			msg, low := describeTokenExpiry(info, cfg.MinTokenTTL)
+			fmt.Fprintln(os.Stderr, msg)
+			if low {
+				fmt.Fprintf(os.Stderr, "Warning: Vault token TTL %s is below --min-token-ttl %s\n", formatTTL(int(info.TTL.Seconds())), cfg.MinTokenTTL)
+			}
+		}
+	}
+
+	// Keep the token alive through long imports: follow the agent's sink,
+	// or renew the token ourselves
+	stopRenewal := func() {}
+	if needsVault && cfg.TokenSink != nil {
+		stop, err := cfg.TokenSink.watch(os.Stderr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; new tokens from the agent won't be picked up\n", err)
+		} else {
+			stopRenewal = stop
+		}
+	} else if needsVault && !noTokenRenew {
+		if client, err := cfg.newVaultClient(); err == nil {
+			if info, err := client.WhoAmI(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v; not renewing the token\n", err)
+			} else if info.Renewable && info.TTL > 0 {
+				stopRenewal = startTokenRenewal(client, info.TTL, os.Stderr)
+			}
+		}
+	}
+
+	if auditLogFile != "" {
+		var err error
+		if cfg.AuditLog, err = openAuditLog(auditLogFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	// With --otel-endpoint, the whole run is traced under one root span
+	shutdownTracing := func(context.Context) error { return nil }
+	if otelEndpoint != "" {
+		var err error
+		if shutdownTracing, err = setupTracing(ctx, otelEndpoint); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	ctx, rootSpan := tracer.Start(ctx, tracingServiceName)
+
+	// exit stops the token renewal, closes the audit log so it holds every
+	// write, and flushes the trace before exiting
+	exit := func(code int) {
+		stopRenewal()
+		var runErr error
+		if code != 0 {
+			runErr = fmt.Errorf("exit status %d", code)
+		}
+		endSpan(rootSpan, runErr)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: exporting traces: %v\n", err)
+		}
+		cancel()
+		if err := cfg.AuditLog.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			if code == 0 {
+				code = 1
+			}
+		}
+		os.Exit(code)
+	}
+
+	if dir != "" {
+		entries, err := dirEntries(dir, flag.Arg(0), splitList(dirGlob), cfg.StripSuffixes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		errs := processEntries(ctx, entries, cfg, cfg.Parallelism)
+		summary := os.Stdout
+		if cfg.OutputFormat == formatJSON {
+			summary = os.Stderr
+		}
+		printDirSummary(summary, cfg.Mount, entries, errs)
+		for _, err := range errs {
+			if errors.Is(err, errInterrupted) {
+				exit(130)
+			}
+		}
+		exit(batchExitCode(errs, cfg.IgnoreMissingSopsKey))
+	}
+
+	if batchFile != "" || manifestFile != "" {
+		var entries []BatchEntry
+		var err error
+		if manifestFile != "" {
+			entries, err = loadManifest(manifestFile, cfg)
+		} else if entries, err = loadBatchFile(batchFile); err != nil {
+			err = fmt.Errorf("loading batch file: %w", err)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		errs := processBatchConcurrent(ctx, entries, cfg, batchConcurrency)
+		interrupted := false
+		for _, err := range errs {
+			if errors.Is(err, errInterrupted) {
+				interrupted = true
+				continue
+			}
+			if cfg.IgnoreMissingSopsKey && errors.Is(err, errMissingSopsKey) {
+				fmt.Fprintf(os.Stderr, "Warning: skipped, %v\n", err)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		summary := os.Stdout
+		if cfg.OutputFormat == formatJSON {
+			summary = os.Stderr
+		}
+		fmt.Fprintf(summary, "Processed %d files (%d failed)\n", len(entries), len(errs))
+		if interrupted {
+			exit(130)
+		}
+		exit(batchExitCode(errs, cfg.IgnoreMissingSopsKey))
+	}
+
+	if reverse {
+		if err := reverseToSops(cfg, cfg.envPath(flag.Arg(0)), flag.Arg(1)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		exit(0)
+	}
+
+	// --simulate points the client at an in-memory Vault, with no login
+	var simulated *simulatedVault
+	if simulate {
+		simulated = newSimulatedVault(cfg.Mount, cfg.KVVersion)
+		cfg.VaultAddr = simulated.Start()
+		cfg.VaultToken = "simulated"
+		cfg.VaultNamespace, cfg.VaultCACert, cfg.VaultClientCert, cfg.VaultClientKey = "", "", "", ""
+		cfg.TokenSink = nil
+	}
+
+	sopsFiles, vaultPath := args[:len(args)-1], args[len(args)-1]
+	if err := processFiles(ctx, cfg, sopsFiles, vaultPath); err != nil {
+		if errors.Is(err, errInterrupted) {
+			exit(130)
+		}
+		if cfg.IgnoreMissingSopsKey && errors.Is(err, errMissingSopsKey) {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			exit(2)
+		}
+		// The diff itself has already been printed
+		if !errors.Is(err, errDiffFound) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		exit(1)
+	}
+	if simulated != nil {
+		fmt.Fprintln(os.Stderr, "Simulated Vault state:")
+		if err := simulated.PrintState(os.Stdout, cfg.MaskValueLength); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	}
+	exit(0)
+}
+
+// processFile imports a single SOPS file into vaultPath. Problems that don't
+// affect the secrets themselves (counterpart updates, backups) are reported as
+// warnings rather than errors.
+func processFile(ctx context.Context, cfg Config, sopsFile, vaultPath string) error {
+	return processFiles(ctx, cfg, []string{sopsFile}, vaultPath)
+}
+
+// processFiles is processFile for the merged secrets of several SOPS files
+// (--merge), later files overriding earlier ones. The first file stands in
+// for the rest wherever one file is needed: its name for --append-name, its
+// counterpart, and its master keys for --output-encrypted-json.
+func processFiles(ctx context.Context, cfg Config, sopsFiles []string, vaultPath string) error {
+	if cfg.Separator == "" {
+		cfg.Separator = defaultSeparator
+	}
+	if cfg.VaultKeyName == "" {
+		cfg.VaultKeyName = defaultValueField
+	}
+	sopsFile := sopsFiles[0]
+
+	// A --vault-path-template places the environment itself, with {{.Env}}
+	if cfg.PathTemplate == nil {
+		vaultPath = cfg.envPath(vaultPath)
+	}
+
+	// Append cleaned filename to vault path if requested
+	name := cfg.NameOverride
+	if name == "" {
+		name = cleanFilename(sopsFile, cfg.StripSuffixes)
+	}
+	if cfg.AppendName {
+		vaultPath = vaultPath + "/" + name
+	}
+
+	var flattened map[string]interface{}
+	var err error
+	if len(sopsFiles) == 1 {
+		if flattened, err = decryptSopsFile(ctx, cfg, sopsFile); err != nil {
+			return err
+		}
+		// Only the rotated keys are written, with their new values
+		if len(cfg.RotateKeys) > 0 {
+			if flattened, err = rotateKeys(cfg, sopsFile, flattened, cfg.RotateKeys, cfg.DryRun); err != nil {
+				return err
+			}
+			if cfg.DryRun {
+				fmt.Fprintf(os.Stderr, "[dry-run] Would rotate %d keys in %s\n", len(flattened), sopsFile)
+			} else {
+				fmt.Fprintf(os.Stderr, "Rotated %d keys in %s\n", len(flattened), sopsFile)
+			}
+		}
+	} else {
+		files := make([]map[string]interface{}, len(sopsFiles))
+		for i, f := range sopsFiles {
+			if files[i], err = decryptSopsFile(ctx, cfg, f); err != nil {
+				return fmt.Errorf("%s: %w", f, err)
+			}
+		}
+		var conflicts []mergeConflict
+		flattened, conflicts = mergeFlattened(files)
+		for _, c := range conflicts {
+			fmt.Fprintf(os.Stderr, "Warning: key %s from %s overrides %s\n", c.Key, sopsFiles[c.File], sopsFiles[c.Overridden])
+		}
+	}
+
+	// --set values win over the SOPS file's
+	for k, v := range cfg.Overrides {
+		flattened[k] = v
+	}
+
+	// Warn about (and optionally rename) deprecated keys
+	if cfg.DeprecationFile != "" {
+		deprecations, err := loadDeprecationMap(cfg.DeprecationFile)
+		if err != nil {
+			return fmt.Errorf("loading key deprecation file: %w", err)
+		}
+		for _, w := range applyDeprecations(flattened, deprecations, cfg.DeprecationRename) {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+		}
+	}
+
+	// Rename keys, remembering their names in the SOPS file
+	originalKeys := make(map[string]string)
+	if cfg.KeyRenameFile != "" {
+		renames, err := loadKeyRenameMap(cfg.KeyRenameFile)
+		if err != nil {
+			return fmt.Errorf("loading key rename map: %w", err)
+		}
+		var renamed map[string]string
+		var unused []string
+		if flattened, renamed, unused, err = renameKeys(flattened, renames); err != nil {
+			return err
+		}
+		recordRenames(originalKeys, renamed)
+		for _, k := range unused {
+			fmt.Fprintf(os.Stderr, "Warning: --key-rename-map entry %s doesn't match any key\n", k)
+		}
+	}
+	if cfg.PrefixStrip != "" {
+		var stripped map[string]string
+		var unchanged []string
+		if flattened, stripped, unchanged, err = stripKeyPrefix(flattened, cfg.PrefixStrip); err != nil {
+			return err
+		}
+		recordRenames(originalKeys, stripped)
+		for _, k := range unchanged {
+			fmt.Fprintf(os.Stderr, "Warning: key %s doesn't start with --prefix-strip %q, writing it unchanged\n", k, cfg.PrefixStrip)
+		}
+	}
+	if cfg.TransformKeys != "" && cfg.TransformKeys != transformNone {
+		var transformed map[string]string
+		if flattened, transformed, err = transformKeys(flattened, cfg.TransformKeys, cfg.Separator); err != nil {
+			return err
+		}
+		recordRenames(originalKeys, transformed)
+	}
+	if cfg.PathLowercase {
+		var lowercased map[string]string
+		var warnings []string
+		flattened, lowercased, warnings = lowercaseKeys(flattened)
+		recordRenames(originalKeys, lowercased)
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+		}
+	}
+
+	if cfg.GitHubMask {
+		out, err := openOutput(cfg.OutputFile)
+		if err != nil {
+			return fmt.Errorf("opening output file: %w", err)
+		}
+		printGitHubMasks(out, flattened)
+		if err := out.Close(); err != nil {
+			return fmt.Errorf("writing output file: %w", err)
+		}
+		return nil
+	}
+
+	// Only write the requested keys
+	if len(cfg.PartialUpdateKeys) > 0 {
+		flattened, _, err = filterByExactKeys(flattened, cfg.PartialUpdateKeys)
+		if err != nil {
+			return err
+		}
+	}
+	var filteredOut []string
+	if cfg.KeyFilter != nil || cfg.KeyExclude != nil {
+		flattened, filteredOut = filterByPattern(flattened, cfg.KeyFilter, cfg.KeyExclude)
+	}
+	if cfg.ValidateKeys != "" {
+		if err := validateKeys(flattened, cfg.ValidateKeys, cfg.KeyPattern); err != nil {
+			return err
+		}
+	}
+
+	if cfg.ExportEnv {
+		out, err := openOutput(cfg.OutputFile)
+		if err != nil {
+			return fmt.Errorf("opening output file: %w", err)
+		}
+		printEnvExports(out, flattened)
+		if err := out.Close(); err != nil {
+			return fmt.Errorf("writing output file: %w", err)
+		}
+		return nil
+	}
+
+	if cfg.OutputFormat == formatTerraform {
+		return writeTerraform(cfg.OutputFile, flattened)
+	}
+
+	if cfg.CDKContextFile != "" {
+		if err := updateCDKContext(cfg.CDKContextFile, cfg.CDKContextKey, flattened); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %d secrets to %s under %q\n", len(flattened), cfg.CDKContextFile, cfg.CDKContextKey)
+		return nil
+	}
+
+	// Extract keys in write order: sorted, or as given by the ordering file
+	keys := make([]string, 0, len(flattened))
+	for k := range flattened {
+		keys = append(keys, k)
+	}
+	if cfg.KeyOrderingFile != "" {
+		ordering, err := loadKeyOrdering(cfg.KeyOrderingFile)
+		if err != nil {
+			return fmt.Errorf("loading key ordering file: %w", err)
+		}
+		keys = orderKeys(keys, ordering)
+	} else {
+		sort.Strings(keys)
+	}
+
+	if cfg.Backend != "" && cfg.Backend != backendVault {
+		return writeToBackend(ctx, cfg, vaultPath, keys, flattened)
+	}
+
+	if cfg.ValueTemplate != nil {
+		if flattened, err = applyValueTemplate(cfg.ValueTemplate, flattened); err != nil {
+			return err
+		}
+	}
+	if cfg.CompareHash {
+		flattened = hashValues(flattened)
+	}
+
+	// basePathFor returns the path a key is written under: vaultPath, or
+	// the path --routing-config sends it to
+	basePathFor := func(key string) string {
+		return cfg.Routing.route(key, vaultPath)
+	}
+	// secretPath returns the Vault path (under the mount) for a flattened key
+	secretPath := func(key string) string {
+		if cfg.SplitTopLevel {
+			section, rest := splitTopLevelKey(key, cfg.Separator)
+			return basePathFor(key) + "/" + section + "/" + rest
+		}
+		return basePathFor(key) + "/" + key
+	}
+	if cfg.PathTemplate != nil {
+		rendered, err := renderPathTemplate(cfg.PathTemplate, keys, pathTemplateData{
+			VaultPath: vaultPath,
+			Filename:  name,
+			Mount:     cfg.Mount,
+			Env:       cfg.Env,
+		})
+		if err != nil {
+			return err
+		}
+		secretPath = func(key string) string { return rendered[key] }
+	}
+	// secretRef returns the secret (with the mount) and field holding key
+	secretRef := func(key string) (string, string) {
+		return cfg.Mount + "/" + secretPath(key), cfg.VaultKeyName
+	}
+	refFor := func(key string) string {
+		return vaultRefField(secretRef(key))
+	}
+
+	// Group by section path: each group is one printed dry-run block and,
+	// with --bundle, one Vault secret
+	groups := map[string]map[string]interface{}{vaultPath: flattened}
+	if cfg.Routing != nil {
+		groups = make(map[string]map[string]interface{})
+		for k, v := range flattened {
+			base := basePathFor(k)
+			if groups[base] == nil {
+				groups[base] = make(map[string]interface{})
+			}
+			groups[base][k] = v
+		}
+	}
+	if cfg.PathTemplate != nil {
+		groups = make(map[string]map[string]interface{})
+		for k, v := range flattened {
+			p := secretPath(k)
+			dir, leaf := path.Dir(p), path.Base(p)
+			if groups[dir] == nil {
+				groups[dir] = make(map[string]interface{})
+			}
+			groups[dir][leaf] = v
+		}
+	}
+	if cfg.SplitTopLevel {
+		routed := groups
+		groups = make(map[string]map[string]interface{})
+		for base, group := range routed {
+			for name, section := range splitKeyByTopLevel(group, cfg.Separator) {
+				groups[base+"/"+name] = section
+			}
+		}
+	}
+	paths := make([]string, 0, len(groups))
+	for p := range groups {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	// locationFor describes where a key ends up, for reports
+	locationFor := func(key string) string {
+		return cfg.Mount + "/" + secretPath(key)
+	}
+	// bundleFor returns the --bundle path (under the mount) holding key, and
+	// the key's field within it
+	bundleFor := func(key string) (string, string) {
+		if cfg.SplitTopLevel {
+			section, rest := splitTopLevelKey(key, cfg.Separator)
+			return basePathFor(key) + "/" + section, rest
+		}
+		return basePathFor(key), key
+	}
+	if cfg.Bundle {
+		secretRef = func(key string) (string, string) {
+			p, field := bundleFor(key)
+			return cfg.Mount + "/" + p, field
+		}
+		locationFor = func(key string) string {
+			p, field := bundleFor(key)
+			return cfg.Mount + "/" + p + "#" + field
+		}
+	}
+
+	// Counterpart files mirror the SOPS file, so they are updated under the
+	// original key names, referencing where the renamed keys were written
+	counterpartKeys, currentKey := keys, func(key string) string { return key }
+	if len(originalKeys) > 0 {
+		renamed := make(map[string]string, len(originalKeys))
+		counterpartKeys = make([]string, len(keys))
+		for i, k := range keys {
+			counterpartKeys[i] = k
+			if orig, ok := originalKeys[k]; ok {
+				counterpartKeys[i] = orig
+				renamed[orig] = k
+			}
+		}
+		currentKey = func(key string) string {
+			if k, ok := renamed[key]; ok {
+				return k
+			}
+			return key
+		}
+	}
+	counterpartRef := func(key string) string {
+		return refFor(currentKey(key))
+	}
+	// helmValues writes the --output-format=helm-secrets values file, which
+	// mirrors the SOPS file like a counterpart file does
+	helmValues := func() error {
+		out, err := openOutput(cfg.OutputFile)
+		if err != nil {
+			return fmt.Errorf("opening output file: %w", err)
+		}
+		helmRef := func(key string) string {
+			return helmSecretRef(secretRef(currentKey(key)))
+		}
+		if err := printHelmSecretsValues(out, counterpartKeys, helmRef, cfg.Separator, cfg.FlattenArrays, cfg.HelmReleaseName); err != nil {
+			out.Close()
+			return fmt.Errorf("writing helm-secrets values: %w", err)
+		}
+		if err := out.Close(); err != nil {
+			return fmt.Errorf("writing output file: %w", err)
+		}
+		return nil
+	}
+
+	// Informational output moves to stderr when stdout carries the JSON
+	// report or the helm-secrets values
+	msgs := io.Writer(os.Stdout)
+	if cfg.OutputFormat == formatJSON || (cfg.OutputFormat == formatHelmSecrets && cfg.OutputFile == "") {
+		msgs = os.Stderr
+	}
+
+	if cfg.PolicyFile != "" {
+		policyPaths := make([]string, 0, len(keys))
+		if cfg.Bundle {
+			policyPaths = append(policyPaths, paths...)
+		} else {
+			for _, key := range keys {
+				policyPaths = append(policyPaths, secretPath(key))
+			}
+		}
+		if err := writePolicyFile(cfg.PolicyFile, cfg.Mount, cfg.KVVersion, policyPaths); err != nil {
+			return err
+		}
+		fmt.Fprintf(msgs, "Wrote read policy for %d paths to %s\n", len(policyPaths), cfg.PolicyFile)
+		return nil
+	}
+
+	if cfg.Diff {
+		client, err := cfg.newVaultClient()
+		if err != nil {
+			return fmt.Errorf("creating Vault client: %w", err)
+		}
+		fieldFor := func(key string) (string, string) { return secretPath(key), cfg.VaultKeyName }
+		if cfg.Bundle {
+			fieldFor = bundleFor
+		}
+		entries, err := diffSecrets(client, keys, flattened, fieldFor)
+		if err != nil {
+			return err
+		}
+		printEntries := printDiff
+		if cfg.VerifyOnly {
+			printEntries = printVerify
+		}
+		if printEntries(msgs, entries, locationFor) {
+			return errDiffFound
+		}
+		return nil
+	}
+
+	if cfg.Delete {
+		return deleteFromVault(ctx, cfg, vaultPath, keys, paths, secretPath)
+	}
+
+	// auditPathFor returns the Vault path, with the mount, written for key
+	auditPathFor := func(key string) string {
+		if cfg.Bundle {
+			p, _ := bundleFor(key)
+			return cfg.Mount + "/" + p
+		}
+		return cfg.Mount + "/" + secretPath(key)
+	}
+
+	// With --sync, find the paths of keys no longer in the SOPS file
+	var plan *syncPlan
+	if cfg.Sync {
+		client, err := cfg.newVaultClient()
+		if err != nil {
+			return fmt.Errorf("creating Vault client: %w", err)
+		}
+		targets, depth := paths, 0
+		switch {
+		case cfg.Bundle && cfg.SplitTopLevel:
+			depth = 1
+		case cfg.SplitTopLevel:
+			depth = 2
+		case !cfg.Bundle:
+			depth = 1
+		}
+		if !cfg.Bundle {
+			targets = make([]string, len(keys))
+			for i, k := range keys {
+				targets[i] = secretPath(k)
+			}
+		}
+		if plan, err = planSync(client, vaultPath, depth, targets); err != nil {
+			return err
+		}
+	}
+
+	if cfg.DryRun {
+		if plan != nil {
+			syncOut := msgs
+			if cfg.OutputFormat != formatText {
+				syncOut = os.Stderr
+			}
+			printSyncDryRun(syncOut, cfg.Mount, plan)
+		}
+		for _, k := range keys {
+			cfg.AuditLog.RecordDryRun(auditPathFor(k), k)
+		}
+		if cfg.OutputFormat == formatHelmSecrets {
+			return helmValues()
+		}
+		if cfg.OutputFile != "" {
+			data := make(map[string]interface{}, len(keys))
+			for _, k := range keys {
+				data[k] = flattened[k]
+			}
+			out, err := os.Create(cfg.OutputFile)
+			if err != nil {
+				return fmt.Errorf("opening output file: %w", err)
+			}
+			if err := writeDryRunYAML(out, data, cfg.Separator, cfg.FlattenArrays, cfg.MaskValueLength); err != nil {
+				out.Close()
+				return fmt.Errorf("writing output file: %w", err)
+			}
+			if err := out.Close(); err != nil {
+				return fmt.Errorf("writing output file: %w", err)
+			}
+			fmt.Fprintf(msgs, "[dry-run] Wrote %d secrets that would be written to %s/%s to %s\n", len(keys), cfg.Mount, vaultPath, cfg.OutputFile)
+			return nil
+		}
+		if cfg.OutputFormat == formatJSON {
+			wouldWrite := func(string) string { return statusWouldWrite }
+			return printJSONReport(os.Stdout, newRunReport(cfg.Mount, vaultPath, keys, locationFor, wouldWrite))
+		}
+		if cfg.OutputFormat == formatMarkdown {
+			if cfg.MarkdownTitle != "" {
+				fmt.Printf("## %s\n\n", cfg.MarkdownTitle)
+			}
+			for _, p := range paths {
+				printMarkdownDryRun(os.Stdout, cfg.Mount, p, groups[p], cfg.Bundle)
+			}
+			return nil
+		}
+		for _, p := range paths {
+			if cfg.Bundle {
+				printBundleDryRun(p, cfg.Mount, groups[p], cfg.MaskValueLength)
+			} else {
+				printDryRun(p, cfg.Mount, groups[p], cfg.MaskValueLength)
+			}
+		}
+		for _, k := range filteredOut {
+			fmt.Printf("  [skipped] %s\n", k)
+		}
+		if cfg.Verbose {
+			requestPaths := paths
+			if !cfg.Bundle {
+				requestPaths = make([]string, len(keys))
+				for i, k := range keys {
+					requestPaths[i] = secretPath(k)
+				}
+			}
+			printDryRunRequests(os.Stdout, cfg.VaultAddr, cfg.Mount, cfg.KVVersion, requestPaths)
+		}
+		if cfg.UpdateCounterpart {
+			counterpart := counterpartFor(cfg, sopsFile)
+			if _, err := os.Stat(counterpart); err == nil {
+				fmt.Printf("[dry-run] Would update %s with vault references:\n", counterpart)
+				for _, k := range counterpartKeys {
+					fmt.Printf("  %s: %s\n", k, counterpartRef(k))
+				}
+			} else {
+				fmt.Printf("[dry-run] Counterpart file %s does not exist, skipping\n", counterpart)
+			}
+		}
+		return nil
+	}
+
+	// Write to Vault - each key gets its own path
+	client, err := cfg.newVaultClient()
+	if err != nil {
+		return fmt.Errorf("creating Vault client: %w", err)
 	}
 
-	flag.Parse()
+	opts := writeOptions{
+		Strategy:      cfg.ExistsStrategy,
+		Rollback:      cfg.RollbackOnError,
+		ForceRecreate: cfg.ForceRecreate,
+		Parallelism:   cfg.Parallelism,
+		Retry:         retryPolicy{Attempts: cfg.RetryAttempts, InitialDelay: cfg.RetryInitialDelay},
+		CAS:           cfg.CAS,
+		Field:         cfg.VaultKeyName,
+		Tags:          cfg.Tags,
+	}
+	if cfg.AuditLog != nil {
+		opts.OnWrite = func(key string, err error) {
+			cfg.AuditLog.Record(auditPathFor(key), key, err)
+		}
+	}
+	// With --bundle each group is written as one secret holding all its keys
+	writeKeys, writeData, pathFor := keys, flattened, secretPath
+	if cfg.Bundle {
+		opts.Bundle = true
+		writeKeys, pathFor = paths, func(p string) string { return p }
+		writeData = make(map[string]interface{}, len(groups))
+		for p, group := range groups {
+			writeData[p] = group
+		}
+		if cfg.AuditLog != nil {
+			// Audit each key in a bundle, not the bundle as a whole
+			bundleKeys := make(map[string][]string, len(groups))
+			for _, k := range keys {
+				p, _ := bundleFor(k)
+				bundleKeys[p] = append(bundleKeys[p], k)
+			}
+			opts.OnWrite = func(p string, err error) {
+				for _, k := range bundleKeys[p] {
+					cfg.AuditLog.Record(cfg.Mount+"/"+p, k, err)
+				}
+			}
+		}
+	}
 
-	if flag.NArg() != 2 {
-		flag.Usage()
-		os.Exit(1)
+	if cfg.Atomic {
+		cleanupErrs, err := stageSecrets(ctx, client, writeKeys, writeData, pathFor, opts)
+		for _, cerr := range cleanupErrs {
+			fmt.Fprintf(os.Stderr, "Warning: removing staged secret: %v\n", cerr)
+		}
+		if err != nil {
+			return fmt.Errorf("--atomic trial write failed, nothing was written: %w", err)
+		}
 	}
 
-	sopsFile := flag.Arg(0)
-	vaultPath := flag.Arg(1)
+	if cfg.BackupFile != "" {
+		// Stale paths --sync is about to delete are backed up too
+		var backupPaths []string
+		for _, k := range writeKeys {
+			backupPaths = append(backupPaths, pathFor(k))
+		}
+		if plan != nil {
+			backupPaths = append(backupPaths, plan.Stale...)
+		}
+		backedUp, err := backupSecrets(client, cfg.Mount, backupPaths, cfg.BackupFile)
+		if err != nil {
+			return fmt.Errorf("backing up existing secrets: %w", err)
+		}
+		fmt.Fprintf(msgs, "Backed up %d existing secrets to %s\n", backedUp, cfg.BackupFile)
+	}
 
-	// Append cleaned filename to vault path if requested
-	if *appendName {
-		name := *nameOverride
-		if name == "" {
-			name = cleanFilename(sopsFile)
+	var bar *progressBar
+	if cfg.Progress && len(writeKeys) > 0 {
+		bar = newProgressBar(os.Stderr, len(writeKeys), isTerminal(os.Stderr))
+		opts.Progress = bar.Increment
+	}
+	result, err := writeSecrets(ctx, client, writeKeys, writeData, pathFor, opts)
+	if bar != nil {
+		bar.Finish()
+	}
+	if cfg.OutputFormat == formatJSON {
+		statusFor := result.Status
+		if cfg.Bundle {
+			statusFor = func(key string) string {
+				p, _ := bundleFor(key)
+				return result.Status(p)
+			}
 		}
-		vaultPath = vaultPath + "/" + name
+		if rerr := printJSONReport(os.Stdout, newRunReport(cfg.Mount, vaultPath, keys, locationFor, statusFor)); rerr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: writing JSON report: %v\n", rerr)
+		}
+	}
+	for _, k := range result.Conflicts {
+		fmt.Fprintf(os.Stderr, "Warning: skipped %s/%s: changed in Vault while writing (check-and-set conflict)\n", cfg.Mount, pathFor(k))
+	}
+	if err != nil {
+		if errors.Is(err, errInterrupted) {
+			remaining := len(writeKeys) - len(result.Written) - result.Skipped - result.Failed - len(result.Conflicts)
+			fmt.Fprintf(msgs, "Interrupted: wrote %d secrets to %s/%s/*, %d remaining\n", len(result.Written), cfg.Mount, vaultPath, remaining)
+		} else if result.Failed > 0 {
+			fmt.Fprintf(msgs, "Wrote %d secrets to %s/%s/*, %d failed\n", len(result.Written), cfg.Mount, vaultPath, result.Failed)
+		}
+		if cfg.RollbackOnError && len(result.Written) > 0 {
+			fmt.Fprintf(os.Stderr, "Rolling back %d written secrets\n", len(result.Written))
+			for _, rerr := range rollbackSecrets(client, result, pathFor) {
+				fmt.Fprintf(os.Stderr, "Warning: rollback failed: %v\n", rerr)
+			}
+		}
+		return err
 	}
 
-	// Resolve config with precedence: flags > env vars
-	addr := resolveConfig(*vaultAddr, "VAULT_ADDR")
-	token := resolveToken(*vaultToken)
+	// Stale paths are only deleted once every write has succeeded, so a
+	// failed or interrupted sync never leaves Vault missing both
+	deleted := 0
+	if plan != nil && len(plan.Stale) > 0 {
+		if deleted, err = deleteSecrets(ctx, client, plan.Stale, opts.Retry); err != nil {
+			return fmt.Errorf("deleting stale paths: %w", err)
+		}
+	}
 
-	// Validate required config (unless dry-run)
-	if !*dryRun {
-		if addr == "" {
-			fmt.Fprintln(os.Stderr, "Error: Vault address required (--vault-addr or VAULT_ADDR)")
-			os.Exit(1)
+	written, skipped := len(result.Written), result.Skipped
+	if skipped > 0 {
+		for _, k := range writeKeys {
+			if result.Status(k) == statusSkipped {
+				fmt.Fprintf(msgs, "  [skipped-exists] %s/%s\n", cfg.Mount, pathFor(k))
+			}
 		}
-		if token == "" {
-			fmt.Fprintln(os.Stderr, "Error: Vault token required (--vault-token, VAULT_TOKEN, or VAULT_TOKEN_FILE)")
-			os.Exit(1)
+	}
+
+	if cfg.ReadVerify {
+		mismatches, err := verifySecrets(client, result, writeData, pathFor, opts)
+		if err != nil {
+			return fmt.Errorf("read-verify: %w", err)
+		}
+		for _, m := range mismatches {
+			fmt.Fprintf(os.Stderr, "Warning: read-verify mismatch at %s\n", m)
+		}
+		if len(mismatches) > 0 && cfg.Strict {
+			return fmt.Errorf("read-verify found %d mismatched secrets", len(mismatches))
+		}
+	}
+
+	if cfg.Bundle {
+		bundled := 0
+		for _, p := range result.Written {
+			bundled += len(groups[p])
+		}
+		fmt.Fprintf(msgs, "Successfully wrote %d secrets as %d bundled Vault secrets under %s/%s", bundled, written, cfg.Mount, vaultPath)
+		if skipped > 0 {
+			fmt.Fprintf(msgs, " (%d existing skipped)", skipped)
+		}
+		fmt.Fprintln(msgs)
+	} else if skipped > 0 {
+		fmt.Fprintf(msgs, "Successfully wrote %d secrets to %s/%s/* (%d existing skipped)\n", written, cfg.Mount, vaultPath, skipped)
+	} else {
+		fmt.Fprintf(msgs, "Successfully wrote %d secrets to %s/%s/*\n", written, cfg.Mount, vaultPath)
+	}
+
+	if plan != nil {
+		writtenPaths := make([]string, len(result.Written))
+		for i, k := range result.Written {
+			writtenPaths[i] = pathFor(k)
+		}
+		added, updated := plan.Summary(writtenPaths)
+		fmt.Fprintf(msgs, "Sync: %d added, %d updated, %d deleted\n", added, updated, deleted)
+	}
+
+	if cfg.OutputFormat == formatHelmSecrets {
+		if err := helmValues(); err != nil {
+			return err
+		}
+	}
+
+	// Save an encrypted JSON copy of what was written, using the same master keys
+	if cfg.EncryptedJSON != "" {
+		format := cfg.Format
+		if format == "" {
+			format = detectFormat(sopsFile)
+		}
+		sopsArgs, err := sopsKeyArgs(sopsFile, format)
+		if err == nil {
+			err = reencryptAsJSON(flattened, cfg.EncryptedJSON, sopsArgs)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to write encrypted JSON: %v\n", err)
+		} else {
+			fmt.Fprintf(msgs, "Wrote encrypted JSON copy to %s\n", cfg.EncryptedJSON)
+		}
+	}
+
+	// Update counterpart file if requested
+	if cfg.UpdateCounterpart {
+		counterpart := counterpartFor(cfg, sopsFile)
+		absCounterpart, _ := filepath.Abs(counterpart)
+		update := updateCounterpartRefs
+		switch filepath.Ext(counterpart) {
+		case ".toml":
+			update = updateTOMLCounterpartRefs
+		case ".env":
+			update = updateDotenvCounterpartRefs
+		case ".json":
+			update = updateJSONCounterpartRefs
+		}
+		updated, err := update(counterpart, counterpartKeys, counterpartRef, cfg.Separator)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to update counterpart file: %v\n", err)
+		} else if updated {
+			fmt.Fprintf(msgs, "Updated %s with %d vault references\n", absCounterpart, len(keys))
+		} else {
+			fmt.Fprintf(msgs, "Counterpart file %s does not exist, skipping\n", absCounterpart)
+		}
+	}
+
+	return nil
+}
+
+// errMissingSopsKey marks a decryption that failed because none of the SOPS
+// file's master keys is available locally, as opposed to a corrupt file or
+// bad arguments. --ignore-missing-sops-key exits 2 for it.
+var errMissingSopsKey = errors.New("no valid key found")
+
+// isMissingSopsKeyError reports whether err, from sops, means no key group
+// could be decrypted with the key material available.
+func isMissingSopsKeyError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"no valid key found", "error getting data key", "failed to get the data key"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// decryptSopsFile reads, verifies, and decrypts a SOPS file and returns its
+// secrets flattened, tracing the decryption and the flattening as spans of
+// ctx's.
+func decryptSopsFile(ctx context.Context, cfg Config, sopsFile string) (map[string]interface{}, error) {
+	// Read the SOPS file once so the verified bytes are the ones decrypted
+	encrypted, err := readSopsFile(sopsFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading SOPS file: %w", err)
+	}
+
+	if cfg.SopsFileHash != "" {
+		if err := verifySopsHash(encrypted, cfg.SopsFileHash); err != nil {
+			return nil, err
 		}
 	}
 
+	format := cfg.Format
+	if format == "" {
+		format = detectFormat(sopsFile)
+	}
+
 	// Decrypt SOPS file
-	decrypted, err := decrypt.File(sopsFile, "yaml")
+	_, span := tracer.Start(ctx, "decrypt", trace.WithAttributes(attribute.String(attrSopsFile, sopsFile)))
+	decrypted, err := decryptWithAgeKeyFile(cfg.AgeKeyFile, func() ([]byte, error) {
+		return decryptData(encrypted, sopsFormat(format))
+	})
+	endSpan(span, err)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error decrypting SOPS file: %v\n", err)
-		os.Exit(1)
+		if isMissingSopsKeyError(err) {
+			return nil, fmt.Errorf("decrypting SOPS file: %w: %w", errMissingSopsKey, err)
+		}
+		return nil, fmt.Errorf("decrypting SOPS file: %w", err)
 	}
 
-	// Parse YAML
-	var data map[string]interface{}
-	if err := yaml.Unmarshal(decrypted, &data); err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing YAML: %v\n", err)
-		os.Exit(1)
+	data, err := parseDecrypted(decrypted, format)
+	if err != nil {
+		return nil, err
 	}
 
 	// Flatten nested structure
-	flattened := Flatten(data)
+	_, span = tracer.Start(ctx, "flatten")
+	flatten := FlattenWithOptions
+	if cfg.FlattenArrays {
+		flatten = FlattenWithArraySupport
+	}
+	flat, err := flatten(data, cfg.Separator, cfg.MaxDepth)
+	span.SetAttributes(attribute.Int(attrKeyCount, len(flat)))
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.IncludeSopsMetadata {
+		flat = dropSopsMetadata(flat, cfg.Separator)
+	}
+	if cfg.JSONEncodeComplex {
+		if err := encodeComplexValues(flat); err != nil {
+			return nil, err
+		}
+	}
+	return flat, nil
+}
 
-	// Extract sorted keys for counterpart updates
-	keys := make([]string, 0, len(flattened))
-	for k := range flattened {
-		keys = append(keys, k)
+// stdinArg is the sops-file argument that reads the SOPS file from stdin.
+const stdinArg = "-"
+
+// readSopsFile reads the SOPS file at path, or from stdin if path is "-". A
+// terminal on stdin is an error rather than a wait for input.
+func readSopsFile(path string) ([]byte, error) {
+	if path != stdinArg {
+		return os.ReadFile(path)
+	}
+	if isTerminal(os.Stdin) {
+		return nil, errors.New("stdin is a terminal; pipe the SOPS file in, e.g. cat secrets.enc.yaml | sops-to-vault - <vault-path>")
 	}
-	sort.Strings(keys)
+	return io.ReadAll(os.Stdin)
+}
 
-	if *dryRun {
-		printDryRun(vaultPath, *mountPath, flattened)
-		if *updateCounterpart {
-			counterpart := counterpartFilename(sopsFile)
-			fullVaultPath := *mountPath + "/" + vaultPath
-			if _, err := os.Stat(counterpart); err == nil {
-				fmt.Printf("[dry-run] Would update %s with vault references:\n", counterpart)
-				for _, k := range keys {
-					fmt.Printf("  %s: ref+vault://%s/%s#value\n", k, fullVaultPath, k)
-				}
-			} else {
-				fmt.Printf("[dry-run] Counterpart file %s does not exist, skipping\n", counterpart)
-			}
+// writeToBackend writes (or, in dry-run, describes) the secrets for a
+// non-Vault backend.
+func writeToBackend(ctx context.Context, cfg Config, basePath string, keys []string, data map[string]interface{}) error {
+	// A dry run never connects to the backend, so it needs no credentials
+	if cfg.DryRun {
+		location := backendLocation(cfg)
+		fmt.Printf("[dry-run] Would write %d secrets to %s:\n", len(keys), cfg.Backend)
+		for _, k := range keys {
+			fmt.Printf("  %s = %s\n", location(basePath, k), maskValue(data[k], cfg.MaskValueLength))
 		}
-		return
+		return nil
 	}
 
-	// Write to Vault - each key gets its own path
-	client, err := NewVaultClient(addr, token, *mountPath)
+	backend, err := newBackend(ctx, cfg)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating Vault client: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("creating %s backend: %w", cfg.Backend, err)
 	}
 
-	for _, key := range keys {
-		secretPath := vaultPath + "/" + key
-		if err := client.WriteKVv2(secretPath, flattened[key]); err != nil {
-			fmt.Fprintf(os.Stderr, "Error writing to Vault path %s: %v\n", secretPath, err)
-			os.Exit(1)
+	written, err := backend.WriteSecrets(ctx, basePath, keys, data)
+	if err != nil {
+		return err
+	}
+	// Keep stdout clean when the Kubernetes manifest is printed there
+	msgs := io.Writer(os.Stdout)
+	if cfg.Backend == backendK8s && cfg.OutputFile == "" && !cfg.K8sApply {
+		msgs = os.Stderr
+	}
+	fmt.Fprintf(msgs, "Successfully wrote %d secrets to %s\n", written, cfg.Backend)
+	return nil
+}
+
+// deleteFromVault handles --delete: it removes the Vault path of every key
+// (or every bundle path with --bundle) instead of writing them.
+func deleteFromVault(ctx context.Context, cfg Config, vaultPath string, keys, bundlePaths []string, secretPath func(string) string) error {
+	targets := bundlePaths
+	if !cfg.Bundle {
+		targets = make([]string, len(keys))
+		for i, k := range keys {
+			targets[i] = secretPath(k)
 		}
 	}
 
-	fmt.Printf("Successfully wrote %d secrets to %s/%s/*\n", len(flattened), *mountPath, vaultPath)
+	if cfg.DryRun {
+		fmt.Printf("[dry-run] Would delete %d Vault paths (all versions):\n", len(targets))
+		for _, p := range targets {
+			fmt.Printf("  %s/%s\n", cfg.Mount, p)
+		}
+		return nil
+	}
 
-	// Update counterpart file if requested
-	if *updateCounterpart {
-		counterpart := counterpartFilename(sopsFile)
-		absCounterpart, _ := filepath.Abs(counterpart)
-		fullVaultPath := *mountPath + "/" + vaultPath
-		updated, err := updateCounterpartFile(counterpart, fullVaultPath, keys)
+	client, err := cfg.newVaultClient()
+	if err != nil {
+		return fmt.Errorf("creating Vault client: %w", err)
+	}
+
+	deleted, err := deleteSecrets(ctx, client, targets, retryPolicy{Attempts: cfg.RetryAttempts, InitialDelay: cfg.RetryInitialDelay})
+	if err != nil {
+		if errors.Is(err, errInterrupted) {
+			fmt.Printf("Interrupted: deleted %d paths under %s/%s, %d remaining\n", deleted, cfg.Mount, vaultPath, len(targets)-deleted)
+		}
+		return err
+	}
+	fmt.Printf("Successfully deleted %d paths under %s/%s\n", deleted, cfg.Mount, vaultPath)
+	return nil
+}
+
+// checkTLSFiles checks that the Vault TLS files given are readable, and that
+// a client certificate and key are given together.
+func checkTLSFiles(cfg Config) error {
+	if (cfg.VaultClientCert == "") != (cfg.VaultClientKey == "") {
+		return fmt.Errorf("--vault-tls-client-cert and --vault-tls-client-key must be used together")
+	}
+	for _, f := range []struct{ flag, path string }{
+		{"--vault-tls-ca-cert", cfg.VaultCACert},
+		{"--vault-tls-client-cert", cfg.VaultClientCert},
+		{"--vault-tls-client-key", cfg.VaultClientKey},
+	} {
+		if f.path == "" {
+			continue
+		}
+		file, err := os.Open(f.path)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to update counterpart file: %v\n", err)
-		} else if updated {
-			fmt.Printf("Updated %s with %d vault references\n", absCounterpart, len(keys))
-		} else {
-			fmt.Printf("Counterpart file %s does not exist, skipping\n", absCounterpart)
+			return fmt.Errorf("%s: %w", f.flag, err)
+		}
+		file.Close()
+	}
+	return nil
+}
+
+// loginJWT exchanges a JWT (or a file containing one) for a Vault token.
+func loginJWT(conn vaultConn, authPath, role, jwtOrFile string) (string, error) {
+	jwt, err := resolveJWT(jwtOrFile)
+	if err != nil {
+		return "", err
+	}
+	client, err := newAPIClient(conn)
+	if err != nil {
+		return "", err
+	}
+	return authenticateJWT(client, authPath, role, jwt)
+}
+
+// loginAppRole exchanges an AppRole role ID and secret ID for a Vault token.
+func loginAppRole(conn vaultConn, roleID, secretID string) (string, error) {
+	client, err := newAPIClient(conn)
+	if err != nil {
+		return "", err
+	}
+	return authenticateAppRole(client, roleID, secretID)
+}
+
+// loginLDAP exchanges an LDAP username and password for a Vault token.
+// passcode supplies the one-time passcode if the login requires MFA.
+func loginLDAP(conn vaultConn, username, password string, passcode func() (string, error)) (string, error) {
+	client, err := newAPIClient(conn)
+	if err != nil {
+		return "", err
+	}
+	return authenticateLDAP(client, username, password, passcode)
+}
+
+// promptPasscode asks for an MFA passcode on w and reads it from r.
+func promptPasscode(r io.Reader, w io.Writer) (string, error) {
+	fmt.Fprint(w, "Vault MFA passcode: ")
+	line, _ := bufio.NewReader(r).ReadString('\n')
+	code := strings.TrimSpace(line)
+	if code == "" {
+		return "", errors.New("no passcode entered")
+	}
+	return code, nil
+}
+
+// k8sServiceAccountTokenPath is where Kubernetes mounts a pod's service
+// account token.
+const k8sServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// loginKubernetes exchanges the service account token in jwtPath for a Vault
+// token.
+func loginKubernetes(conn vaultConn, role, jwtPath string) (string, error) {
+	jwt, err := os.ReadFile(jwtPath)
+	if err != nil {
+		return "", fmt.Errorf("reading service account token: %w", err)
+	}
+	client, err := newAPIClient(conn)
+	if err != nil {
+		return "", err
+	}
+	return authenticateKubernetes(client, role, strings.TrimSpace(string(jwt)))
+}
+
+// loadKeyOrdering reads a YAML list of key names.
+func loadKeyOrdering(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ordering []string
+	if err := yaml.Unmarshal(content, &ordering); err != nil {
+		return nil, fmt.Errorf("parsing YAML: %w", err)
+	}
+	return ordering, nil
+}
+
+// orderKeys returns keys with those listed in ordering first, in that order,
+// followed by the rest sorted alphabetically. Entries in ordering that aren't
+// in keys are ignored.
+func orderKeys(keys []string, ordering []string) []string {
+	remaining := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		remaining[k] = true
+	}
+
+	result := make([]string, 0, len(keys))
+	for _, k := range ordering {
+		if remaining[k] {
+			result = append(result, k)
+			delete(remaining, k)
+		}
+	}
+
+	rest := make([]string, 0, len(remaining))
+	for k := range remaining {
+		rest = append(rest, k)
+	}
+	sort.Strings(rest)
+
+	return append(result, rest...)
+}
+
+// parseTags parses a --tags value: comma-separated key=value pairs.
+func parseTags(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, pair := range splitList(s) {
+		key, value, ok := strings.Cut(pair, "=")
+		if key = strings.TrimSpace(key); !ok || key == "" {
+			return nil, fmt.Errorf("invalid tag %q (expected key=value)", pair)
 		}
+		tags[key] = strings.TrimSpace(value)
 	}
+	return tags, nil
 }
 
 func resolveConfig(flagVal, envVar string) string {
@@ -149,6 +2228,23 @@ func resolveConfig(flagVal, envVar string) string {
 	return os.Getenv(envVar)
 }
 
+// resolveBoolConfig is resolveConfig for a boolean flag: the environment
+// variable, parsed as by strconv.ParseBool, only applies if the flag is false.
+func resolveBoolConfig(flagVal bool, envVar string) (bool, error) {
+	if flagVal {
+		return true, nil
+	}
+	value := os.Getenv(envVar)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q (expected true or false)", envVar, value)
+	}
+	return b, nil
+}
+
 func resolveToken(flagVal string) string {
 	if flagVal != "" {
 		return flagVal
@@ -157,58 +2253,162 @@ func resolveToken(flagVal string) string {
 		return token
 	}
 	if tokenFile := os.Getenv("VAULT_TOKEN_FILE"); tokenFile != "" {
-		data, err := os.ReadFile(tokenFile)
+		token, err := readTokenFile(tokenFile)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: failed to read VAULT_TOKEN_FILE %s: %v\n", tokenFile, err)
 			return ""
 		}
-		return strings.TrimSpace(string(data))
+		return token
 	}
 	return ""
 }
 
-func printDryRun(path, mount string, data map[string]interface{}) {
-	fmt.Printf("[dry-run] Would write to Vault path: %s/%s\n", mount, path)
-	fmt.Printf("[dry-run] %d secrets:\n", len(data))
+// readTokenFile reads a Vault token from path, trimming surrounding
+// whitespace. An empty file is an error.
+func readTokenFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return token, nil
+}
 
-	// Sort keys for consistent output
-	keys := make([]string, 0, len(data))
-	for k := range data {
-		keys = append(keys, k)
+// readHomeVaultToken returns the token in ~/.vault-token, where `vault login`
+// saves it, and the file's path. The token is empty if there is no such file.
+func readHomeVaultToken() (string, string) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", ""
+	}
+	path := filepath.Join(home, ".vault-token")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", path
 	}
-	sort.Strings(keys)
+	return strings.TrimSpace(string(data)), path
+}
 
-	for _, k := range keys {
-		v := data[k]
-		// Mask values, show only type/length for security
-		switch val := v.(type) {
-		case string:
-			fmt.Printf("  %s = <string, %d chars>\n", k, len(val))
-		default:
-			fmt.Printf("  %s = <%T>\n", k, v)
-		}
+// hashFile returns the hex-encoded SHA256 of the file at path.
+func hashFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading file: %w", err)
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// verifySopsHash checks content against an expected hex-encoded SHA256.
+func verifySopsHash(content []byte, expected string) error {
+	sum := sha256.Sum256(content)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), strings.TrimSpace(expected)) {
+		return fmt.Errorf("SOPS file hash mismatch (file may have been modified)")
+	}
+	return nil
+}
+
+// valueHashPrefix starts each value written with --compare-hash.
+const valueHashPrefix = "sha256:"
+
+// hashValues returns data with each value replaced by "sha256:" and the
+// hex-encoded SHA256 of the value as it would be written.
+func hashValues(data map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		sum := sha256.Sum256([]byte(formatValue(v)))
+		result[k] = valueHashPrefix + hex.EncodeToString(sum[:])
+	}
+	return result
+}
+
+// openOutput opens path for writing, or returns stdout if path is empty.
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == "" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// describeTokenExpiry returns a human-readable expiry line for the token and
+// whether its TTL is below minTTL. Tokens without expiry are never low.
+func describeTokenExpiry(info *TokenInfo, minTTL time.Duration) (string, bool) {
+	if info.TTL == 0 {
+		return "Token has no expiration", false
 	}
+	msg := fmt.Sprintf("Vault token expires in: %s (at %s)", formatTTL(int(info.TTL.Seconds())), info.ExpireTime.Format(time.RFC3339))
+	return msg, info.TTL < minTTL
 }
 
-// cleanFilename extracts a clean name from a SOPS filename.
+// formatTTL formats a TTL in seconds compactly.
+// Examples:
+//   - 16320 -> "4h32m"
+//   - 90 -> "1m30s"
+//   - 45 -> "45s"
+func formatTTL(seconds int) string {
+	h := seconds / 3600
+	m := (seconds % 3600) / 60
+	s := seconds % 60
+	switch {
+	case h > 0:
+		return fmt.Sprintf("%dh%dm", h, m)
+	case m > 0:
+		return fmt.Sprintf("%dm%ds", m, s)
+	default:
+		return fmt.Sprintf("%ds", s)
+	}
+}
+
+// defaultStripSuffixes are the suffixes cleanFilename strips when
+// --strip-suffixes isn't given.
+var defaultStripSuffixes = []string{"-secrets", ".enc", ".sops", ".prod", ".staging", ".dev"}
+
+// cleanFilename extracts a clean name from a SOPS filename. The extension is
+// dropped, then the given suffixes (defaultStripSuffixes if nil) are stripped
+// from the end, longest match first, until none is left. Anything after a
+// remaining "." is dropped and the suffixes are stripped once more.
 // Examples:
 //   - "app-secrets.enc.yaml" -> "app"
 //   - "myapp.sops.yaml" -> "myapp"
 //   - "/path/to/config-secrets.yaml" -> "config"
-func cleanFilename(path string) string {
+//   - "web.staging.yaml" -> "web"
+func cleanFilename(path string, suffixes []string) string {
 	// Get base filename without directory
 	name := filepath.Base(path)
 
-	// Strip "-secrets" and everything after
-	if idx := strings.Index(name, "-secrets"); idx != -1 {
-		return name[:idx]
+	if suffixes == nil {
+		suffixes = defaultStripSuffixes
 	}
-
-	// Otherwise strip from first "."
-	if idx := strings.Index(name, "."); idx != -1 {
-		return name[:idx]
+	sorted := append([]string(nil), suffixes...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	strip := func(name string) string {
+		for stripped := true; stripped; {
+			stripped = false
+			for _, suffix := range sorted {
+				if len(name) > len(suffix) && strings.HasSuffix(name, suffix) {
+					name = strings.TrimSuffix(name, suffix)
+					stripped = true
+					break
+				}
+			}
+		}
+		return name
 	}
 
+	if idx := strings.LastIndex(name, "."); idx > 0 {
+		name = name[:idx]
+	}
+	name = strip(name)
+	if idx := strings.Index(name, "."); idx > 0 {
+		name = strip(name[:idx])
+	}
 	return name
 }
 
@@ -216,18 +2416,60 @@ func cleanFilename(path string) string {
 // Examples:
 //   - "app-secrets.enc.yaml" -> "app.yaml"
 //   - "/path/to/config-secrets.yaml" -> "/path/to/config.yaml"
-func counterpartFilename(sopsPath string) string {
+func counterpartFilename(sopsPath string, suffixes []string) string {
 	dir := filepath.Dir(sopsPath)
-	name := cleanFilename(sopsPath)
+	name := cleanFilename(sopsPath, suffixes)
 	return filepath.Join(dir, name+".yaml")
 }
 
+// counterpartFor returns the counterpart file to update for sopsFile: the
+// counterpartFilename with the extension of cfg.CounterpartFormat. Without a
+// format it is the YAML file, unless only a dotenv (.env) one exists.
+func counterpartFor(cfg Config, sopsFile string) string {
+	base := strings.TrimSuffix(counterpartFilename(sopsFile, cfg.StripSuffixes), ".yaml")
+	switch cfg.CounterpartFormat {
+	case inputFormatTOML:
+		return base + ".toml"
+	case inputFormatDotenv:
+		return base + ".env"
+	case inputFormatJSON:
+		return base + ".json"
+	case "":
+		if _, err := os.Stat(base + ".yaml"); os.IsNotExist(err) {
+			if _, err := os.Stat(base + ".env"); err == nil {
+				return base + ".env"
+			}
+		}
+	}
+	return base + ".yaml"
+}
+
 // updateCounterpartFile updates the counterpart YAML file with vault references.
 // For each key in sopsKeys, it sets the value to ref+vault://<vaultPath>#<key>.
 // If the key exists nested in counterpart, it updates nested. Otherwise adds as flat key.
 // Only updates if the file exists. Preserves original formatting and indentation.
 // Returns (updated bool, error).
 func updateCounterpartFile(path, vaultPath string, sopsKeys []string) (bool, error) {
+	return updateCounterpartRefs(path, sopsKeys, func(key string) string {
+		return vaultRef(vaultPath + "/" + key)
+	}, defaultSeparator)
+}
+
+// vaultRef formats a vals-style reference to the secret at fullPath (including the mount).
+func vaultRef(fullPath string) string {
+	return vaultRefField(fullPath, "value")
+}
+
+// vaultRefField builds a vals reference to one field of the secret at
+// fullPath, as used for --bundle secrets.
+func vaultRefField(fullPath, field string) string {
+	return fmt.Sprintf("ref+vault://%s#%s", fullPath, field)
+}
+
+// updateCounterpartRefs is updateCounterpartFile with the reference for each
+// key supplied by refFor, for layouts where a key's path isn't simply
+// <vaultPath>/<key>, and the key segments separated by sep.
+func updateCounterpartRefs(path string, sopsKeys []string, refFor func(key string) string, sep string) (bool, error) {
 	// Check if file exists
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		return false, nil // File doesn't exist, skip silently
@@ -240,7 +2482,10 @@ func updateCounterpartFile(path, vaultPath string, sopsKeys []string) (bool, err
 	}
 
 	// Detect original indentation (default to 2)
-	indent := detectIndent(content)
+	indent, tabs := detectIndent(content)
+	if tabs {
+		fmt.Fprintf(os.Stderr, "Warning: %s is indented with tabs, which YAML doesn't allow\n", path)
+	}
 
 	// Parse YAML into Node to preserve ordering
 	var doc yaml.Node
@@ -262,11 +2507,10 @@ func updateCounterpartFile(path, vaultPath string, sopsKeys []string) (bool, err
 
 	// Update or add each SOPS key
 	for _, key := range sopsKeys {
-		vaultRef := fmt.Sprintf("ref+vault://%s/%s#value", vaultPath, key)
-		keyPath := strings.Split(key, ".")
+		keyPath := strings.Split(key, sep)
 
 		// Try to find and update the key, or add at deepest matching path
-		upsertNestedKey(root, keyPath, vaultRef)
+		upsertNestedKey(root, keyPath, refFor(key), sep)
 	}
 
 	// Write back with original indentation
@@ -285,32 +2529,69 @@ func updateCounterpartFile(path, vaultPath string, sopsKeys []string) (bool, err
 	return true, nil
 }
 
-// detectIndent detects the indentation used in YAML content.
-func detectIndent(content []byte) int {
-	lines := strings.Split(string(content), "\n")
-	for _, line := range lines {
-		trimmed := strings.TrimLeft(line, " ")
-		if len(trimmed) > 0 && len(trimmed) < len(line) {
-			indent := len(line) - len(trimmed)
-			if indent > 0 {
-				return indent
+// detectIndent detects the indentation step used in YAML content by a
+// majority vote over how far each nested line is indented past its parent,
+// counting only steps of 2, 4, or 8 spaces. Blank lines, comments, and the
+// contents of block scalars (| and >) don't vote; ties go to the smaller
+// step. It also reports whether any line is indented with tabs, which YAML
+// doesn't allow.
+func detectIndent(content []byte) (indent int, tabs bool) {
+	votes := make(map[int]int)
+	prev := 0
+	blockIndent := -1 // indent of the key owning the current block scalar
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		leading := line[:len(line)-len(trimmed)]
+		if strings.Contains(leading, "\t") {
+			tabs = true
+			continue
+		}
+		n := len(leading)
+		if blockIndent >= 0 {
+			if n > blockIndent {
+				continue
 			}
+			blockIndent = -1
+		}
+		if strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if step := n - prev; step == 2 || step == 4 || step == 8 {
+			votes[step]++
+		}
+		prev = n
+		if blockScalarHeader.MatchString(trimmed) {
+			blockIndent = n
 		}
 	}
-	return 2 // default
+
+	indent = 2 // default
+	for _, step := range []int{2, 4, 8} {
+		if votes[step] > votes[indent] {
+			indent = step
+		}
+	}
+	return indent, tabs
 }
 
+// blockScalarHeader matches a line whose value starts a literal or folded
+// block scalar, e.g. "key: |", "key: >-", or "- |2".
+var blockScalarHeader = regexp.MustCompile(`(^-|:)\s+[|>][-+0-9]*\s*(#.*)?$`)
+
 // upsertNestedKey finds the deepest matching nested path and either updates
 // an existing key or adds a new one at the appropriate level.
-// If the current level has flat keys (keys with dots), adds as flat key.
+// If the current level has flat keys (keys containing sep), adds as flat key.
 // Otherwise, creates nested structure.
-func upsertNestedKey(node *yaml.Node, keyPath []string, value string) {
+func upsertNestedKey(node *yaml.Node, keyPath []string, value, sep string) {
 	if node.Kind != yaml.MappingNode || len(keyPath) == 0 {
 		return
 	}
 
 	// First, try to find an exact match for the full flattened key at this level
-	flatKey := strings.Join(keyPath, ".")
+	flatKey := strings.Join(keyPath, sep)
 	for i := 0; i < len(node.Content); i += 2 {
 		if node.Content[i].Value == flatKey {
 			// Found exact flat key match, update it
@@ -335,7 +2616,7 @@ func upsertNestedKey(node *yaml.Node, keyPath []string, value string) {
 			}
 			// More path segments - if this is a mapping, recurse
 			if node.Content[i+1].Kind == yaml.MappingNode {
-				upsertNestedKey(node.Content[i+1], keyPath[1:], value)
+				upsertNestedKey(node.Content[i+1], keyPath[1:], value, sep)
 				return
 			}
 			// Not a mapping, can't go deeper - shouldn't happen for well-formed data
@@ -344,8 +2625,8 @@ func upsertNestedKey(node *yaml.Node, keyPath []string, value string) {
 	}
 
 	// Key not found at this level
-	// Check if this level has any flat keys (keys containing dots)
-	if hasFlatKeys(node) {
+	// Check if this level has any flat keys (keys containing sep)
+	if hasFlatKeys(node, sep) {
 		// Add as flat key
 		node.Content = append(node.Content,
 			&yaml.Node{Kind: yaml.ScalarNode, Value: flatKey},
@@ -357,10 +2638,10 @@ func upsertNestedKey(node *yaml.Node, keyPath []string, value string) {
 	}
 }
 
-// hasFlatKeys checks if a mapping node has any keys containing dots
-func hasFlatKeys(node *yaml.Node) bool {
+// hasFlatKeys checks if a mapping node has any keys containing sep
+func hasFlatKeys(node *yaml.Node, sep string) bool {
 	for i := 0; i < len(node.Content); i += 2 {
-		if strings.Contains(node.Content[i].Value, ".") {
+		if strings.Contains(node.Content[i].Value, sep) {
 			return true
 		}
 	}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCleanFilename(t *testing.T) {
@@ -19,11 +25,18 @@ func TestCleanFilename(t *testing.T) {
 		{"plainfile", "plainfile"},
 		{"multi-part-name-secrets.yaml", "multi-part-name"},
 		{"app.prod.sops.yaml", "app"},
+		{"app-secrets.production.yaml", "app"},
+		{"web.staging.enc.yaml", "web"},
+		{"api-secrets.dev.sops.json", "api"},
+		// Only listed suffixes are stripped from the end
+		{"app-secrets-v2.yaml", "app-secrets-v2"},
+		{"config-secrets-prod.enc.yaml", "config-secrets-prod"},
+		{"db_secrets.yaml", "db_secrets"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			result := cleanFilename(tt.input)
+			result := cleanFilename(tt.input, nil)
 			if result != tt.expected {
 				t.Errorf("cleanFilename(%q) = %q, expected %q", tt.input, result, tt.expected)
 			}
@@ -31,6 +44,32 @@ func TestCleanFilename(t *testing.T) {
 	}
 }
 
+func TestCleanFilenameSuffixes(t *testing.T) {
+	tests := []struct {
+		input    string
+		suffixes []string
+		expected string
+	}{
+		{"app-production.yaml", []string{"-production"}, "app"},
+		{"app-secrets-production.yaml", []string{"-secrets", "-production"}, "app"},
+		// Longest match first: "-secrets-production" before "-production"
+		{"app-secrets-production.yaml", []string{"-production", "-secrets-production"}, "app"},
+		{"app-secrets.yaml", []string{}, "app-secrets"},
+		{"app-secrets.enc.yaml", []string{".enc"}, "app-secrets"},
+		{"db_secrets.prod.json", []string{"_secrets", ".prod"}, "db"},
+		{"web.staging.enc.yaml", []string{".enc", ".staging"}, "web"},
+		{"-secrets.yaml", []string{"-secrets"}, "-secrets"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if result := cleanFilename(tt.input, tt.suffixes); result != tt.expected {
+				t.Errorf("cleanFilename(%q, %q) = %q, expected %q", tt.input, tt.suffixes, result, tt.expected)
+			}
+		})
+	}
+}
+
 func TestCounterpartFilename(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -44,7 +83,7 @@ func TestCounterpartFilename(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			result := counterpartFilename(tt.input)
+			result := counterpartFilename(tt.input, nil)
 			if result != tt.expected {
 				t.Errorf("counterpartFilename(%q) = %q, expected %q", tt.input, result, tt.expected)
 			}
@@ -52,6 +91,76 @@ func TestCounterpartFilename(t *testing.T) {
 	}
 }
 
+func TestCounterpartFor(t *testing.T) {
+	tmpDir := t.TempDir()
+	sopsFile := filepath.Join(tmpDir, "app-secrets.enc.yaml")
+	base := filepath.Join(tmpDir, "app")
+
+	tests := []struct {
+		name     string
+		format   string
+		existing []string
+		expected string
+	}{
+		{"default", "", nil, base + ".yaml"},
+		{"toml", inputFormatTOML, nil, base + ".toml"},
+		{"json", inputFormatJSON, nil, base + ".json"},
+		{"dotenv", inputFormatDotenv, nil, base + ".env"},
+		{"detects dotenv", "", []string{".env"}, base + ".env"},
+		{"prefers yaml", "", []string{".env", ".yaml"}, base + ".yaml"},
+		{"explicit yaml", inputFormatYAML, []string{".env"}, base + ".yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, ext := range tt.existing {
+				os.WriteFile(base+ext, nil, 0644)
+				defer os.Remove(base + ext)
+			}
+			if got := counterpartFor(Config{CounterpartFormat: tt.format}, sopsFile); got != tt.expected {
+				t.Errorf("counterpartFor() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDetectIndent(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		expected     int
+		expectedTabs bool
+	}{
+		{"empty", "", 2, false},
+		{"flat", "a: 1\nb: 2\n", 2, false},
+		{"two spaces", "a:\n  b:\n    c: 1\n", 2, false},
+		{"four spaces", "a:\n    b:\n        c: 1\n    d: 2\n", 4, false},
+		{
+			"block scalar before structure",
+			"cert: |\n   -----BEGIN-----\n   abc\ndb:\n    user: u\n    pass: p\n",
+			4, false,
+		},
+		{
+			"folded scalar with modifiers",
+			"a:\n    note: >-\n      folded\n      text\n    b: 1\nc:\n    d: 2\n",
+			4, false,
+		},
+		{"comments ignored", "# header\n   # indented comment\na:\n    b: 1\n", 4, false},
+		{"majority of mixed spacing", "a:\n  b: 1\nc:\n    d: 1\ne:\n    f: 1\n", 4, false},
+		{"tie goes to smaller step", "a:\n  b: 1\nc:\n    d: 1\n", 2, false},
+		{"odd steps ignored", "a:\n   b: 1\n", 2, false},
+		{"tabs", "a:\n\tb: 1\n", 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indent, tabs := detectIndent([]byte(tt.input))
+			if indent != tt.expected || tabs != tt.expectedTabs {
+				t.Errorf("detectIndent = %d, %v, expected %d, %v", indent, tabs, tt.expected, tt.expectedTabs)
+			}
+		})
+	}
+}
+
 func TestUpdateCounterpartFile(t *testing.T) {
 	// Create temp directory
 	tmpDir := t.TempDir()
@@ -212,4 +321,471 @@ func TestUpdateCounterpartFile(t *testing.T) {
 			t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", string(fileContent), expected)
 		}
 	})
+
+	t.Run("splits keys on a custom separator", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "separator.yaml")
+		// db.host is a single key here, not a path
+		initial := []byte("db:\n  db.host: old\n")
+		os.WriteFile(path, initial, 0644)
+
+		refFor := func(key string) string { return vaultRef("secret/myapp/" + key) }
+		if _, err := updateCounterpartRefs(path, []string{"db__db.host", "api__key"}, refFor, "__"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		fileContent, _ := os.ReadFile(path)
+		expected := "db:\n  db.host: ref+vault://secret/myapp/db__db.host#value\napi:\n  key: ref+vault://secret/myapp/api__key#value\n"
+		if string(fileContent) != expected {
+			t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", string(fileContent), expected)
+		}
+	})
+}
+
+func TestCheckTLSFiles(t *testing.T) {
+	certFile := filepath.Join(t.TempDir(), "client.pem")
+	os.WriteFile(certFile, []byte("cert"), 0644)
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"none", Config{}, ""},
+		{"readable", Config{VaultCACert: certFile, VaultClientCert: certFile, VaultClientKey: certFile}, ""},
+		{"missing file", Config{VaultCACert: "/nonexistent/ca.pem"}, "--vault-tls-ca-cert"},
+		{"cert without key", Config{VaultClientCert: certFile}, "must be used together"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkTLSFiles(tt.cfg)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestReadTokenFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "token")
+	os.WriteFile(path, []byte("  s.file-token\n"), 0600)
+
+	token, err := readTokenFile(path)
+	if err != nil || token != "s.file-token" {
+		t.Errorf("readTokenFile() = (%q, %v), expected s.file-token", token, err)
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		if _, err := readTokenFile(filepath.Join(tmpDir, "missing")); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		empty := filepath.Join(tmpDir, "empty")
+		os.WriteFile(empty, []byte("\n"), 0600)
+		if _, err := readTokenFile(empty); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestReadHomeVaultToken(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	if token, _ := readHomeVaultToken(); token != "" {
+		t.Errorf("expected no token without ~/.vault-token, got %q", token)
+	}
+
+	os.WriteFile(filepath.Join(home, ".vault-token"), []byte("hvs.abc123\n"), 0600)
+	token, path := readHomeVaultToken()
+	if token != "hvs.abc123" {
+		t.Errorf("token = %q, expected hvs.abc123", token)
+	}
+	if path != filepath.Join(home, ".vault-token") {
+		t.Errorf("path = %q, expected ~/.vault-token", path)
+	}
+}
+
+func TestFormatTTL(t *testing.T) {
+	tests := []struct {
+		seconds  int
+		expected string
+	}{
+		{16320, "4h32m"},
+		{3600, "1h0m"},
+		{90, "1m30s"},
+		{45, "45s"},
+		{0, "0s"},
+	}
+
+	for _, tt := range tests {
+		result := formatTTL(tt.seconds)
+		if result != tt.expected {
+			t.Errorf("formatTTL(%d) = %q, expected %q", tt.seconds, result, tt.expected)
+		}
+	}
+}
+
+func TestDescribeTokenExpiry(t *testing.T) {
+	expire := time.Date(2025, 6, 1, 15, 30, 0, 0, time.UTC)
+
+	t.Run("reports expiry", func(t *testing.T) {
+		msg, low := describeTokenExpiry(&TokenInfo{TTL: 4*time.Hour + 32*time.Minute, ExpireTime: expire}, 5*time.Minute)
+		expected := "Vault token expires in: 4h32m (at 2025-06-01T15:30:00Z)"
+		if msg != expected {
+			t.Errorf("got %q, expected %q", msg, expected)
+		}
+		if low {
+			t.Error("expected low=false")
+		}
+	})
+
+	t.Run("flags ttl below minimum", func(t *testing.T) {
+		_, low := describeTokenExpiry(&TokenInfo{TTL: 3 * time.Minute, ExpireTime: expire}, 5*time.Minute)
+		if !low {
+			t.Error("expected low=true")
+		}
+	})
+
+	t.Run("no expiration", func(t *testing.T) {
+		msg, low := describeTokenExpiry(&TokenInfo{}, 5*time.Minute)
+		if msg != "Token has no expiration" || low {
+			t.Errorf("got (%q, %v), expected (\"Token has no expiration\", false)", msg, low)
+		}
+	})
+}
+
+func TestHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app-secrets.enc.yaml")
+	os.WriteFile(path, []byte("hello\n"), 0644)
+
+	sum, err := hashFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+	if sum != expected {
+		t.Errorf("hashFile() = %s, expected %s", sum, expected)
+	}
+
+	if _, err := hashFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestVerifySopsHash(t *testing.T) {
+	content := []byte("hello\n")
+	good := "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+
+	if err := verifySopsHash(content, good); err != nil {
+		t.Errorf("unexpected error for matching hash: %v", err)
+	}
+	if err := verifySopsHash(content, strings.ToUpper(good)); err != nil {
+		t.Errorf("expected hex comparison to be case-insensitive: %v", err)
+	}
+
+	err := verifySopsHash([]byte("hello, modified\n"), good)
+	if err == nil || err.Error() != "SOPS file hash mismatch (file may have been modified)" {
+		t.Errorf("expected mismatch error, got %v", err)
+	}
+}
+
+func TestOrderKeys(t *testing.T) {
+	keys := []string{"c", "a", "db.url", "b", "db.password"}
+	ordering := []string{"db.url", "missing", "db.password", "db.url"}
+
+	result := orderKeys(keys, ordering)
+	expected := []string{"db.url", "db.password", "a", "b", "c"}
+	if strings.Join(result, ",") != strings.Join(expected, ",") {
+		t.Errorf("orderKeys() = %v, expected %v", result, expected)
+	}
+}
+
+func TestProcessFileKeyOrdering(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+	tmpDir := t.TempDir()
+
+	sopsFile := filepath.Join(tmpDir, "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("api:\n  key: k\ndb:\n  password: p\n  url: u\n"), 0644)
+	orderingFile := filepath.Join(tmpDir, "order.yaml")
+	os.WriteFile(orderingFile, []byte("- db.url\n- db.password\n"), 0644)
+
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", ExistsStrategy: strategyOverwrite, KeyOrderingFile: orderingFile}
+	if err := processFile(context.Background(), cfg, sopsFile, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"PUT /v1/secret/data/app/db.url",
+		"PUT /v1/secret/data/app/db.password",
+		"PUT /v1/secret/data/app/api.key",
+	}
+	if calls := mv.Calls(); strings.Join(calls, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("write order = %v, expected %v", calls, expected)
+	}
+}
+
+func TestProcessFileDelete(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+	mv.seed("secret/data/app/db.password", map[string]interface{}{"value": "p"})
+	mv.seed("secret/data/app/db.url", map[string]interface{}{"value": "u"})
+
+	sopsFile := filepath.Join(t.TempDir(), "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("db:\n  password: p\n  url: u\n"), 0644)
+
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", Delete: true, DryRun: true}
+	if err := processFile(context.Background(), cfg, sopsFile, "app"); err != nil {
+		t.Fatalf("dry-run: unexpected error: %v", err)
+	}
+	if calls := mv.Calls(); len(calls) != 0 {
+		t.Fatalf("dry-run made Vault calls: %v", calls)
+	}
+
+	cfg.DryRun = false
+	if err := processFile(context.Background(), cfg, sopsFile, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{
+		"DELETE /v1/secret/metadata/app/db.password",
+		"DELETE /v1/secret/metadata/app/db.url",
+	}
+	if calls := mv.Calls(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("calls = %v, expected %v", calls, expected)
+	}
+	if mv.stored("secret/data/app/db.password") != nil {
+		t.Error("expected secret to be deleted")
+	}
+}
+
+func TestProcessFileExportEnv(t *testing.T) {
+	stubDecrypt(t)
+	tmpDir := t.TempDir()
+
+	sopsFile := filepath.Join(tmpDir, "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("db:\n  password: \"p w\"\n  url: u\n"), 0644)
+	outputFile := filepath.Join(tmpDir, "app.env")
+
+	// No Vault address: export-env never connects
+	cfg := Config{Mount: "secret", ExportEnv: true, OutputFile: outputFile}
+	if err := processFile(context.Background(), cfg, sopsFile, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content, _ := os.ReadFile(outputFile)
+	expected := "export DB_PASSWORD='p w'\nexport DB_URL=u\n"
+	if string(content) != expected {
+		t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", content, expected)
+	}
+}
+
+// stubDecrypt makes decryptData return its input unchanged, so tests can feed
+// plaintext YAML through the pipeline.
+func stubDecrypt(t *testing.T) {
+	t.Helper()
+	orig := decryptData
+	decryptData = func(data []byte, format string) ([]byte, error) { return data, nil }
+	t.Cleanup(func() { decryptData = orig })
+}
+
+func TestProcessFilePrefixStrip(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+	tmpDir := t.TempDir()
+
+	sopsFile := filepath.Join(tmpDir, "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("app:\n  db:\n    password: p\n  token: t\n"), 0644)
+	counterpart := filepath.Join(tmpDir, "app.yaml")
+	os.WriteFile(counterpart, []byte("app:\n  db:\n    password: placeholder\n"), 0644)
+
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", KVVersion: 2, Parallelism: 1,
+		ExistsStrategy: strategyOverwrite, PrefixStrip: "app.", UpdateCounterpart: true}
+	if err := processFile(context.Background(), cfg, sopsFile, "myapp"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, p := range []string{"secret/data/myapp/db.password", "secret/data/myapp/token"} {
+		if mv.stored(p) == nil {
+			t.Errorf("expected %s to be written", p)
+		}
+	}
+	content, _ := os.ReadFile(counterpart)
+	expected := "app:\n  db:\n    password: ref+vault://secret/myapp/db.password#value\n  token: ref+vault://secret/myapp/token#value\n"
+	if string(content) != expected {
+		t.Errorf("unexpected counterpart:\ngot:\n%s\nexpected:\n%s", content, expected)
+	}
+}
+
+func TestProcessFileSkipExisting(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+	mv.seed("secret/data/app/db.password", map[string]interface{}{"value": "existing"})
+
+	sopsFile := filepath.Join(t.TempDir(), "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("db:\n  password: p\n  url: u\n"), 0644)
+
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", ExistsStrategy: strategySkip}
+	if err := processFile(context.Background(), cfg, sopsFile, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := mv.stored("secret/data/app/db.password"); got["value"] != "existing" {
+		t.Errorf("db.password = %v, expected existing value kept", got)
+	}
+	if got := mv.stored("secret/data/app/db.url"); got["value"] != "u" {
+		t.Errorf("db.url = %v, expected u", got)
+	}
+}
+
+func TestProcessFileStdin(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+
+	input := filepath.Join(t.TempDir(), "piped")
+	os.WriteFile(input, []byte(`{"db": {"password": "p"}}`), 0644)
+	f, err := os.Open(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	orig := os.Stdin
+	os.Stdin = f
+	t.Cleanup(func() { os.Stdin = orig })
+
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", Format: "json"}
+	if err := processFile(context.Background(), cfg, "-", "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := mv.stored("secret/data/app/db.password"); got["value"] != "p" {
+		t.Errorf("stored = %v, expected p", got)
+	}
+}
+
+func TestProcessFileEnv(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+
+	sopsFile := filepath.Join(t.TempDir(), "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("db:\n  password: p\n"), 0644)
+
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", Env: "prod", AppendName: true}
+	if err := processFile(context.Background(), cfg, sopsFile, "myproject"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := mv.stored("secret/data/prod/myproject/app/db.password"); got["value"] != "p" {
+		t.Errorf("stored = %v, expected p at prod/myproject/app/db.password", got)
+	}
+
+	// A path template places the environment itself
+	cfg.PathTemplate, _ = parsePathTemplate("{{.VaultPath}}/{{.Env}}/{{.Key}}")
+	if err := processFile(context.Background(), cfg, sopsFile, "myproject"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := mv.stored("secret/data/myproject/app/prod/db.password"); got["value"] != "p" {
+		t.Errorf("stored = %v, expected p at myproject/app/prod/db.password", got)
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tags, err := parseTags("environment=prod, team=platform,note=a=b")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{"environment": "prod", "team": "platform", "note": "a=b"}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("parseTags() = %v, expected %v", tags, expected)
+	}
+	for _, bad := range []string{"team", "=prod"} {
+		if _, err := parseTags(bad); err == nil {
+			t.Errorf("parseTags(%q): expected error", bad)
+		}
+	}
+}
+
+func TestAddTags(t *testing.T) {
+	var cfg Config
+	cfg.addTags(map[string]string{"environment": "prod", "team": "platform"})
+	cfg.addTags(map[string]string{"git_commit": "abc123", "team": "payments"})
+
+	expected := map[string]string{"environment": "prod", "team": "payments", "git_commit": "abc123"}
+	if !reflect.DeepEqual(cfg.Tags, expected) {
+		t.Errorf("Tags = %v, expected %v", cfg.Tags, expected)
+	}
+}
+
+func TestResolveBoolConfig(t *testing.T) {
+	tests := []struct {
+		flag     bool
+		env      string
+		expected bool
+		wantErr  bool
+	}{
+		{false, "", false, false},
+		{true, "", true, false},
+		{false, "true", true, false},
+		{false, "1", true, false},
+		{true, "false", true, false},
+		{false, "yes", false, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("VAULT_SKIP_VERIFY", tt.env)
+		got, err := resolveBoolConfig(tt.flag, "VAULT_SKIP_VERIFY")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("resolveBoolConfig(%v, %q) error = %v, wantErr %v", tt.flag, tt.env, err, tt.wantErr)
+		}
+		if got != tt.expected {
+			t.Errorf("resolveBoolConfig(%v, %q) = %v, expected %v", tt.flag, tt.env, got, tt.expected)
+		}
+	}
+}
+
+func TestProcessFileOverrides(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+
+	sopsFile := filepath.Join(t.TempDir(), "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("db:\n  url: postgres://localhost\n  password: p\n"), 0644)
+
+	cfg := Config{
+		VaultAddr:  mv.URL,
+		VaultToken: "test-token",
+		Mount:      "secret",
+		Overrides:  map[string]string{"db.url": "postgres://prod=1", "region": "eu"},
+		KeyFilter:  regexp.MustCompile(`^(db\.url|region)$`),
+	}
+	if err := processFile(context.Background(), cfg, sopsFile, "myproject"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for path, expected := range map[string]string{"myproject/db.url": "postgres://prod=1", "myproject/region": "eu"} {
+		if got := mv.stored("secret/data/" + path); got["value"] != expected {
+			t.Errorf("%s = %v, expected %s", path, got, expected)
+		}
+	}
+	if got := mv.stored("secret/data/myproject/db.password"); got != nil {
+		t.Errorf("db.password should be filtered out, got %v", got)
+	}
+}
+
+func TestIsMissingSopsKeyError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{errors.New("Error getting data key: 0 successful groups required, got 0"), true},
+		{errors.New("Failed to get the data key required to decrypt the SOPS file."), true},
+		{errors.New("no valid key found"), true},
+		{errors.New("Error unmarshalling input yaml"), false},
+		{errors.New("MAC mismatch"), false},
+	}
+	for _, tt := range tests {
+		if got := isMissingSopsKeyError(tt.err); got != tt.expected {
+			t.Errorf("isMissingSopsKeyError(%q) = %v, expected %v", tt.err, got, tt.expected)
+		}
+	}
 }
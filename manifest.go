@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// manifestEntry is one entry of a --manifest file. Optional fields override
+// the corresponding flag for that entry only.
+type manifestEntry struct {
+	SopsFile       string `yaml:"sops_file"`
+	VaultPath      string `yaml:"vault_path"`
+	Mount          string `yaml:"mount"`
+	KVVersion      int    `yaml:"kv_version"`
+	Format         string `yaml:"format"`
+	AppendName     *bool  `yaml:"append_name"`
+	Name           string `yaml:"name"`
+	SplitTopLevel  *bool  `yaml:"split_top_level"`
+	Bundle         *bool  `yaml:"bundle"`
+	ExistsStrategy string `yaml:"vault_path_exists_strategy"`
+}
+
+// manifestHelp documents the --manifest format for the usage message.
+const manifestHelp = `Manifest files (--manifest) are a YAML list of entries:
+
+  - sops_file: apps/app-secrets.enc.yaml   # required, relative to the manifest
+    vault_path: myproject                  # required
+    mount: secret                          # optional per-entry overrides:
+    kv_version: 2                          #   mount, kv_version, format,
+    append_name: true                      #   append_name, name,
+    name: app                              #   split_top_level, bundle,
+    bundle: false                          #   vault_path_exists_strategy
+`
+
+// loadManifest reads a --manifest file into batch entries, each with its own
+// copy of cfg carrying the entry's overrides. Relative SOPS file paths are
+// resolved against the manifest's directory.
+func loadManifest(path string, cfg Config) ([]BatchEntry, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	var manifest []manifestEntry
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&manifest); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	entries := make([]BatchEntry, 0, len(manifest))
+	for i, m := range manifest {
+		if m.SopsFile == "" || m.VaultPath == "" {
+			return nil, fmt.Errorf("manifest entry %d: sops_file and vault_path are required", i+1)
+		}
+		entryCfg, err := m.apply(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("manifest entry %d (%s): %w", i+1, m.SopsFile, err)
+		}
+
+		sopsFile := m.SopsFile
+		if !filepath.IsAbs(sopsFile) {
+			sopsFile = filepath.Join(dir, sopsFile)
+		}
+		entries = append(entries, BatchEntry{SopsFile: sopsFile, VaultPath: m.VaultPath, Config: &entryCfg})
+	}
+	return entries, nil
+}
+
+// apply returns cfg with the entry's overrides applied.
+func (m manifestEntry) apply(cfg Config) (Config, error) {
+	if m.Mount != "" {
+		cfg.Mount = m.Mount
+	}
+	if m.KVVersion != 0 {
+		if m.KVVersion != 1 && m.KVVersion != 2 {
+			return cfg, fmt.Errorf("invalid kv_version %d (expected 1 or 2)", m.KVVersion)
+		}
+		cfg.KVVersion = m.KVVersion
+	}
+	if m.Format != "" {
+		if !validInputFormat(m.Format) {
+			return cfg, fmt.Errorf("invalid format %q (expected yaml, json, dotenv, or toml)", m.Format)
+		}
+		cfg.Format = m.Format
+	}
+	if m.AppendName != nil {
+		cfg.AppendName = *m.AppendName
+	}
+	if m.Name != "" {
+		cfg.NameOverride = m.Name
+	}
+	if m.SplitTopLevel != nil {
+		cfg.SplitTopLevel = *m.SplitTopLevel
+	}
+	if m.Bundle != nil {
+		cfg.Bundle = *m.Bundle
+	}
+	if m.ExistsStrategy != "" {
+		switch m.ExistsStrategy {
+		case strategyOverwrite, strategySkip, strategyMerge, strategyError:
+		default:
+			return cfg, fmt.Errorf("invalid vault_path_exists_strategy %q (expected overwrite, skip, merge, or error)", m.ExistsStrategy)
+		}
+		cfg.ExistsStrategy = m.ExistsStrategy
+	}
+	if cfg.ForceRecreate && cfg.ExistsStrategy != strategyOverwrite {
+		return cfg, fmt.Errorf("--force-recreate can only be used with vault_path_exists_strategy overwrite")
+	}
+	return cfg, nil
+}
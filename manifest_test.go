@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadManifest(t *testing.T) {
+	tmpDir := t.TempDir()
+	base := Config{Mount: "secret", KVVersion: 2, ExistsStrategy: strategyOverwrite}
+
+	t.Run("applies per-entry overrides", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "manifest.yaml")
+		content := "- sops_file: app-secrets.enc.yaml\n" +
+			"  vault_path: myproject\n" +
+			"  append_name: true\n" +
+			"- sops_file: /abs/db.enc.json\n" +
+			"  vault_path: other\n" +
+			"  mount: kv\n" +
+			"  kv_version: 1\n" +
+			"  vault_path_exists_strategy: skip\n"
+		os.WriteFile(path, []byte(content), 0644)
+
+		entries, err := loadManifest(path, base)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("expected 2 entries, got %d", len(entries))
+		}
+		if entries[0].SopsFile != filepath.Join(tmpDir, "app-secrets.enc.yaml") || entries[0].VaultPath != "myproject" {
+			t.Errorf("entry 1 = %+v", entries[0])
+		}
+		if !entries[0].Config.AppendName || entries[0].Config.Mount != "secret" {
+			t.Errorf("entry 1 config = %+v", entries[0].Config)
+		}
+		c := entries[1].Config
+		if entries[1].SopsFile != "/abs/db.enc.json" || c.Mount != "kv" || c.KVVersion != 1 || c.ExistsStrategy != strategySkip || c.AppendName {
+			t.Errorf("entry 2 = %+v, config = %+v", entries[1], c)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"missing vault_path", "- sops_file: a.yaml\n", "entry 1: sops_file and vault_path are required"},
+		{"unknown field", "- sops_file: a.yaml\n  vault_path: p\n  mnt: kv\n", "field mnt not found"},
+		{"invalid strategy", "- sops_file: a.yaml\n  vault_path: p\n  vault_path_exists_strategy: replace\n", "invalid vault_path_exists_strategy"},
+		{"invalid kv_version", "- sops_file: a.yaml\n  vault_path: p\n  kv_version: 3\n", "invalid kv_version 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, "bad.yaml")
+			os.WriteFile(path, []byte(tt.content), 0644)
+			if _, err := loadManifest(path, base); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestProcessManifest(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+	tmpDir := t.TempDir()
+
+	os.WriteFile(filepath.Join(tmpDir, "app-secrets.enc.yaml"), []byte("db:\n  password: app-pass\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "web.enc.yaml"), []byte("api:\n  key: web-key\n"), 0644)
+	manifest := filepath.Join(tmpDir, "manifest.yaml")
+	os.WriteFile(manifest, []byte("- sops_file: app-secrets.enc.yaml\n"+
+		"  vault_path: myproject\n"+
+		"  append_name: true\n"+
+		"- sops_file: web.enc.yaml\n"+
+		"  vault_path: myproject/web\n"+
+		"  bundle: true\n"+
+		"  split_top_level: true\n"), 0644)
+
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", ExistsStrategy: strategyOverwrite}
+	entries, err := loadManifest(manifest, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if errs := processBatchConcurrent(context.Background(), entries, cfg, 1); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	if got := mv.stored("secret/data/myproject/app/db.password")["value"]; got != "app-pass" {
+		t.Errorf("app value = %v, expected app-pass", got)
+	}
+	if got := mv.stored("secret/data/myproject/web/api")["key"]; got != "web-key" {
+		t.Errorf("web bundle key = %v, expected web-key", got)
+	}
+}
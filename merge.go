@@ -0,0 +1,36 @@
+package main
+
+import "sort"
+
+// mergeConflict records a key defined by more than one merged file. File and
+// Overridden are indexes into the merged files.
+type mergeConflict struct {
+	Key        string
+	File       int
+	Overridden int
+}
+
+// mergeFlattened merges flattened secrets in order, values from later maps
+// replacing those from earlier ones. It returns the merged secrets and each
+// replacement made, sorted by key then file.
+func mergeFlattened(files []map[string]interface{}) (map[string]interface{}, []mergeConflict) {
+	merged := make(map[string]interface{})
+	from := make(map[string]int)
+	var conflicts []mergeConflict
+	for i, data := range files {
+		for k, v := range data {
+			if prev, ok := from[k]; ok {
+				conflicts = append(conflicts, mergeConflict{Key: k, File: i, Overridden: prev})
+			}
+			merged[k] = v
+			from[k] = i
+		}
+	}
+	sort.Slice(conflicts, func(a, b int) bool {
+		if conflicts[a].Key != conflicts[b].Key {
+			return conflicts[a].Key < conflicts[b].Key
+		}
+		return conflicts[a].File < conflicts[b].File
+	})
+	return merged, conflicts
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMergeFlattened(t *testing.T) {
+	files := []map[string]interface{}{
+		{"db.password": "base", "db.url": "postgres://base", "token": "t"},
+		{"db.password": "staging"},
+		{"db.password": "prod", "db.url": "postgres://prod", "extra": "e"},
+	}
+	merged, conflicts := mergeFlattened(files)
+
+	expected := map[string]interface{}{"db.password": "prod", "db.url": "postgres://prod", "token": "t", "extra": "e"}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("merged = %v, expected %v", merged, expected)
+	}
+	expectedConflicts := []mergeConflict{
+		{Key: "db.password", File: 1, Overridden: 0},
+		{Key: "db.password", File: 2, Overridden: 1},
+		{Key: "db.url", File: 2, Overridden: 0},
+	}
+	if !reflect.DeepEqual(conflicts, expectedConflicts) {
+		t.Errorf("conflicts = %v, expected %v", conflicts, expectedConflicts)
+	}
+}
+
+func TestProcessFilesMerge(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+	tmpDir := t.TempDir()
+
+	base := filepath.Join(tmpDir, "base.enc.yaml")
+	os.WriteFile(base, []byte("db:\n  password: base\n  url: u\n"), 0644)
+	prod := filepath.Join(tmpDir, "prod.enc.yaml")
+	os.WriteFile(prod, []byte("db:\n  password: prod\n"), 0644)
+
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", KVVersion: 2, Parallelism: 1, ExistsStrategy: strategyOverwrite}
+	if err := processFiles(context.Background(), cfg, []string{base, prod}, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := mv.stored("secret/data/app/db.password")["value"]; got != "prod" {
+		t.Errorf("db.password = %v, expected prod", got)
+	}
+	if got := mv.stored("secret/data/app/db.url")["value"]; got != "u" {
+		t.Errorf("db.url = %v, expected u", got)
+	}
+}
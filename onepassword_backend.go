@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/1Password/connect-sdk-go/connect"
+	"github.com/1Password/connect-sdk-go/onepassword"
+)
+
+// onePasswordValueField is the label of the field each item stores its
+// value in.
+const onePasswordValueField = "value"
+
+// onePasswordAPI is the part of the 1Password Connect client
+// OnePasswordBackend uses.
+type onePasswordAPI interface {
+	GetItemsByTitle(title string, vaultQuery string) ([]onepassword.Item, error)
+	CreateItem(item *onepassword.Item, vaultQuery string) (*onepassword.Item, error)
+	UpdateItem(item *onepassword.Item, vaultQuery string) (*onepassword.Item, error)
+}
+
+// OnePasswordBackend writes each secret to a 1Password vault, through a
+// 1Password Connect server, as an item titled with the key. The <vault-path>
+// argument names the 1Password vault (by name or ID).
+type OnePasswordBackend struct {
+	client onePasswordAPI
+}
+
+// NewOnePasswordBackend creates a 1Password backend for the Connect server
+// at host, authenticating with token.
+func NewOnePasswordBackend(host, token string) (*OnePasswordBackend, error) {
+	if host == "" || token == "" {
+		return nil, fmt.Errorf("--1password-connect-host and --1password-service-account-token are required")
+	}
+	return &OnePasswordBackend{client: connect.NewClient(host, token)}, nil
+}
+
+// Location returns the secret reference for key, as used by `op read`.
+func (o *OnePasswordBackend) Location(basePath, key string) string {
+	return "op://" + basePath + "/" + key + "/" + onePasswordValueField
+}
+
+// WriteSecrets stores each key's value in the value field of the item titled
+// with the key, updating the item if the vault has one and creating it (as
+// an API credential) otherwise.
+func (o *OnePasswordBackend) WriteSecrets(ctx context.Context, basePath string, keys []string, data map[string]interface{}) (int, error) {
+	written := 0
+	for _, key := range keys {
+		if err := o.writeItem(basePath, key, formatValue(data[key])); err != nil {
+			return written, fmt.Errorf("failed to write 1Password item %s in vault %s: %w", key, basePath, err)
+		}
+		written++
+	}
+	return written, nil
+}
+
+func (o *OnePasswordBackend) writeItem(vault, title, value string) error {
+	items, err := o.client.GetItemsByTitle(title, vault)
+	if err != nil {
+		return err
+	}
+	switch len(items) {
+	case 0:
+		_, err = o.client.CreateItem(&onepassword.Item{
+			Title:    title,
+			Category: onepassword.ApiCredential,
+			Fields:   []*onepassword.ItemField{onePasswordValue(value)},
+		}, vault)
+		return err
+	case 1:
+	default:
+		return fmt.Errorf("%d items have that title", len(items))
+	}
+
+	item := items[0]
+	for _, field := range item.Fields {
+		if field.Label == onePasswordValueField {
+			field.Value = value
+			_, err = o.client.UpdateItem(&item, vault)
+			return err
+		}
+	}
+	item.Fields = append(item.Fields, onePasswordValue(value))
+	_, err = o.client.UpdateItem(&item, vault)
+	return err
+}
+
+// onePasswordValue returns a concealed value field holding value.
+func onePasswordValue(value string) *onepassword.ItemField {
+	return &onepassword.ItemField{
+		ID:    onePasswordValueField,
+		Label: onePasswordValueField,
+		Type:  onepassword.FieldTypeConcealed,
+		Value: value,
+	}
+}
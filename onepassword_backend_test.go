@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/1Password/connect-sdk-go/onepassword"
+)
+
+// fakeOnePassword stores items by title and records each call.
+type fakeOnePassword struct {
+	items map[string][]onepassword.Item
+	calls []string
+}
+
+func (f *fakeOnePassword) GetItemsByTitle(title string, vaultQuery string) ([]onepassword.Item, error) {
+	f.calls = append(f.calls, "get "+vaultQuery+"/"+title)
+	return f.items[title], nil
+}
+
+func (f *fakeOnePassword) CreateItem(item *onepassword.Item, vaultQuery string) (*onepassword.Item, error) {
+	f.calls = append(f.calls, "create "+vaultQuery+"/"+item.Title)
+	f.items[item.Title] = []onepassword.Item{*item}
+	return item, nil
+}
+
+func (f *fakeOnePassword) UpdateItem(item *onepassword.Item, vaultQuery string) (*onepassword.Item, error) {
+	f.calls = append(f.calls, "update "+vaultQuery+"/"+item.Title)
+	f.items[item.Title] = []onepassword.Item{*item}
+	return item, nil
+}
+
+// value returns the value field of the item titled title.
+func (f *fakeOnePassword) value(title string) string {
+	for _, item := range f.items[title] {
+		for _, field := range item.Fields {
+			if field.Label == onePasswordValueField {
+				return field.Value
+			}
+		}
+	}
+	return ""
+}
+
+func TestOnePasswordBackendWriteSecrets(t *testing.T) {
+	fake := &fakeOnePassword{items: map[string][]onepassword.Item{
+		"db.password": {{ID: "1", Title: "db.password", Fields: []*onepassword.ItemField{
+			{ID: "notes", Label: "notes", Value: "kept"},
+			onePasswordValue("old"),
+		}}},
+		"token": {{ID: "2", Title: "token"}},
+	}}
+	backend := &OnePasswordBackend{client: fake}
+
+	data := map[string]interface{}{"db.password": "s3cr3t", "db.port": 5432, "token": "t"}
+	written, err := backend.WriteSecrets(context.Background(), "Production", []string{"db.password", "db.port", "token"}, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if written != 3 {
+		t.Errorf("written = %d, expected 3", written)
+	}
+
+	expectedCalls := []string{
+		"get Production/db.password", "update Production/db.password",
+		"get Production/db.port", "create Production/db.port",
+		"get Production/token", "update Production/token",
+	}
+	if !reflect.DeepEqual(fake.calls, expectedCalls) {
+		t.Errorf("calls = %v, expected %v", fake.calls, expectedCalls)
+	}
+	for key, expected := range map[string]string{"db.password": "s3cr3t", "db.port": "5432", "token": "t"} {
+		if got := fake.value(key); got != expected {
+			t.Errorf("%s = %q, expected %q", key, got, expected)
+		}
+	}
+	if notes := fake.items["db.password"][0].Fields[0]; notes.Value != "kept" {
+		t.Errorf("other fields should be kept, got %+v", notes)
+	}
+	if category := fake.items["db.port"][0].Category; category != onepassword.ApiCredential {
+		t.Errorf("category = %s, expected %s", category, onepassword.ApiCredential)
+	}
+
+	t.Run("duplicate titles", func(t *testing.T) {
+		fake.items["dup"] = []onepassword.Item{{ID: "3"}, {ID: "4"}}
+		if _, err := backend.WriteSecrets(context.Background(), "Production", []string{"dup"}, map[string]interface{}{"dup": "x"}); err == nil {
+			t.Error("expected error for duplicate titles")
+		}
+	})
+}
+
+func TestOnePasswordBackendLocation(t *testing.T) {
+	backend := &OnePasswordBackend{}
+	if got := backend.Location("Production", "db.password"); got != "op://Production/db.password/value" {
+		t.Errorf("Location = %q, expected op://Production/db.password/value", got)
+	}
+}
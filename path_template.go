@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// pathTemplateData is what a --vault-path-template is executed with.
+type pathTemplateData struct {
+	VaultPath string
+	Key       string
+	Filename  string
+	Mount     string
+	Env       string
+}
+
+// parsePathTemplate parses a --vault-path-template.
+func parsePathTemplate(text string) (*template.Template, error) {
+	return template.New("vault-path-template").Option("missingkey=error").Parse(text)
+}
+
+// renderPathTemplate executes tmpl for each key, with data's other fields
+// shared by all of them, and returns the Vault path (under the mount) for
+// each key. Leading, trailing, and repeated slashes are dropped. A key
+// rendering to an empty path, or to the same path as another key, is an
+// error.
+func renderPathTemplate(tmpl *template.Template, keys []string, data pathTemplateData) (map[string]string, error) {
+	paths := make(map[string]string, len(keys))
+	owner := make(map[string]string, len(keys))
+	for _, k := range keys {
+		data.Key = k
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("executing --vault-path-template for %s: %w", k, err)
+		}
+		p := cleanVaultPath(b.String())
+		if p == "" {
+			return nil, fmt.Errorf("--vault-path-template gives an empty path for %s", k)
+		}
+		if other, ok := owner[p]; ok {
+			return nil, fmt.Errorf("--vault-path-template gives the same path %s for %s and %s", p, other, k)
+		}
+		owner[p] = k
+		paths[k] = p
+	}
+	return paths, nil
+}
+
+// cleanVaultPath drops empty segments from p, so "/a//b/" becomes "a/b".
+func cleanVaultPath(p string) string {
+	var segments []string
+	for _, s := range strings.Split(p, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRenderPathTemplate(t *testing.T) {
+	data := pathTemplateData{VaultPath: "myproject", Filename: "app", Mount: "secret", Env: "prod"}
+
+	tmpl, err := parsePathTemplate("{{.Env}}/{{.Filename}}//{{.Key}}/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := renderPathTemplate(tmpl, []string{"db.password", "token"}, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{"db.password": "prod/app/db.password", "token": "prod/app/token"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+
+	errorCases := map[string]string{
+		"unknown field":  "{{.Missing}}/{{.Key}}",
+		"same path":      "{{.VaultPath}}",
+		"empty path":     "{{if eq .Key \"token\"}}/{{else}}{{.Key}}{{end}}",
+		"template error": "{{index .Key 99}}",
+	}
+	for name, text := range errorCases {
+		t.Run(name, func(t *testing.T) {
+			tmpl, err := parsePathTemplate(text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := renderPathTemplate(tmpl, []string{"db.password", "token"}, data); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestProcessFilePathTemplate(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+
+	sopsFile := filepath.Join(t.TempDir(), "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("db:\n  password: p\n"), 0644)
+
+	tmpl, err := parsePathTemplate("{{.Env}}/{{.VaultPath}}/{{.Filename}}/{{.Key}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", PathTemplate: tmpl, Env: "staging"}
+	if err := processFile(context.Background(), cfg, sopsFile, "myproject"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := mv.stored("secret/data/staging/myproject/app/db.password"); got["value"] != "p" {
+		t.Errorf("stored = %v, expected p", got)
+	}
+}
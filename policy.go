@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// writePolicy writes a Vault policy granting read on each secret in paths
+// (under mount), one path block per secret.
+func writePolicy(w io.Writer, mount string, kvVersion int, paths []string) {
+	for i, p := range paths {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "path %q {\n  capabilities = [\"read\"]\n}\n", kvAPIPath(mount, kvVersion, "data", p))
+	}
+}
+
+// writePolicyFile writes the policy from writePolicy to path, ready for
+// `vault policy write`.
+func writePolicyFile(path, mount string, kvVersion int, paths []string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating policy file: %w", err)
+	}
+	writePolicy(f, mount, kvVersion, paths)
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing policy file: %w", err)
+	}
+	return nil
+}
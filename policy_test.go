@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWritePolicy(t *testing.T) {
+	paths := []string{"myapp/db.url", "myapp/api.key"}
+
+	t.Run("kv v2", func(t *testing.T) {
+		var buf strings.Builder
+		writePolicy(&buf, "secret", 2, paths)
+
+		expected := "path \"secret/data/myapp/db.url\" {\n  capabilities = [\"read\"]\n}\n" +
+			"\n" +
+			"path \"secret/data/myapp/api.key\" {\n  capabilities = [\"read\"]\n}\n"
+		if buf.String() != expected {
+			t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", buf.String(), expected)
+		}
+	})
+
+	t.Run("kv v1", func(t *testing.T) {
+		var buf strings.Builder
+		writePolicy(&buf, "kv", 1, paths[:1])
+
+		expected := "path \"kv/myapp/db.url\" {\n  capabilities = [\"read\"]\n}\n"
+		if buf.String() != expected {
+			t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", buf.String(), expected)
+		}
+	})
+}
+
+func TestProcessFileGeneratePolicy(t *testing.T) {
+	stubDecrypt(t)
+	tmpDir := t.TempDir()
+
+	sopsFile := filepath.Join(tmpDir, "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("db:\n  password: p\n  url: u\ntoken: t\n"), 0644)
+	policyFile := filepath.Join(tmpDir, "app.hcl")
+
+	// No Vault address: generating a policy never connects
+	cfg := Config{Mount: "secret", PolicyFile: policyFile, SplitTopLevel: true, Bundle: true}
+	if err := processFile(context.Background(), cfg, sopsFile, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content, _ := os.ReadFile(policyFile)
+	expected := "path \"secret/data/app/db\" {\n  capabilities = [\"read\"]\n}\n" +
+		"\n" +
+		"path \"secret/data/app/misc\" {\n  capabilities = [\"read\"]\n}\n"
+	if string(content) != expected {
+		t.Errorf("unexpected policy:\ngot:\n%s\nexpected:\n%s", content, expected)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// progressBarWidth is the number of cells in the --progress bar.
+const progressBarWidth = 30
+
+// progressBar reports how many of total secrets have been written. On a
+// terminal it redraws one line in place; otherwise, such as in CI logs, it
+// prints a line at every 10%. It is safe for concurrent use.
+type progressBar struct {
+	mu      sync.Mutex
+	w       io.Writer
+	tty     bool
+	total   int
+	done    int
+	printed int // done as of the last line printed without a terminal
+}
+
+// newProgressBar creates a progress bar for total secrets, drawn on w.
+func newProgressBar(w io.Writer, total int, tty bool) *progressBar {
+	p := &progressBar{w: w, tty: tty, total: total}
+	if tty {
+		p.draw()
+	}
+	return p
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// Increment records one more secret attempted.
+func (p *progressBar) Increment() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if p.tty {
+		p.draw()
+		return
+	}
+	if p.done*10/p.total > p.printed*10/p.total {
+		fmt.Fprintf(p.w, "Writing secrets: %d/%d\n", p.done, p.total)
+		p.printed = p.done
+	}
+}
+
+// Finish clears the bar and prints the final count.
+func (p *progressBar) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tty {
+		fmt.Fprint(p.w, "\r\033[K")
+	} else if p.printed == p.done {
+		return
+	}
+	fmt.Fprintf(p.w, "Writing secrets: %d/%d\n", p.done, p.total)
+}
+
+func (p *progressBar) draw() {
+	filled := 0
+	if p.total > 0 {
+		filled = p.done * progressBarWidth / p.total
+	}
+	bar := strings.Repeat("#", filled) + strings.Repeat(".", progressBarWidth-filled)
+	fmt.Fprintf(p.w, "\rWriting secrets: [%s] %d/%d", bar, p.done, p.total)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProgressBar(t *testing.T) {
+	t.Run("non-terminal prints every 10%", func(t *testing.T) {
+		var buf strings.Builder
+		bar := newProgressBar(&buf, 5, false)
+		for i := 0; i < 5; i++ {
+			bar.Increment()
+		}
+		bar.Finish()
+		expected := "Writing secrets: 1/5\nWriting secrets: 2/5\nWriting secrets: 3/5\nWriting secrets: 4/5\nWriting secrets: 5/5\n"
+		if buf.String() != expected {
+			t.Errorf("output:\n%q\nexpected:\n%q", buf.String(), expected)
+		}
+
+		buf.Reset()
+		bar = newProgressBar(&buf, 100, false)
+		for i := 0; i < 15; i++ {
+			bar.Increment()
+		}
+		bar.Finish()
+		expected = "Writing secrets: 10/100\nWriting secrets: 15/100\n"
+		if buf.String() != expected {
+			t.Errorf("output:\n%q\nexpected:\n%q", buf.String(), expected)
+		}
+	})
+
+	t.Run("terminal redraws and clears", func(t *testing.T) {
+		var buf strings.Builder
+		bar := newProgressBar(&buf, 2, true)
+		bar.Increment()
+		bar.Increment()
+		bar.Finish()
+		out := buf.String()
+		if !strings.Contains(out, "\rWriting secrets: ["+strings.Repeat("#", 15)+strings.Repeat(".", 15)+"] 1/2") {
+			t.Errorf("expected a half-full bar, got %q", out)
+		}
+		if !strings.HasSuffix(out, "\r\033[KWriting secrets: 2/2\n") {
+			t.Errorf("expected the bar cleared and the final count, got %q", out)
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Per-key statuses reported by --output-format=json.
+const (
+	statusWritten    = "written"
+	statusSkipped    = "skipped"
+	statusFailed     = "failed"
+	statusNotWritten = "not_written"
+	statusWouldWrite = "would_write"
+	statusConflict   = "conflict"
+)
+
+// keyReport is the JSON report entry for one flattened key.
+type keyReport struct {
+	Key        string `json:"key"`
+	VaultPath  string `json:"vault_path"`
+	Status     string `json:"status"`
+	WouldWrite bool   `json:"would_write,omitempty"`
+}
+
+// runReport is the JSON report for one SOPS file.
+type runReport struct {
+	Mount       string      `json:"mount"`
+	Path        string      `json:"path"`
+	KeysWritten int         `json:"keys_written"`
+	Keys        []keyReport `json:"keys"`
+}
+
+// newRunReport builds the report for keys, taking each key's Vault location
+// and status from locationFor and statusFor.
+func newRunReport(mount, vaultPath string, keys []string, locationFor, statusFor func(key string) string) runReport {
+	report := runReport{Mount: mount, Path: vaultPath, Keys: make([]keyReport, 0, len(keys))}
+	for _, k := range keys {
+		status := statusFor(k)
+		if status == statusWritten {
+			report.KeysWritten++
+		}
+		report.Keys = append(report.Keys, keyReport{
+			Key:        k,
+			VaultPath:  locationFor(k),
+			Status:     status,
+			WouldWrite: status == statusWouldWrite,
+		})
+	}
+	return report
+}
+
+// printJSONReport writes report as a single line of JSON, so batch runs
+// produce one object per line.
+func printJSONReport(w io.Writer, report runReport) error {
+	return json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestNewRunReport(t *testing.T) {
+	keys := []string{"db.password", "db.url", "token"}
+	statuses := map[string]string{"db.password": statusWritten, "db.url": statusSkipped}
+	statusFor := func(k string) string {
+		if s, ok := statuses[k]; ok {
+			return s
+		}
+		return statusNotWritten
+	}
+	locationFor := func(k string) string { return "secret/app/" + k }
+
+	report := newRunReport("secret", "app", keys, locationFor, statusFor)
+	if report.KeysWritten != 1 {
+		t.Errorf("KeysWritten = %d, expected 1", report.KeysWritten)
+	}
+
+	var buf bytes.Buffer
+	if err := printJSONReport(&buf, report); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	expected := map[string]interface{}{
+		"mount":        "secret",
+		"path":         "app",
+		"keys_written": float64(1),
+		"keys": []interface{}{
+			map[string]interface{}{"key": "db.password", "vault_path": "secret/app/db.password", "status": "written"},
+			map[string]interface{}{"key": "db.url", "vault_path": "secret/app/db.url", "status": "skipped"},
+			map[string]interface{}{"key": "token", "vault_path": "secret/app/token", "status": "not_written"},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		wouldWrite := func(string) string { return statusWouldWrite }
+		report := newRunReport("secret", "app", []string{"token"}, locationFor, wouldWrite)
+		if report.KeysWritten != 0 || !report.Keys[0].WouldWrite {
+			t.Errorf("unexpected dry-run report: %+v", report)
+		}
+	})
+}
+
+func TestWriteSecretsStatus(t *testing.T) {
+	mv := newMockVault(t)
+	mv.seed("secret/data/app/db.password", map[string]interface{}{"value": "old"})
+	mv.handle("PUT", "/v1/secret/data/app/db.url", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		writeJSON(w, map[string]interface{}{"errors": []string{"permission denied"}})
+	})
+
+	keys := []string{"api.key", "db.password", "db.url", "token"}
+	data := map[string]interface{}{"api.key": "k", "db.password": "p", "db.url": "u", "token": "t"}
+	result, err := writeSecrets(context.Background(), mv.client(t, "secret"), keys, data, underPath("app"), writeOptions{Strategy: strategySkip})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	expected := map[string]string{
+		"api.key":     statusWritten,
+		"db.password": statusSkipped,
+		"db.url":      statusFailed,
+		"token":       statusNotWritten,
+	}
+	for key, want := range expected {
+		if got := result.Status(key); got != want {
+			t.Errorf("Status(%q) = %q, expected %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// retryPolicy controls how failed Vault requests are retried.
+type retryPolicy struct {
+	// Attempts is the number of retries after the first try; 0 disables
+	// retrying.
+	Attempts int
+	// InitialDelay is the wait before the first retry. It doubles after
+	// each further failure.
+	InitialDelay time.Duration
+}
+
+// withRetry calls fn until it succeeds, fails with an error that isn't
+// transient, or policy.Attempts retries have been used. Waiting between
+// retries stops early if ctx is cancelled, returning the last error.
+func withRetry(ctx context.Context, policy retryPolicy, fn func() error) error {
+	delay := policy.InitialDelay
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= policy.Attempts || !isTransient(err) {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Warning: %v (retrying in %s)\n", err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// isTransient reports whether err is worth retrying: Vault rate limiting
+// (429), Vault being unavailable (503, e.g. during leader election), or the
+// connection being refused.
+func isTransient(err error) bool {
+	var respErr *api.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode == http.StatusTooManyRequests || respErr.StatusCode == http.StatusServiceUnavailable
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
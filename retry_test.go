@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestWithRetry(t *testing.T) {
+	policy := retryPolicy{Attempts: 3, InitialDelay: time.Millisecond}
+
+	t.Run("retries until success", func(t *testing.T) {
+		mv := newMockVault(t)
+		var requests int32
+		mv.handle("PUT", "/v1/secret/data/app/db.password", func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				writeJSON(w, map[string]interface{}{"errors": []string{"Vault is sealed"}})
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+		client := mv.client(t, "secret")
+
+		err := withRetry(context.Background(), policy, func() error {
+			return client.WriteKV("app/db.password", "p")
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if requests != 3 {
+			t.Errorf("requests = %d, expected 3", requests)
+		}
+	})
+
+	t.Run("gives up after attempts", func(t *testing.T) {
+		calls := 0
+		err := withRetry(context.Background(), policy, func() error {
+			calls++
+			return fmt.Errorf("writing: %w", &api.ResponseError{StatusCode: http.StatusTooManyRequests})
+		})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if calls != 4 {
+			t.Errorf("calls = %d, expected 4 (1 try + 3 retries)", calls)
+		}
+	})
+
+	t.Run("does not retry permanent errors", func(t *testing.T) {
+		mv := newMockVault(t)
+		var requests int32
+		mv.handle("PUT", "/v1/secret/data/app/db.password", func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusForbidden)
+			writeJSON(w, map[string]interface{}{"errors": []string{"permission denied"}})
+		})
+		client := mv.client(t, "secret")
+
+		if err := withRetry(context.Background(), policy, func() error {
+			return client.WriteKV("app/db.password", "p")
+		}); err == nil {
+			t.Fatal("expected error")
+		}
+		if requests != 1 {
+			t.Errorf("requests = %d, expected 1", requests)
+		}
+	})
+}
+
+func TestIsTransient(t *testing.T) {
+	mv := newMockVault(t)
+	client := mv.client(t, "secret")
+	mv.handle("PUT", "/v1/secret/data/app/limited", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		writeJSON(w, map[string]interface{}{"errors": []string{"rate limited"}})
+	})
+
+	if err := client.WriteKV("app/limited", "v"); !isTransient(err) {
+		t.Errorf("429 should be transient: %v", err)
+	}
+
+	refused, err := NewVaultClient(vaultConn{Addr: "http://127.0.0.1:1"}, "t", "secret", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := refused.WriteKV("app/key", "v"); !isTransient(err) {
+		t.Errorf("connection refused should be transient: %v", err)
+	}
+
+	if isTransient(errors.New("permission denied")) {
+		t.Error("plain error should not be transient")
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// readVaultTree reads every secret under path, descending into sub-paths, and
+// returns them flattened: each secret's name relative to path, with sub-path
+// segments joined by sep. A secret holding only valueField, as written by
+// sops-to-vault, maps to that value; any other secret contributes one key per
+// field (<name><sep><field>), as a --bundle secret does.
+func readVaultTree(client *VaultClient, path, valueField, sep string) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	if err := readVaultTreeInto(client, strings.Trim(path, "/"), "", valueField, sep, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func readVaultTreeInto(client *VaultClient, path, prefix, valueField, sep string, result map[string]interface{}) error {
+	names, err := client.ListKV(path)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		key := prefix + strings.TrimSuffix(name, "/")
+		if strings.HasSuffix(name, "/") {
+			if err := readVaultTreeInto(client, path+"/"+strings.TrimSuffix(name, "/"), key+sep, valueField, sep, result); err != nil {
+				return err
+			}
+			continue
+		}
+
+		data, _, err := client.readKV(path + "/" + name)
+		if err != nil {
+			return err
+		}
+		if value, ok := data[valueField]; ok && len(data) == 1 {
+			result[key] = value
+			continue
+		}
+		for field, value := range data {
+			result[key+sep+field] = value
+		}
+	}
+	return nil
+}
+
+// reverseToSops reads every secret under vaultPath and writes them, nested
+// again, to outputFile as SOPS-encrypted YAML. If outputFile is already a
+// SOPS file it is re-encrypted for the same master keys; otherwise the
+// .sops.yaml creation rules matching outputFile choose them.
+func reverseToSops(cfg Config, vaultPath, outputFile string) error {
+	client, err := cfg.newVaultClient()
+	if err != nil {
+		return fmt.Errorf("creating Vault client: %w", err)
+	}
+
+	flat, err := readVaultTree(client, vaultPath, cfg.VaultKeyName, cfg.Separator)
+	if err != nil {
+		return err
+	}
+	if len(flat) == 0 {
+		return fmt.Errorf("no secrets found under %s/%s", cfg.Mount, vaultPath)
+	}
+
+	if cfg.DryRun {
+		keys := make([]string, 0, len(flat))
+		for k := range flat {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Printf("[dry-run] Would write %d secrets from %s/%s to %s:\n", len(keys), cfg.Mount, vaultPath, outputFile)
+		for _, k := range keys {
+			fmt.Printf("  %s = %s\n", k, maskValue(flat[k], cfg.MaskValueLength))
+		}
+		return nil
+	}
+
+	unflatten := Unflatten
+	if cfg.FlattenArrays {
+		unflatten = UnflattenArrays
+	}
+	plain, err := yaml.Marshal(unflatten(flat, cfg.Separator))
+	if err != nil {
+		return fmt.Errorf("marshaling YAML: %w", err)
+	}
+
+	sopsArgs := []string{"--filename-override", outputFile}
+	if _, err := os.Stat(outputFile); err == nil {
+		keyArgs, err := sopsKeyArgs(outputFile, inputFormatYAML)
+		if err != nil {
+			return err
+		}
+		sopsArgs = append(sopsArgs, keyArgs...)
+	}
+	if err := encryptWithSops(plain, inputFormatYAML, outputFile, sopsArgs); err != nil {
+		return err
+	}
+
+	fmt.Printf("Successfully wrote %d secrets from %s/%s to %s\n", len(flat), cfg.Mount, vaultPath, outputFile)
+	return nil
+}
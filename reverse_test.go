@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// seedVaultTree stores under app a per-key secret, a --bundle secret, and a
+// sub-path as --split-by-top-level-key writes them.
+func seedVaultTree(mv *mockVault) {
+	list := func(keys ...string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+		}
+	}
+	mv.handle("GET", "/v1/secret/metadata/app", list("api.key", "cache", "db/"))
+	mv.handle("GET", "/v1/secret/metadata/app/db", list("url"))
+	mv.seed("secret/data/app/api.key", map[string]interface{}{"value": "k"})
+	mv.seed("secret/data/app/cache", map[string]interface{}{"host": "redis", "port": "6379"})
+	mv.seed("secret/data/app/db/url", map[string]interface{}{"value": "postgres://db"})
+}
+
+func TestReadVaultTree(t *testing.T) {
+	mv := newMockVault(t)
+	seedVaultTree(mv)
+
+	got, err := readVaultTree(mv.client(t, "secret"), "app/", "value", ".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"api.key":    "k",
+		"cache.host": "redis",
+		"cache.port": "6379",
+		"db.url":     "postgres://db",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+}
+
+func TestReverseToSops(t *testing.T) {
+	mv := newMockVault(t)
+	seedVaultTree(mv)
+	outputFile := filepath.Join(t.TempDir(), "app.enc.yaml")
+
+	var gotArgs []string
+	var gotPlain map[string]interface{}
+	stubSops(t, func(args ...string) ([]byte, error) {
+		gotArgs = args
+		content, _ := os.ReadFile(args[len(args)-1])
+		yaml.Unmarshal(content, &gotPlain)
+		return nil, os.WriteFile(args[len(args)-2], []byte("encrypted: true\n"), 0600)
+	})
+
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", KVVersion: 2, Separator: ".", VaultKeyName: "value"}
+	if err := reverseToSops(cfg, "app", outputFile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"api":   map[string]interface{}{"key": "k"},
+		"cache": map[string]interface{}{"host": "redis", "port": "6379"},
+		"db":    map[string]interface{}{"url": "postgres://db"},
+	}
+	if !reflect.DeepEqual(gotPlain, expected) {
+		t.Errorf("plaintext = %v, expected %v", gotPlain, expected)
+	}
+	if gotArgs[5] != "--filename-override" || gotArgs[6] != outputFile {
+		t.Errorf("args = %v, expected --filename-override %s", gotArgs, outputFile)
+	}
+	if content, _ := os.ReadFile(outputFile); string(content) != "encrypted: true\n" {
+		t.Errorf("output = %q, expected the encrypted file", content)
+	}
+
+	t.Run("keeps the master keys of an existing file", func(t *testing.T) {
+		os.WriteFile(outputFile, []byte("sops:\n  age:\n    - recipient: age1xyz\n"), 0600)
+		if err := reverseToSops(cfg, "app", outputFile); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := gotArgs[7:9]; !reflect.DeepEqual(got, []string{"--age", "age1xyz"}) {
+			t.Errorf("key args = %v, expected [--age age1xyz]", got)
+		}
+	})
+
+	t.Run("empty path", func(t *testing.T) {
+		if err := reverseToSops(cfg, "missing", outputFile); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Character sets for --rotate-charset.
+var rotateCharsets = map[string]string{
+	"alphanumeric": "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789",
+	"hex":          "0123456789abcdef",
+	"base64url":    "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_",
+	"ascii":        "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!#$%&()*+,-./:;<=>?@[]^_{|}~",
+}
+
+// defaultRotateCharset and defaultRotateLength are what --rotate generates
+// unless told otherwise.
+const (
+	defaultRotateCharset = "alphanumeric"
+	defaultRotateLength  = 32
+)
+
+// generateSecret returns length characters picked uniformly at random from
+// the named charset using crypto/rand.
+func generateSecret(length int, charset string) (string, error) {
+	chars, ok := rotateCharsets[charset]
+	if !ok {
+		return "", fmt.Errorf("unknown charset %q", charset)
+	}
+	max := big.NewInt(int64(len(chars)))
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("generating random value: %w", err)
+		}
+		b[i] = chars[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// rotateKeys generates a new value for each of keys, which must all be in
+// flattened, and stores it in sopsFile with sops set, unless dryRun. It
+// returns just the rotated keys with their new values, for writing to Vault.
+func rotateKeys(cfg Config, sopsFile string, flattened map[string]interface{}, keys []string, dryRun bool) (map[string]interface{}, error) {
+	rotated, _, err := filterByExactKeys(flattened, keys)
+	if err != nil {
+		return nil, err
+	}
+	for k := range rotated {
+		value, err := generateSecret(cfg.RotateLength, cfg.RotateCharset)
+		if err != nil {
+			return nil, err
+		}
+		rotated[k] = value
+	}
+	if dryRun {
+		return rotated, nil
+	}
+
+	// Update the SOPS file first: it is the source of truth, so a failed
+	// Vault write can be retried by running again without --rotate
+	for _, k := range keys {
+		encoded, err := json.Marshal(rotated[k])
+		if err != nil {
+			return nil, err
+		}
+		_, err = decryptWithAgeKeyFile(cfg.AgeKeyFile, func() ([]byte, error) {
+			return runSops("set", sopsFile, sopsIndex(k, cfg.Separator), string(encoded))
+		})
+		if err != nil {
+			return nil, fmt.Errorf("updating %s in %s: %w", k, sopsFile, err)
+		}
+	}
+	return rotated, nil
+}
+
+// sopsIndex returns the sops set index for a flattened key, one bracketed
+// segment per level: "db.password" -> ["db"]["password"].
+func sopsIndex(key, sep string) string {
+	var b strings.Builder
+	for _, segment := range strings.Split(key, sep) {
+		encoded, _ := json.Marshal(segment)
+		b.WriteString("[" + string(encoded) + "]")
+	}
+	return b.String()
+}
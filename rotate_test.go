@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGenerateSecret(t *testing.T) {
+	for name, chars := range rotateCharsets {
+		t.Run(name, func(t *testing.T) {
+			value, err := generateSecret(64, name)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(value) != 64 {
+				t.Errorf("length = %d, expected 64", len(value))
+			}
+			for _, c := range value {
+				if !strings.ContainsRune(chars, c) {
+					t.Errorf("character %q not in %s charset", c, name)
+				}
+			}
+		})
+	}
+
+	if _, err := generateSecret(8, "emoji"); err == nil {
+		t.Error("expected error for unknown charset")
+	}
+}
+
+func TestSopsIndex(t *testing.T) {
+	if got := sopsIndex("db.password", "."); got != `["db"]["password"]` {
+		t.Errorf("sopsIndex = %s", got)
+	}
+	if got := sopsIndex("API_KEY", "."); got != `["API_KEY"]` {
+		t.Errorf("sopsIndex = %s", got)
+	}
+}
+
+func TestProcessFileRotate(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+
+	sopsFile := filepath.Join(t.TempDir(), "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("db:\n  password: old\n  url: u\n"), 0644)
+
+	var sets [][]string
+	stubSops(t, func(args ...string) ([]byte, error) {
+		sets = append(sets, args)
+		return nil, nil
+	})
+
+	cfg := Config{
+		VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret",
+		RotateKeys: []string{"db.password"}, RotateLength: 16, RotateCharset: "hex",
+	}
+
+	t.Run("dry run changes nothing", func(t *testing.T) {
+		cfg := cfg
+		cfg.DryRun = true
+		if err := processFile(context.Background(), cfg, sopsFile, "app"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(sets) != 0 || len(mv.Calls()) != 0 {
+			t.Errorf("dry run called sops %v and Vault %v", sets, mv.Calls())
+		}
+	})
+
+	if err := processFile(context.Background(), cfg, sopsFile, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sets) != 1 {
+		t.Fatalf("sops calls = %v, expected one set", sets)
+	}
+	var newValue string
+	json.Unmarshal([]byte(sets[0][3]), &newValue)
+	if expected := []string{"set", sopsFile, `["db"]["password"]`}; !reflect.DeepEqual(sets[0][:3], expected) {
+		t.Errorf("sops args = %v, expected %v", sets[0][:3], expected)
+	}
+	if len(newValue) != 16 || newValue == "old" {
+		t.Errorf("new value = %q, expected 16 random hex characters", newValue)
+	}
+
+	if got := mv.stored("secret/data/app/db.password"); got["value"] != newValue {
+		t.Errorf("Vault value = %v, expected %s", got, newValue)
+	}
+	if got := mv.stored("secret/data/app/db.url"); got != nil {
+		t.Errorf("unrotated key was written: %v", got)
+	}
+}
+
+func TestRotateKeysMissing(t *testing.T) {
+	cfg := Config{RotateLength: 8, RotateCharset: defaultRotateCharset, Separator: "."}
+	if _, err := rotateKeys(cfg, "app.enc.yaml", map[string]interface{}{"a": "1"}, []string{"b"}, true); err == nil {
+		t.Fatal("expected error for a key not in the SOPS file")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// routeRule sends the flattened keys matching a glob (match) or a regular
+// expression (regex) to path instead of the <vault-path> argument.
+type routeRule struct {
+	Match string `yaml:"match"`
+	Regex string `yaml:"regex"`
+	Path  string `yaml:"path"`
+
+	re *regexp.Regexp
+}
+
+// routingConfig is a --routing-config file: rules tried in order, the first
+// matching rule choosing a key's Vault path.
+type routingConfig struct {
+	Routes []routeRule `yaml:"routes"`
+}
+
+// loadRoutingConfig reads and validates a --routing-config file.
+func loadRoutingConfig(file string) (*routingConfig, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading routing config: %w", err)
+	}
+	var cfg routingConfig
+	if err := yaml.Unmarshal(content, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing routing config: %w", err)
+	}
+	if len(cfg.Routes) == 0 {
+		return nil, fmt.Errorf("routing config %s has no routes", file)
+	}
+
+	for i := range cfg.Routes {
+		r := &cfg.Routes[i]
+		r.Path = strings.Trim(r.Path, "/")
+		if r.Path == "" {
+			return nil, fmt.Errorf("routing config route %d: path is required", i+1)
+		}
+		switch {
+		case (r.Match == "") == (r.Regex == ""):
+			return nil, fmt.Errorf("routing config route %d: exactly one of match or regex is required", i+1)
+		case r.Match != "":
+			if _, err := path.Match(r.Match, ""); err != nil {
+				return nil, fmt.Errorf("routing config route %d: invalid glob %q: %w", i+1, r.Match, err)
+			}
+		default:
+			if r.re, err = regexp.Compile(r.Regex); err != nil {
+				return nil, fmt.Errorf("routing config route %d: invalid regex: %w", i+1, err)
+			}
+		}
+	}
+	return &cfg, nil
+}
+
+// route returns the Vault path (under the mount) for key: the path of the
+// first rule it matches, or defaultPath. A nil config routes every key to
+// defaultPath.
+func (c *routingConfig) route(key, defaultPath string) string {
+	if c == nil {
+		return defaultPath
+	}
+	for _, r := range c.Routes {
+		if r.re != nil {
+			if r.re.MatchString(key) {
+				return r.Path
+			}
+		} else if ok, _ := path.Match(r.Match, key); ok {
+			return r.Path
+		}
+	}
+	return defaultPath
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeRoutingConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "routing.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadRoutingConfig(t *testing.T) {
+	cfg, err := loadRoutingConfig(writeRoutingConfig(t, `routes:
+  - match: "db.*"
+    path: databases/
+  - regex: "^(api|oauth)\\."
+    path: api-keys
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{"db.password", "databases"},
+		{"db.replica.url", "databases"},
+		{"api.key", "api-keys"},
+		{"oauth.secret", "api-keys"},
+		{"token", "myproject/app"},
+		{"mydb.password", "myproject/app"},
+	}
+	for _, tt := range tests {
+		if got := cfg.route(tt.key, "myproject/app"); got != tt.expected {
+			t.Errorf("route(%q) = %q, expected %q", tt.key, got, tt.expected)
+		}
+	}
+
+	errorCases := map[string]string{
+		"no routes":       "routes: []\n",
+		"missing path":    "routes:\n  - match: \"db.*\"\n",
+		"match and regex": "routes:\n  - match: \"db.*\"\n    regex: \"^db\"\n    path: p\n",
+		"neither":         "routes:\n  - path: p\n",
+		"bad glob":        "routes:\n  - match: \"db.[\"\n    path: p\n",
+		"bad regex":       "routes:\n  - regex: \"(\"\n    path: p\n",
+	}
+	for name, content := range errorCases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadRoutingConfig(writeRoutingConfig(t, content)); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestProcessFileRouting(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+
+	sopsFile := filepath.Join(t.TempDir(), "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("db:\n  password: p\napi:\n  key: k\ntoken: t\n"), 0644)
+
+	routing, err := loadRoutingConfig(writeRoutingConfig(t, "routes:\n  - match: \"db.*\"\n    path: databases\n  - match: \"api.*\"\n    path: api-keys\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", Routing: routing}
+	if err := processFile(context.Background(), cfg, sopsFile, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for path, expected := range map[string]string{
+		"secret/data/databases/db.password": "p",
+		"secret/data/api-keys/api.key":      "k",
+		"secret/data/app/token":             "t",
+	} {
+		if got := mv.stored(path); got["value"] != expected {
+			t.Errorf("%s = %v, expected %s", path, got, expected)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// secretsManagerAPI is the part of the Secrets Manager client
+// SecretsManagerBackend uses.
+type secretsManagerAPI interface {
+	CreateSecret(ctx context.Context, params *secretsmanager.CreateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.CreateSecretOutput, error)
+	PutSecretValue(ctx context.Context, params *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error)
+}
+
+// SecretsManagerBackend writes each secret to AWS Secrets Manager as a
+// plaintext secret named <vault-path>/<key>.
+type SecretsManagerBackend struct {
+	client secretsManagerAPI
+}
+
+// NewSecretsManagerBackend creates a Secrets Manager backend using the
+// standard AWS credential chain (AWS_REGION, AWS_PROFILE, etc.).
+func NewSecretsManagerBackend(ctx context.Context) (*SecretsManagerBackend, error) {
+	awsCfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS config: %w", err)
+	}
+	return &SecretsManagerBackend{client: secretsmanager.NewFromConfig(awsCfg)}, nil
+}
+
+// Location returns the secret name for key.
+func (s *SecretsManagerBackend) Location(basePath, key string) string {
+	return basePath + "/" + key
+}
+
+// WriteSecrets stores a new version of each key's secret, creating the
+// secret if it doesn't exist yet.
+func (s *SecretsManagerBackend) WriteSecrets(ctx context.Context, basePath string, keys []string, data map[string]interface{}) (int, error) {
+	written := 0
+	for _, key := range keys {
+		name := s.Location(basePath, key)
+		value := aws.String(formatValue(data[key]))
+		_, err := s.client.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+			SecretId:     aws.String(name),
+			SecretString: value,
+		})
+		var notFound *types.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			_, err = s.client.CreateSecret(ctx, &secretsmanager.CreateSecretInput{
+				Name:         aws.String(name),
+				SecretString: value,
+			})
+		}
+		if err != nil {
+			return written, fmt.Errorf("failed to write Secrets Manager secret %s: %w", name, err)
+		}
+		written++
+	}
+	return written, nil
+}
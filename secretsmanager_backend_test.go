@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// fakeSecretsManager stores secret values by name and records each call.
+type fakeSecretsManager struct {
+	secrets map[string]string
+	calls   []string
+	err     error
+}
+
+func (f *fakeSecretsManager) CreateSecret(ctx context.Context, params *secretsmanager.CreateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.CreateSecretOutput, error) {
+	f.calls = append(f.calls, "create "+aws.ToString(params.Name))
+	f.secrets[aws.ToString(params.Name)] = aws.ToString(params.SecretString)
+	return &secretsmanager.CreateSecretOutput{}, nil
+}
+
+func (f *fakeSecretsManager) PutSecretValue(ctx context.Context, params *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error) {
+	name := aws.ToString(params.SecretId)
+	f.calls = append(f.calls, "put "+name)
+	if f.err != nil {
+		return nil, f.err
+	}
+	if _, ok := f.secrets[name]; !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("secret not found")}
+	}
+	f.secrets[name] = aws.ToString(params.SecretString)
+	return &secretsmanager.PutSecretValueOutput{}, nil
+}
+
+func TestSecretsManagerBackendWriteSecrets(t *testing.T) {
+	fake := &fakeSecretsManager{secrets: map[string]string{"myapp/db.password": "old"}}
+	backend := &SecretsManagerBackend{client: fake}
+
+	data := map[string]interface{}{"db.password": "s3cr3t", "db.port": 5432}
+	written, err := backend.WriteSecrets(context.Background(), "myapp", []string{"db.password", "db.port"}, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if written != 2 {
+		t.Errorf("written = %d, expected 2", written)
+	}
+
+	expectedCalls := []string{"put myapp/db.password", "put myapp/db.port", "create myapp/db.port"}
+	if !reflect.DeepEqual(fake.calls, expectedCalls) {
+		t.Errorf("calls = %v, expected %v", fake.calls, expectedCalls)
+	}
+	expected := map[string]string{"myapp/db.password": "s3cr3t", "myapp/db.port": "5432"}
+	if !reflect.DeepEqual(fake.secrets, expected) {
+		t.Errorf("secrets = %v, expected %v", fake.secrets, expected)
+	}
+
+	t.Run("stops on error", func(t *testing.T) {
+		backend := &SecretsManagerBackend{client: &fakeSecretsManager{err: errors.New("access denied")}}
+		if _, err := backend.WriteSecrets(context.Background(), "myapp", []string{"db.password"}, data); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// simulatedVault is an in-memory stand-in for the KV API of a Vault server,
+// for --simulate. The normal VaultClient talks to it over HTTP, so the whole
+// write pipeline runs exactly as it would against a real server. It starts
+// empty, and keeps each secret's fields, as strings, by API path under the
+// mount (without KV v2's data/ prefix).
+type simulatedVault struct {
+	mount     string
+	kvVersion int
+
+	mu       sync.Mutex
+	secrets  map[string]map[string]string
+	versions map[string]int
+}
+
+// newSimulatedVault creates an empty store for a KV engine of kvVersion at
+// mount.
+func newSimulatedVault(mount string, kvVersion int) *simulatedVault {
+	if kvVersion == 0 {
+		kvVersion = 2
+	}
+	return &simulatedVault{
+		mount:     strings.Trim(mount, "/"),
+		kvVersion: kvVersion,
+		secrets:   make(map[string]map[string]string),
+		versions:  make(map[string]int),
+	}
+}
+
+// Start serves the store on a local address, until the process exits, and
+// returns its URL.
+func (s *simulatedVault) Start() string {
+	return httptest.NewServer(s).URL
+}
+
+func (s *simulatedVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest, ok := strings.CutPrefix(r.URL.Path, "/v1/"+s.mount+"/")
+	if !ok {
+		simulatedError(w, http.StatusNotFound, "no handler for route "+r.URL.Path)
+		return
+	}
+	endpoint, path := "data", rest
+	if s.kvVersion == 2 {
+		endpoint, path, _ = strings.Cut(rest, "/")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := r.Method == "LIST" || (r.Method == http.MethodGet && r.URL.Query().Get("list") == "true")
+	switch {
+	case list && (endpoint == "metadata" || s.kvVersion == 1):
+		s.list(w, path)
+	case r.Method == http.MethodGet && endpoint == "data":
+		s.read(w, path)
+	case r.Method == http.MethodGet && endpoint == "metadata":
+		if _, ok := s.secrets[path]; !ok {
+			simulatedError(w, http.StatusNotFound, "")
+			return
+		}
+		writeSimulatedJSON(w, map[string]interface{}{"data": map[string]interface{}{"current_version": s.versions[path]}})
+	case (r.Method == http.MethodPut || r.Method == http.MethodPost) && endpoint == "data":
+		s.write(w, r, path)
+	case r.Method == http.MethodPatch && endpoint == "metadata":
+		// Custom metadata (--tags) isn't part of the simulated state
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete && (endpoint == "metadata" || s.kvVersion == 1):
+		delete(s.secrets, path)
+		delete(s.versions, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		simulatedError(w, http.StatusMethodNotAllowed, "unsupported by --simulate: "+r.Method+" "+r.URL.Path)
+	}
+}
+
+func (s *simulatedVault) read(w http.ResponseWriter, path string) {
+	secret, ok := s.secrets[path]
+	if !ok {
+		simulatedError(w, http.StatusNotFound, "")
+		return
+	}
+	if s.kvVersion == 1 {
+		writeSimulatedJSON(w, map[string]interface{}{"data": secret})
+		return
+	}
+	writeSimulatedJSON(w, map[string]interface{}{"data": map[string]interface{}{
+		"data":     secret,
+		"metadata": map[string]interface{}{"version": s.versions[path]},
+	}})
+}
+
+func (s *simulatedVault) write(w http.ResponseWriter, r *http.Request, path string) {
+	var body map[string]interface{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		simulatedError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	data := body
+	if s.kvVersion == 2 {
+		data, _ = body["data"].(map[string]interface{})
+		if options, ok := body["options"].(map[string]interface{}); ok {
+			if cas, ok := options["cas"].(json.Number); ok && cas.String() != fmt.Sprint(s.versions[path]) {
+				simulatedError(w, http.StatusBadRequest, "check-and-set parameter did not match the current version")
+				return
+			}
+		}
+	}
+
+	secret := make(map[string]string, len(data))
+	for field, value := range data {
+		secret[field] = formatValue(value)
+	}
+	s.secrets[path] = secret
+	s.versions[path]++
+	writeSimulatedJSON(w, map[string]interface{}{"data": map[string]interface{}{"version": s.versions[path]}})
+}
+
+// list answers a LIST of path with the names directly beneath it, sub-paths
+// ending in "/".
+func (s *simulatedVault) list(w http.ResponseWriter, path string) {
+	prefix := strings.Trim(path, "/") + "/"
+	if prefix == "/" {
+		prefix = ""
+	}
+	seen := make(map[string]bool)
+	var keys []string
+	for p := range s.secrets {
+		rest, ok := strings.CutPrefix(p, prefix)
+		if !ok {
+			continue
+		}
+		if i := strings.Index(rest, "/"); i != -1 {
+			rest = rest[:i+1]
+		}
+		if !seen[rest] {
+			seen[rest] = true
+			keys = append(keys, rest)
+		}
+	}
+	if len(keys) == 0 {
+		simulatedError(w, http.StatusNotFound, "")
+		return
+	}
+	sort.Strings(keys)
+	writeSimulatedJSON(w, map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+}
+
+// State returns the stored secrets keyed by <mount>/<path>, with each value
+// masked according to mask, as dry-run masks it.
+func (s *simulatedVault) State(mask string) map[string]map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := make(map[string]map[string]string, len(s.secrets))
+	for path, secret := range s.secrets {
+		masked := make(map[string]string, len(secret))
+		for field, value := range secret {
+			masked[field] = maskValue(value, mask)
+		}
+		state[s.mount+"/"+path] = masked
+	}
+	return state
+}
+
+// PrintState writes State to w as indented JSON.
+func (s *simulatedVault) PrintState(w io.Writer, mask string) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(s.State(mask))
+}
+
+func writeSimulatedJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+func simulatedError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	errs := []string{}
+	if message != "" {
+		errs = append(errs, message)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": errs})
+}
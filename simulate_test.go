@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSimulatedVault(t *testing.T) {
+	stubDecrypt(t)
+	sopsFile := filepath.Join(t.TempDir(), "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("db:\n  password: p4ss\n  port: 5432\ntoken: t\n"), 0644)
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		expected map[string]map[string]string
+	}{
+		{
+			name: "kv v2",
+			cfg:  Config{Mount: "secret", KVVersion: 2, ReadVerify: true},
+			expected: map[string]map[string]string{
+				"secret/app/db.password": {"value": "<string, 4 chars>"},
+				"secret/app/db.port":     {"value": "<string, 4 chars>"},
+				"secret/app/token":       {"value": "<string, 1 chars>"},
+			},
+		},
+		{
+			name: "kv v1 bundle",
+			cfg:  Config{Mount: "kv", KVVersion: 1, Bundle: true},
+			expected: map[string]map[string]string{
+				"kv/app": {"db.password": "<string, 4 chars>", "db.port": "<string, 4 chars>", "token": "<string, 1 chars>"},
+			},
+		},
+		{
+			name: "sync",
+			cfg:  Config{Mount: "secret", KVVersion: 2, Sync: true, SplitTopLevel: true},
+			expected: map[string]map[string]string{
+				"secret/app/db/password": {"value": "<string, 4 chars>"},
+				"secret/app/db/port":     {"value": "<string, 4 chars>"},
+				"secret/app/misc/token":  {"value": "<string, 1 chars>"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulated := newSimulatedVault(tt.cfg.Mount, tt.cfg.KVVersion)
+			server := httptest.NewServer(simulated)
+			defer server.Close()
+
+			cfg := tt.cfg
+			cfg.VaultAddr, cfg.VaultToken = server.URL, "simulated"
+			// Twice, so the second run reads, overwrites, and lists what the
+			// first wrote
+			for i := 0; i < 2; i++ {
+				if err := processFile(context.Background(), cfg, sopsFile, "app"); err != nil {
+					t.Fatalf("run %d: unexpected error: %v", i+1, err)
+				}
+			}
+			if got := simulated.State(maskModeLength); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("State() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSimulatedVaultPrintState(t *testing.T) {
+	simulated := newSimulatedVault("secret", 2)
+	simulated.secrets["app/token"] = map[string]string{"value": "t"}
+	var buf strings.Builder
+	if err := simulated.PrintState(&buf, maskModeLength); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "{\n  \"secret/app/token\": {\n    \"value\": \"<string, 1 chars>\"\n  }\n}\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\ngot:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
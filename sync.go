@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// syncPlan is what --sync does besides writing: which paths under the vault
+// path already exist, and which of them are stale and get deleted.
+type syncPlan struct {
+	existing map[string]bool
+	Stale    []string
+}
+
+// planSync lists the secrets already under vaultPath, depth levels down (1
+// for secrets directly under it, 2 for secrets in its sub-paths), and returns
+// the ones not in targets as stale. Only the levels the current layout writes
+// to are listed, so unrelated secrets elsewhere are left alone.
+func planSync(client *VaultClient, vaultPath string, depth int, targets []string) (*syncPlan, error) {
+	plan := &syncPlan{existing: make(map[string]bool)}
+	if err := listSecretsAtDepth(client, vaultPath, depth, plan.existing); err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(targets))
+	for _, t := range targets {
+		wanted[t] = true
+	}
+	for p := range plan.existing {
+		if !wanted[p] {
+			plan.Stale = append(plan.Stale, p)
+		}
+	}
+	sort.Strings(plan.Stale)
+	return plan, nil
+}
+
+func listSecretsAtDepth(client *VaultClient, path string, depth int, found map[string]bool) error {
+	if depth < 1 {
+		return nil
+	}
+	names, err := client.ListKV(path)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		isDir := strings.HasSuffix(name, "/")
+		child := path + "/" + strings.TrimSuffix(name, "/")
+		switch {
+		case depth == 1 && !isDir:
+			found[child] = true
+		case depth > 1 && isDir:
+			if err := listSecretsAtDepth(client, child, depth-1, found); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Summary counts the written paths that were added and updated, given the
+// paths written.
+func (p *syncPlan) Summary(written []string) (added, updated int) {
+	for _, w := range written {
+		if p.existing[w] {
+			updated++
+		} else {
+			added++
+		}
+	}
+	return added, updated
+}
+
+// printSyncDryRun lists the stale paths a --sync run would delete.
+func printSyncDryRun(w io.Writer, mount string, plan *syncPlan) {
+	fmt.Fprintf(w, "[dry-run] Would delete %d stale Vault paths (all versions):\n", len(plan.Stale))
+	for _, p := range plan.Stale {
+		fmt.Fprintf(w, "  %s/%s\n", mount, p)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPlanSync(t *testing.T) {
+	mv := newMockVault(t)
+	seedVaultTree(mv)
+	client := mv.client(t, "secret")
+
+	tests := []struct {
+		name          string
+		depth         int
+		targets       []string
+		expectedStale []string
+	}{
+		{"top level only", 1, []string{"app/api.key"}, []string{"app/cache"}},
+		{"sub-paths only", 2, nil, []string{"app/db/url"}},
+		{"nothing listed", 0, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := planSync(client, "app", tt.depth, tt.targets)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(plan.Stale, tt.expectedStale) {
+				t.Errorf("stale = %v, expected %v", plan.Stale, tt.expectedStale)
+			}
+		})
+	}
+}
+
+func TestSyncPlanSummary(t *testing.T) {
+	plan := &syncPlan{existing: map[string]bool{"app/a": true, "app/b": true}}
+	added, updated := plan.Summary([]string{"app/a", "app/c", "app/d"})
+	if added != 2 || updated != 1 {
+		t.Errorf("added, updated = %d, %d, expected 2, 1", added, updated)
+	}
+}
+
+func TestProcessFileSync(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+	mv.handle("GET", "/v1/secret/metadata/app", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"data": map[string]interface{}{"keys": []string{"db.password", "old.key", "nested/"}}})
+	})
+	mv.seed("secret/data/app/db.password", map[string]interface{}{"value": "old"})
+	mv.seed("secret/data/app/old.key", map[string]interface{}{"value": "stale"})
+
+	sopsFile := filepath.Join(t.TempDir(), "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("db:\n  password: p\n  url: u\n"), 0644)
+
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", Sync: true, DryRun: true}
+	if err := processFile(context.Background(), cfg, sopsFile, "app"); err != nil {
+		t.Fatalf("dry-run: unexpected error: %v", err)
+	}
+	if mv.stored("secret/data/app/old.key") == nil {
+		t.Fatal("dry-run deleted a stale secret")
+	}
+
+	cfg.DryRun = false
+	if err := processFile(context.Background(), cfg, sopsFile, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mv.stored("secret/data/app/old.key") != nil {
+		t.Error("expected stale secret to be deleted")
+	}
+	if got := mv.stored("secret/data/app/db.url"); got["value"] != "u" {
+		t.Errorf("db.url = %v, expected u", got)
+	}
+	if got := mv.stored("secret/data/app/db.password"); got["value"] != "p" {
+		t.Errorf("db.password = %v, expected p", got)
+	}
+}
+
+func TestProcessFileSyncWriteFailure(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+	mv.handle("GET", "/v1/secret/metadata/app", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"data": map[string]interface{}{"keys": []string{"db.password", "old.key"}}})
+	})
+	mv.handle("PUT", "/v1/secret/data/app/db.url", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+	})
+	mv.seed("secret/data/app/old.key", map[string]interface{}{"value": "stale"})
+
+	sopsFile := filepath.Join(t.TempDir(), "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("db:\n  password: p\n  url: u\n"), 0644)
+
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", Sync: true, ExistsStrategy: strategyOverwrite}
+	if err := processFile(context.Background(), cfg, sopsFile, "app"); err == nil {
+		t.Fatal("expected the failed write to be reported")
+	}
+	if mv.stored("secret/data/app/old.key") == nil {
+		t.Error("stale secret was deleted although a write failed")
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// formatTerraform is the --output-format that prints Terraform variable
+// declarations and a tfvars file instead of writing to Vault.
+const formatTerraform = "terraform"
+
+// terraformVarsFile is the file the values are written to, next to
+// --output-file, with --output-format=terraform.
+const terraformVarsFile = "terraform.tfvars"
+
+// terraformVarName turns a flattened key into a Terraform identifier:
+// characters other than letters, digits, "_", and "-" become "_", and a
+// leading digit or "-" gets a "_" prefix.
+func terraformVarName(key string) string {
+	name := []rune(key)
+	for i, r := range name {
+		if !(r == '_' || r == '-' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 || name[0] == '-' || name[0] >= '0' && name[0] <= '9' {
+		return "_" + string(name)
+	}
+	return string(name)
+}
+
+// terraformString quotes s as an HCL string literal, escaping template
+// sequences so the value is used literally.
+func terraformString(s string) string {
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	quoted := strings.TrimSuffix(b.String(), "\n")
+	return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(quoted)
+}
+
+// terraformValue formats a secret for a tfvars file: numbers and booleans
+// as themselves, everything else as a string.
+func terraformValue(v interface{}) string {
+	switch v.(type) {
+	case int, int64, uint64, float64, bool:
+		return formatValue(v)
+	}
+	return terraformString(formatValue(v))
+}
+
+// printTerraform writes a sensitive variable block for each key in data to
+// decls, and its value to values in tfvars syntax. Two keys with the same
+// variable name are an error.
+func printTerraform(decls, values io.Writer, data map[string]interface{}) error {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	names := make([]string, len(keys))
+	from := make(map[string]string, len(keys))
+	for i, k := range keys {
+		names[i] = terraformVarName(k)
+		if prev, dup := from[names[i]]; dup {
+			return fmt.Errorf("keys %s and %s both become Terraform variable %s", prev, k, names[i])
+		}
+		from[names[i]] = k
+	}
+
+	for _, name := range names {
+		fmt.Fprintf(decls, "variable %q {\n  sensitive = true\n}\n\n", name)
+	}
+	for i, name := range names {
+		fmt.Fprintf(values, "%s = %s\n", name, terraformValue(data[keys[i]]))
+	}
+	return nil
+}
+
+// writeTerraform handles --output-format=terraform: without outputFile, the
+// declarations and then a terraform.tfvars section go to stdout; otherwise
+// the declarations go to outputFile (e.g. secrets.tf) and the values to
+// terraform.tfvars in the same directory.
+func writeTerraform(outputFile string, data map[string]interface{}) error {
+	var decls, values strings.Builder
+	if err := printTerraform(&decls, &values, data); err != nil {
+		return err
+	}
+	if outputFile == "" {
+		fmt.Printf("%s# %s\n%s", decls.String(), terraformVarsFile, values.String())
+		return nil
+	}
+
+	varsFile := filepath.Join(filepath.Dir(outputFile), terraformVarsFile)
+	if err := os.WriteFile(outputFile, []byte(decls.String()), 0644); err != nil {
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	if err := os.WriteFile(varsFile, []byte(values.String()), 0600); err != nil {
+		return fmt.Errorf("writing %s: %w", varsFile, err)
+	}
+	fmt.Printf("Wrote %d Terraform variables to %s and their values to %s\n", len(data), outputFile, varsFile)
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrintTerraform(t *testing.T) {
+	data := map[string]interface{}{
+		"db.password": `p"a${ss}`,
+		"db.port":     5432,
+		"2fa-secret":  "x\ny",
+	}
+
+	var decls, values strings.Builder
+	if err := printTerraform(&decls, &values, data); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedDecls := "variable \"_2fa-secret\" {\n  sensitive = true\n}\n\n" +
+		"variable \"db_password\" {\n  sensitive = true\n}\n\n" +
+		"variable \"db_port\" {\n  sensitive = true\n}\n\n"
+	if decls.String() != expectedDecls {
+		t.Errorf("unexpected declarations:\ngot:\n%s\nexpected:\n%s", decls.String(), expectedDecls)
+	}
+	expectedValues := "_2fa-secret = \"x\\ny\"\n" +
+		"db_password = \"p\\\"a$${ss}\"\n" +
+		"db_port = 5432\n"
+	if values.String() != expectedValues {
+		t.Errorf("unexpected values:\ngot:\n%s\nexpected:\n%s", values.String(), expectedValues)
+	}
+
+	t.Run("clash", func(t *testing.T) {
+		data := map[string]interface{}{"db.password": "a", "db_password": "b"}
+		if err := printTerraform(&strings.Builder{}, &strings.Builder{}, data); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestWriteTerraformFiles(t *testing.T) {
+	dir := t.TempDir()
+	outputFile := filepath.Join(dir, "secrets.tf")
+	if err := writeTerraform(outputFile, map[string]interface{}{"token": "t"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	decls, _ := os.ReadFile(outputFile)
+	if string(decls) != "variable \"token\" {\n  sensitive = true\n}\n\n" {
+		t.Errorf("unexpected secrets.tf:\n%s", decls)
+	}
+	varsFile := filepath.Join(dir, terraformVarsFile)
+	values, _ := os.ReadFile(varsFile)
+	if string(values) != "token = \"t\"\n" {
+		t.Errorf("unexpected terraform.tfvars:\n%s", values)
+	}
+	info, err := os.Stat(varsFile)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("terraform.tfvars mode = %v, expected 0600", info.Mode().Perm())
+	}
+}
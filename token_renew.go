@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// startTokenRenewal renews client's token in the background every half of its
+// TTL, starting from ttl, so a long import doesn't outlive the token. A
+// failed renewal is reported to w and ends the renewals. The returned stop
+// function ends them and waits for the goroutine to exit.
+func startTokenRenewal(client *VaultClient, ttl time.Duration, w io.Writer) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		renewToken(ctx, client, ttl, w)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// renewToken is the renewal loop of startTokenRenewal. It returns once ctx is
+// done, a renewal fails, or the token can't be extended any further.
+func renewToken(ctx context.Context, client *VaultClient, ttl time.Duration, w io.Writer) {
+	for ttl > 0 {
+		timer := time.NewTimer(ttl / 2)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		var err error
+		if ttl, err = client.RenewSelf(); err != nil {
+			fmt.Fprintf(w, "Warning: %v; the token may expire before the run ends\n", err)
+			return
+		}
+	}
+}
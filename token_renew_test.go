@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRenewToken(t *testing.T) {
+	mv := newMockVault(t)
+	renewed := make(chan struct{}, 10)
+	mv.handle("PUT", "/v1/auth/token/renew-self", func(w http.ResponseWriter, r *http.Request) {
+		renewed <- struct{}{}
+		writeJSON(w, map[string]interface{}{"auth": map[string]interface{}{"client_token": "test-token", "lease_duration": 3600}})
+	})
+	client := mv.client(t, "secret")
+
+	var out bytes.Buffer
+	stop := startTokenRenewal(client, 20*time.Millisecond, &out)
+	select {
+	case <-renewed:
+	case <-time.After(time.Second):
+		t.Fatal("token was not renewed")
+	}
+	// The next renewal is half an hour away; stop must not wait for it
+	stop()
+	if out.Len() > 0 {
+		t.Errorf("unexpected output: %s", out.String())
+	}
+
+	t.Run("failed renewal", func(t *testing.T) {
+		mv.handle("PUT", "/v1/auth/token/renew-self", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			writeJSON(w, map[string]interface{}{"errors": []string{"permission denied"}})
+		})
+		var out bytes.Buffer
+		done := make(chan struct{})
+		go func() {
+			renewToken(context.Background(), client, 20*time.Millisecond, &out)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("renewal loop didn't stop after a failed renewal")
+		}
+		if !bytes.Contains(out.Bytes(), []byte("failed to renew vault token")) {
+			t.Errorf("expected a warning, got %q", out.String())
+		}
+	})
+}
+
+func TestWhoAmIRenewable(t *testing.T) {
+	mv := newMockVault(t)
+	mv.handle("GET", "/v1/auth/token/lookup-self", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"data": map[string]interface{}{"ttl": 600, "renewable": true}})
+	})
+	info, err := mv.client(t, "secret").WhoAmI()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !info.Renewable || info.TTL != 10*time.Minute {
+		t.Errorf("got %+v, expected a renewable token with a 10m TTL", info)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// tokenSink is a Vault Agent file sink: a file the agent rewrites with a
+// fresh token whenever it re-authenticates. Once watched, every client
+// attached to it is switched to each new token. A nil *tokenSink does
+// nothing.
+type tokenSink struct {
+	path string
+
+	mu      sync.Mutex
+	token   string
+	clients []*VaultClient
+}
+
+// newTokenSink reads the current token from the sink file at path.
+func newTokenSink(path string) (*tokenSink, error) {
+	token, err := readTokenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenSink{path: filepath.Clean(path), token: token}, nil
+}
+
+// Token returns the most recent token read from the sink.
+func (s *tokenSink) Token() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token
+}
+
+// attach switches client to the sink's current token, and to every later
+// one.
+func (s *tokenSink) attach(client *VaultClient) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client.client.SetToken(s.token)
+	s.clients = append(s.clients, client)
+}
+
+// reload rereads the sink file and, if it holds a new token, switches the
+// attached clients to it. It reports whether the token changed.
+func (s *tokenSink) reload() (bool, error) {
+	token, err := readTokenFile(s.path)
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token == s.token {
+		return false, nil
+	}
+	s.token = token
+	for _, c := range s.clients {
+		c.client.SetToken(token)
+	}
+	return true, nil
+}
+
+// watch reloads the token whenever the sink file changes, noting each new
+// token on w. The sink's directory is watched, since agents replace the file
+// rather than writing it in place. The returned stop function ends the
+// watch and waits for it to finish.
+func (s *tokenSink) watch(w io.Writer) (func(), error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("watching token sink: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(s.path)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("watching token sink: %w", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != s.path || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				// A half-written or briefly missing file is retried on the
+				// next event
+				if changed, err := s.reload(); err == nil && changed {
+					fmt.Fprintf(w, "Using new Vault token from %s\n", s.path)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				fmt.Fprintf(w, "Warning: watching token sink: %v\n", err)
+			}
+		}
+	}()
+	return func() {
+		watcher.Close()
+		<-done
+	}, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe to write from the watch goroutine.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func TestTokenSink(t *testing.T) {
+	mv := newMockVault(t)
+	path := filepath.Join(t.TempDir(), "agent-token")
+	os.WriteFile(path, []byte("token-1\n"), 0600)
+
+	sink, err := newTokenSink(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client := mv.client(t, "secret")
+	sink.attach(client)
+	if got := client.client.Token(); got != "token-1" {
+		t.Fatalf("token = %q, expected token-1", got)
+	}
+
+	var out syncBuffer
+	stop, err := sink.watch(&out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Agents write a temp file and rename it over the sink
+	tmp := filepath.Join(filepath.Dir(path), ".agent-token.tmp")
+	os.WriteFile(tmp, []byte("token-2\n"), 0600)
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for client.client.Token() != "token-2" {
+		if time.Now().After(deadline) {
+			t.Fatalf("token = %q after sink update, expected token-2", client.client.Token())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sink.Token() != "token-2" {
+		t.Errorf("sink token = %q, expected token-2", sink.Token())
+	}
+	stop()
+	if !bytes.Contains(out.buf.Bytes(), []byte("Using new Vault token")) {
+		t.Errorf("expected a note about the new token, got %q", out.buf.String())
+	}
+
+	t.Run("empty sink", func(t *testing.T) {
+		empty := filepath.Join(t.TempDir(), "agent-token")
+		os.WriteFile(empty, nil, 0600)
+		if _, err := newTokenSink(empty); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingServiceName is the service.name traces are exported under, and
+// the name of each run's root span.
+const tracingServiceName = "sops-to-vault"
+
+// tracer creates the pipeline's spans. Until setupTracing installs a
+// provider (with --otel-endpoint) they're no-ops.
+var tracer = otel.Tracer("github.com/ethanadams/sops-to-vault")
+
+// Span attributes recorded on the pipeline's spans.
+const (
+	attrVaultPath = "vault.path"
+	attrKeyCount  = "key.count"
+	attrSopsFile  = "sops.file"
+	attrError     = "error"
+)
+
+// setupTracing exports spans over OTLP to endpoint: http:// or https:// for
+// OTLP/HTTP (at /v1/traces unless the URL has a path), grpc:// or grpcs://
+// for OTLP/gRPC. The returned shutdown flushes any spans not yet exported.
+func setupTracing(ctx context.Context, endpoint string) (shutdown func(context.Context) error, err error) {
+	exporter, err := newTraceExporter(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(sdkresource.NewSchemaless(attribute.String("service.name", tracingServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+func newTraceExporter(ctx context.Context, endpoint string) (sdktrace.SpanExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid --otel-endpoint %q (expected a URL such as http://localhost:4318 or grpc://localhost:4317)", endpoint)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+		if u.Path != "" && u.Path != "/" {
+			opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+		}
+		if u.Scheme == "http" {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, opts...)
+	case "grpc", "grpcs":
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(u.Host)}
+		if u.Scheme == "grpc" {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("invalid --otel-endpoint %q (expected an http, https, grpc, or grpcs URL)", endpoint)
+	}
+}
+
+// endSpan ends span, marking it failed with err if err isn't nil.
+func endSpan(span trace.Span, err error) {
+	span.SetAttributes(attribute.Bool(attrError, err != nil))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
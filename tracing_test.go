@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestProcessFileTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := tracer
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	t.Cleanup(func() { tracer = prev })
+
+	stubDecrypt(t)
+	mv := newMockVault(t)
+	sopsFile := filepath.Join(t.TempDir(), "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("db:\n  password: p\n  user: u\n"), 0644)
+
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", ExistsStrategy: strategyOverwrite}
+	if err := processFile(context.Background(), cfg, sopsFile, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	attrs := make(map[string][]map[attribute.Key]attribute.Value)
+	for _, span := range recorder.Ended() {
+		values := make(map[attribute.Key]attribute.Value)
+		for _, kv := range span.Attributes() {
+			values[kv.Key] = kv.Value
+		}
+		attrs[span.Name()] = append(attrs[span.Name()], values)
+	}
+	if len(attrs["decrypt"]) != 1 || attrs["decrypt"][0][attrSopsFile].AsString() != sopsFile {
+		t.Errorf("decrypt spans = %v, expected one for %s", attrs["decrypt"], sopsFile)
+	}
+	if len(attrs["flatten"]) != 1 || attrs["flatten"][0][attrKeyCount].AsInt64() != 2 {
+		t.Errorf("flatten spans = %v, expected one with 2 keys", attrs["flatten"])
+	}
+	writes := attrs["vault.write"]
+	if len(writes) != 2 {
+		t.Fatalf("vault.write spans = %v, expected 2", writes)
+	}
+	for _, w := range writes {
+		if w[attrError].AsBool() {
+			t.Errorf("vault.write span for %s marked as an error", w[attrVaultPath].AsString())
+		}
+	}
+	if got := writes[0][attrVaultPath].AsString(); got != "app/db.password" {
+		t.Errorf("first vault.write path = %q, expected app/db.password", got)
+	}
+}
+
+func TestNewTraceExporterInvalid(t *testing.T) {
+	for _, endpoint := range []string{"localhost:4318", "ftp://collector:21", "http://"} {
+		if _, err := newTraceExporter(context.Background(), endpoint); err == nil {
+			t.Errorf("newTraceExporter(%q): expected an error", endpoint)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// deprecationFile is the format of --key-deprecation-file.
+type deprecationFile struct {
+	Deprecations map[string]string `yaml:"deprecations"`
+}
+
+// loadDeprecationMap reads a YAML file mapping deprecated flattened key
+// names to their replacements.
+func loadDeprecationMap(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading deprecation file: %w", err)
+	}
+
+	var f deprecationFile
+	if err := yaml.Unmarshal(content, &f); err != nil {
+		return nil, fmt.Errorf("parsing deprecation file: %w", err)
+	}
+	if f.Deprecations == nil {
+		return map[string]string{}, nil
+	}
+	return f.Deprecations, nil
+}
+
+// applyDeprecations returns a warning for every deprecated key present in data.
+// If rename is true, deprecated keys are moved to their replacement name,
+// unless the replacement already exists, in which case the deprecated key is dropped.
+func applyDeprecations(data map[string]interface{}, deprecations map[string]string, rename bool) []string {
+	deprecated := make([]string, 0)
+	for k := range data {
+		if _, ok := deprecations[k]; ok {
+			deprecated = append(deprecated, k)
+		}
+	}
+	sort.Strings(deprecated)
+
+	var warnings []string
+	for _, old := range deprecated {
+		replacement := deprecations[old]
+		warnings = append(warnings, fmt.Sprintf("Key '%s' is deprecated; use '%s' instead", old, replacement))
+		if !rename {
+			continue
+		}
+		if _, exists := data[replacement]; exists {
+			warnings = append(warnings, fmt.Sprintf("Key '%s' already exists, dropping deprecated '%s'", replacement, old))
+		} else {
+			data[replacement] = data[old]
+		}
+		delete(data, old)
+	}
+	return warnings
+}
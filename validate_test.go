@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadDeprecationMap(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	t.Run("parses deprecations", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "deprecations.yaml")
+		os.WriteFile(path, []byte("deprecations:\n  \"db.pass\": \"db.password\"\n  \"api.key\": \"api.secret\"\n"), 0644)
+
+		result, err := loadDeprecationMap(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := map[string]string{"db.pass": "db.password", "api.key": "api.secret"}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("loadDeprecationMap() = %v, expected %v", result, expected)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := loadDeprecationMap(filepath.Join(tmpDir, "missing.yaml")); err == nil {
+			t.Fatal("expected error for missing file")
+		}
+	})
+}
+
+func TestApplyDeprecations(t *testing.T) {
+	deprecations := map[string]string{"db.pass": "db.password", "api.key": "api.secret"}
+
+	t.Run("warns without renaming", func(t *testing.T) {
+		data := map[string]interface{}{"db.pass": "x", "other": "y"}
+		warnings := applyDeprecations(data, deprecations, false)
+
+		expected := []string{"Key 'db.pass' is deprecated; use 'db.password' instead"}
+		if !reflect.DeepEqual(warnings, expected) {
+			t.Errorf("warnings = %v, expected %v", warnings, expected)
+		}
+		if _, ok := data["db.pass"]; !ok {
+			t.Error("deprecated key should be kept when not renaming")
+		}
+	})
+
+	t.Run("renames to replacement", func(t *testing.T) {
+		data := map[string]interface{}{"db.pass": "x", "api.key": "k"}
+		applyDeprecations(data, deprecations, true)
+
+		expected := map[string]interface{}{"db.password": "x", "api.secret": "k"}
+		if !reflect.DeepEqual(data, expected) {
+			t.Errorf("data = %v, expected %v", data, expected)
+		}
+	})
+
+	t.Run("keeps existing replacement", func(t *testing.T) {
+		data := map[string]interface{}{"db.pass": "old", "db.password": "new"}
+		warnings := applyDeprecations(data, deprecations, true)
+
+		expected := map[string]interface{}{"db.password": "new"}
+		if !reflect.DeepEqual(data, expected) {
+			t.Errorf("data = %v, expected %v", data, expected)
+		}
+		if len(warnings) != 2 {
+			t.Errorf("expected 2 warnings, got %v", warnings)
+		}
+	})
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// valueTemplateData is what a --value-template is executed with.
+type valueTemplateData struct {
+	Key   string
+	Value string
+}
+
+// parseValueTemplate parses a --value-template.
+func parseValueTemplate(text string) (*template.Template, error) {
+	return template.New("value-template").Option("missingkey=error").Parse(text)
+}
+
+// applyValueTemplate returns data with each value replaced by tmpl executed
+// for its key and value, as the string to store in Vault.
+func applyValueTemplate(tmpl *template.Template, data map[string]interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, valueTemplateData{Key: k, Value: formatValue(v)}); err != nil {
+			return nil, fmt.Errorf("executing --value-template for %s: %w", k, err)
+		}
+		result[k] = b.String()
+	}
+	return result, nil
+}
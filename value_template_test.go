@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestApplyValueTemplate(t *testing.T) {
+	data := map[string]interface{}{"db.password": "s3cr3t", "db.port": 5432}
+
+	tests := []struct {
+		name     string
+		tmpl     string
+		expected map[string]interface{}
+	}{
+		{"identity", "{{.Value}}", map[string]interface{}{"db.password": "s3cr3t", "db.port": "5432"}},
+		{"json wrapped", `{"value":"{{.Value}}"}`, map[string]interface{}{"db.password": `{"value":"s3cr3t"}`, "db.port": `{"value":"5432"}`}},
+		{"key", "{{.Key}}={{.Value}}", map[string]interface{}{"db.password": "db.password=s3cr3t", "db.port": "db.port=5432"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseValueTemplate(tt.tmpl)
+			if err != nil {
+				t.Fatalf("unexpected parse error: %v", err)
+			}
+			result, err := applyValueTemplate(tmpl, data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("got %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+
+	t.Run("unknown field", func(t *testing.T) {
+		tmpl, err := parseValueTemplate("{{.Secret}}")
+		if err != nil {
+			t.Fatalf("unexpected parse error: %v", err)
+		}
+		if _, err := applyValueTemplate(tmpl, data); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestProcessFileValueTemplate(t *testing.T) {
+	stubDecrypt(t)
+	mv := newMockVault(t)
+	tmpDir := t.TempDir()
+
+	sopsFile := filepath.Join(tmpDir, "app-secrets.enc.yaml")
+	os.WriteFile(sopsFile, []byte("db:\n  password: p\n"), 0644)
+	counterpart := filepath.Join(tmpDir, "app.yaml")
+	os.WriteFile(counterpart, []byte("db:\n  password: placeholder\n"), 0644)
+
+	tmpl, _ := parseValueTemplate(`{"password":"{{.Value}}"}`)
+	cfg := Config{VaultAddr: mv.URL, VaultToken: "test-token", Mount: "secret", KVVersion: 2, Parallelism: 1,
+		ExistsStrategy: strategyOverwrite, ValueTemplate: tmpl, VaultKeyName: "json", ReadVerify: true, UpdateCounterpart: true}
+	if err := processFile(context.Background(), cfg, sopsFile, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]interface{}{"json": `{"password":"p"}`}
+	if got := mv.stored("secret/data/app/db.password"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("stored = %v, expected %v", got, expected)
+	}
+	content, _ := os.ReadFile(counterpart)
+	if expected := "db:\n  password: ref+vault://secret/app/db.password#json\n"; string(content) != expected {
+		t.Errorf("counterpart = %q, expected %q", content, expected)
+	}
+}
@@ -1,51 +1,550 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/api"
 )
 
 type VaultClient struct {
-	client     *api.Client
-	mountPath  string
+	client    *api.Client
+	mountPath string
+	kvVersion int
 }
 
-// NewVaultClient creates a new Vault client configured for KV v2.
-func NewVaultClient(addr, token, mountPath string) (*VaultClient, error) {
+// VaultWriter is the part of VaultClient that writing secrets uses:
+// writeSecrets and the deletes, backups, diffs, verification, and rollback
+// around it. Tests can run them against a fake instead of a Vault server.
+type VaultWriter interface {
+	WriteKVData(path string, data map[string]interface{}) error
+	WriteKVDataCAS(path string, data map[string]interface{}, version int) error
+	MergeKV(path string, newData map[string]interface{}) error
+	DeleteKVAllVersions(path string) error
+	PatchMetadata(path string, tags map[string]string) error
+	ReadKVField(path, field string) (string, error)
+	ReadKVMetadata(path string) (*KVMetadata, error)
+	readKV(path string) (map[string]interface{}, int, error)
+	restoreKV(path string, data map[string]interface{}) error
+}
+
+var _ VaultWriter = (*VaultClient)(nil)
+
+// vaultConn describes how to reach a Vault server.
+type vaultConn struct {
+	Addr string
+	// Namespace, if set, is sent as X-Vault-Namespace on every request.
+	Namespace string
+	// TLS, if set, replaces the TLS settings taken from the environment
+	// (VAULT_CACERT etc.).
+	TLS *api.TLSConfig
+	// Log, if set, gets the method and URL of every request before it is
+	// sent (--verbose). Bodies, which hold secret values, aren't logged.
+	Log io.Writer
+}
+
+// loggingTransport writes each request's method and URL to w before sending
+// it with next.
+type loggingTransport struct {
+	next http.RoundTripper
+	w    io.Writer
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fmt.Fprintf(t.w, "%s %s\n", req.Method, req.URL)
+	return t.next.RoundTrip(req)
+}
+
+// newAPIClient creates an unauthenticated Vault API client for conn. The
+// client's own retries are disabled; writes are retried by withRetry.
+func newAPIClient(conn vaultConn) (*api.Client, error) {
 	config := api.DefaultConfig()
-	config.Address = addr
+	config.Address = conn.Addr
+	config.MaxRetries = 0
+	if conn.TLS != nil {
+		if err := config.ConfigureTLS(conn.TLS); err != nil {
+			return nil, fmt.Errorf("configuring vault TLS: %w", err)
+		}
+	}
 
 	client, err := api.NewClient(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create vault client: %w", err)
 	}
+	if conn.Namespace != "" {
+		client.SetNamespace(conn.Namespace)
+	}
+	if conn.Log != nil {
+		config.HttpClient.Transport = &loggingTransport{next: config.HttpClient.Transport, w: conn.Log}
+	}
+	return client, nil
+}
+
+// NewVaultClient creates a new Vault client for a KV mount of the given
+// engine version (1 or 2; 0 means 2).
+func NewVaultClient(conn vaultConn, token, mountPath string, kvVersion int) (*VaultClient, error) {
+	if kvVersion == 0 {
+		kvVersion = 2
+	}
+	if kvVersion != 1 && kvVersion != 2 {
+		return nil, fmt.Errorf("unsupported KV version %d (must be 1 or 2)", kvVersion)
+	}
+
+	client, err := newAPIClient(conn)
+	if err != nil {
+		return nil, err
+	}
 
 	client.SetToken(token)
 
 	return &VaultClient{
 		client:    client,
 		mountPath: mountPath,
+		kvVersion: kvVersion,
 	}, nil
 }
 
-// WriteKVv2 writes a single secret value to a KV v2 path.
-// The value is stored under the "value" key as a string.
-func (v *VaultClient) WriteKVv2(path string, value interface{}) error {
-	// Convert value to string - vals and other tools expect string values
-	strValue := fmt.Sprintf("%v", value)
+// DetectKVVersion looks the client's mount up in sys/mounts and returns the
+// version of the KV secrets engine there: 2 if the mount's version option
+// says so, otherwise 1. It is an error if nothing, or something other than
+// a KV engine, is mounted there.
+func (v *VaultClient) DetectKVVersion() (int, error) {
+	mounts, err := v.client.Sys().ListMounts()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list vault mounts: %w", err)
+	}
+	mount, ok := mounts[strings.Trim(v.mountPath, "/")+"/"]
+	if !ok {
+		return 0, fmt.Errorf("no secrets engine is mounted at %s", v.mountPath)
+	}
+	// "generic" is the KV engine's name on old Vault servers
+	if mount.Type != "kv" && mount.Type != "generic" {
+		return 0, fmt.Errorf("%s is a %s secrets engine, not kv", v.mountPath, mount.Type)
+	}
+	if mount.Options["version"] == "2" {
+		return 2, nil
+	}
+	return 1, nil
+}
+
+// kvPath returns the API path for a secret. KV v1 secrets live directly
+// under the mount; KV v2 puts them under an endpoint prefix such as "data"
+// or "metadata".
+func (v *VaultClient) kvPath(endpoint, path string) string {
+	return kvAPIPath(v.mountPath, v.kvVersion, endpoint, path)
+}
+
+// kvAPIPath is kvPath for a mount that has no client, such as when
+// generating a policy.
+func kvAPIPath(mount string, kvVersion int, endpoint, path string) string {
+	if kvVersion == 1 {
+		return fmt.Sprintf("%s/%s", mount, path)
+	}
+	return fmt.Sprintf("%s/%s/%s", mount, endpoint, path)
+}
+
+// defaultValueField is the secret field each value is stored under, unless
+// --vault-key-name says otherwise.
+const defaultValueField = "value"
+
+// WriteKV writes a single secret value to path using the client's KV
+// version. The value is stored under the "value" key as a string.
+func (v *VaultClient) WriteKV(path string, value interface{}) error {
+	return v.WriteKVData(path, map[string]interface{}{defaultValueField: value})
+}
+
+// WriteKVData writes data as the whole secret at path, with every value
+// converted to a string.
+func (v *VaultClient) WriteKVData(path string, data map[string]interface{}) error {
+	// Convert values to strings - vals and other tools expect string values
+	secretData := stringValues(data)
+
+	if v.kvVersion == 1 {
+		return v.writeKVv1(path, secretData)
+	}
+	return v.writeKVv2(path, secretData)
+}
+
+// errCASConflict is returned by WriteKVDataCAS when the secret is no longer
+// at the expected version.
+var errCASConflict = errors.New("check-and-set conflict")
 
+// WriteKVDataCAS is WriteKVData with check-and-set: the write only succeeds
+// if the secret is still at version (0 meaning it doesn't exist yet), and
+// fails with errCASConflict otherwise. It requires KV v2.
+func (v *VaultClient) WriteKVDataCAS(path string, data map[string]interface{}, version int) error {
+	if v.kvVersion == 1 {
+		return fmt.Errorf("check-and-set requires a KV v2 mount")
+	}
 	secretData := map[string]interface{}{
-		"data": map[string]interface{}{
-			"value": strValue,
-		},
+		"data":    stringValues(data),
+		"options": map[string]interface{}{"cas": version},
 	}
+	if _, err := v.client.Logical().Write(v.kvPath("data", path), secretData); err != nil {
+		var respErr *api.ResponseError
+		if errors.As(err, &respErr) && respErr.StatusCode == http.StatusBadRequest && strings.Contains(respErr.Error(), "check-and-set") {
+			return fmt.Errorf("vault path %s changed since version %d was read: %w", path, version, errCASConflict)
+		}
+		return fmt.Errorf("failed to write to vault path %s: %w", path, err)
+	}
+	return nil
+}
 
-	fullPath := fmt.Sprintf("%s/data/%s", v.mountPath, path)
-	_, err := v.client.Logical().Write(fullPath, secretData)
-	if err != nil {
+// stringValues returns a copy of data with every value formatted by
+// formatValue.
+func stringValues(data map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(data))
+	for k, val := range data {
+		result[k] = formatValue(val)
+	}
+	return result
+}
+
+// writeKVv1 writes data as-is to a KV v1 path.
+func (v *VaultClient) writeKVv1(path string, data map[string]interface{}) error {
+	if _, err := v.client.Logical().Write(v.kvPath("", path), data); err != nil {
+		return fmt.Errorf("failed to write to vault path %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeKVv2 writes data as a new version of a KV v2 path.
+func (v *VaultClient) writeKVv2(path string, data map[string]interface{}) error {
+	if _, err := v.client.Logical().Write(v.kvPath("data", path), map[string]interface{}{"data": data}); err != nil {
 		return fmt.Errorf("failed to write to vault path %s: %w", path, err)
 	}
+	return nil
+}
+
+// readKV reads the data map of a secret and, for KV v2, its current
+// version. A missing secret returns a nil map and version 0; KV v1 secrets
+// always report version 0.
+func (v *VaultClient) readKV(path string) (map[string]interface{}, int, error) {
+	secret, err := v.client.Logical().Read(v.kvPath("data", path))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read vault path %s: %w", path, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, 0, nil
+	}
+	if v.kvVersion == 1 {
+		return secret.Data, 0, nil
+	}
+
+	data, _ := secret.Data["data"].(map[string]interface{})
+	version := 0
+	if metadata, ok := secret.Data["metadata"].(map[string]interface{}); ok {
+		if n, ok := metadata["version"].(json.Number); ok {
+			i, _ := n.Int64()
+			version = int(i)
+		}
+	}
+	return data, version, nil
+}
+
+// ReadKV reads back the string stored under the "value" key at path, as
+// written by WriteKV. A missing secret or value is an error.
+func (v *VaultClient) ReadKV(path string) (string, error) {
+	return v.ReadKVField(path, defaultValueField)
+}
+
+// ReadKVField is ReadKV for the string stored under field.
+func (v *VaultClient) ReadKVField(path, field string) (string, error) {
+	data, _, err := v.readKV(path)
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault path %s has no %s", path, field)
+	}
+	return value, nil
+}
+
+// ListKV returns the names under path: secrets, and sub-paths with a
+// trailing "/". A missing path returns no names.
+func (v *VaultClient) ListKV(path string) ([]string, error) {
+	secret, err := v.client.Logical().List(v.kvPath("metadata", path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vault path %s: %w", path, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	raw, _ := secret.Data["keys"].([]interface{})
+	keys := make([]string, 0, len(raw))
+	for _, k := range raw {
+		if s, ok := k.(string); ok {
+			keys = append(keys, s)
+		}
+	}
+	return keys, nil
+}
+
+// KVMetadata is the version metadata of a KV v2 secret.
+type KVMetadata struct {
+	CurrentVersion int
+	UpdatedTime    time.Time
+}
+
+// ReadKVMetadata reads the metadata of a KV v2 secret. KV v1 keeps no
+// metadata, so it returns nil there, as it does for a missing secret.
+func (v *VaultClient) ReadKVMetadata(path string) (*KVMetadata, error) {
+	if v.kvVersion == 1 {
+		return nil, nil
+	}
+	secret, err := v.client.Logical().Read(v.kvPath("metadata", path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata of vault path %s: %w", path, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	metadata := &KVMetadata{}
+	if n, ok := secret.Data["current_version"].(json.Number); ok {
+		i, _ := n.Int64()
+		metadata.CurrentVersion = int(i)
+	}
+	if s, ok := secret.Data["updated_time"].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			metadata.UpdatedTime = t.UTC()
+		}
+	}
+	return metadata, nil
+}
+
+// MergeKV merges newData into the existing secret at path and writes the
+// result. On KV v2 the write uses check-and-set against the version that was
+// read, so a concurrent update causes an error instead of being silently
+// lost. KV v1 has no versions, so the merge there is last-writer-wins.
+func (v *VaultClient) MergeKV(path string, newData map[string]interface{}) error {
+	existing, version, err := v.readKV(path)
+	if err != nil {
+		return err
+	}
+
+	merged := make(map[string]interface{}, len(existing)+len(newData))
+	for k, val := range existing {
+		merged[k] = val
+	}
+	for k, val := range newData {
+		merged[k] = val
+	}
+
+	secretData := merged
+	if v.kvVersion == 2 {
+		secretData = map[string]interface{}{
+			"data":    merged,
+			"options": map[string]interface{}{"cas": version},
+		}
+	}
+
+	if _, err := v.client.Logical().Write(v.kvPath("data", path), secretData); err != nil {
+		return fmt.Errorf("failed to merge into vault path %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// PatchMetadata sets custom metadata on the KV v2 secret at path, merging
+// tags into any it already has. KV v1 has no metadata, so it is an error
+// there.
+func (v *VaultClient) PatchMetadata(path string, tags map[string]string) error {
+	if v.kvVersion == 1 {
+		return fmt.Errorf("can't tag vault path %s: custom metadata requires KV v2", path)
+	}
+	metadata := map[string]interface{}{"custom_metadata": tags}
+	if _, err := v.client.Logical().JSONMergePatch(context.Background(), v.kvPath("metadata", path), metadata); err != nil {
+		return fmt.Errorf("failed to tag vault path %s: %w", path, err)
+	}
+	return nil
+}
 
+// DeleteKVAllVersions permanently deletes a path. On KV v2 this deletes the
+// metadata, destroying all versions.
+func (v *VaultClient) DeleteKVAllVersions(path string) error {
+	if _, err := v.client.Logical().Delete(v.kvPath("metadata", path)); err != nil {
+		return fmt.Errorf("failed to delete vault path %s: %w", path, err)
+	}
 	return nil
 }
+
+// restoreKV puts a path back to data, or permanently deletes the path if
+// data is nil (it didn't exist before).
+func (v *VaultClient) restoreKV(path string, data map[string]interface{}) error {
+	if data == nil {
+		return v.DeleteKVAllVersions(path)
+	}
+
+	if v.kvVersion == 1 {
+		return v.writeKVv1(path, data)
+	}
+	return v.writeKVv2(path, data)
+}
+
+// TokenInfo describes the token the client is authenticated with.
+type TokenInfo struct {
+	TTL        time.Duration
+	ExpireTime time.Time
+	Renewable  bool
+}
+
+// WhoAmI looks up the current token via auth/token/lookup-self.
+// A zero TTL means the token never expires.
+func (v *VaultClient) WhoAmI() (*TokenInfo, error) {
+	secret, err := v.client.Auth().Token().LookupSelf()
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up vault token: %w", err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("failed to look up vault token: empty response")
+	}
+
+	ttl, err := secret.TokenTTL()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse vault token ttl: %w", err)
+	}
+
+	renewable, _ := secret.TokenIsRenewable()
+	info := &TokenInfo{TTL: ttl, Renewable: renewable}
+	if ttl > 0 {
+		info.ExpireTime = time.Now().Add(ttl).UTC()
+		if s, ok := secret.Data["expire_time"].(string); ok && s != "" {
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				info.ExpireTime = t.UTC()
+			}
+		}
+	}
+
+	return info, nil
+}
+
+// RenewSelf renews the client's token and returns its new TTL.
+func (v *VaultClient) RenewSelf() (time.Duration, error) {
+	secret, err := v.client.Auth().Token().RenewSelf(0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to renew vault token: %w", err)
+	}
+	if secret == nil || secret.Auth == nil {
+		return 0, fmt.Errorf("failed to renew vault token: empty response")
+	}
+	return time.Duration(secret.Auth.LeaseDuration) * time.Second, nil
+}
+
+// login writes body to auth/<authPath>/login and returns the resulting
+// client token. method names the auth method in errors.
+func login(client *api.Client, method, authPath string, body map[string]interface{}) (string, error) {
+	secret, err := client.Logical().Write("auth/"+authPath+"/login", body)
+	if err != nil {
+		return "", fmt.Errorf("%s login failed: %w", method, err)
+	}
+	return loginToken(method, secret)
+}
+
+// loginToken returns the client token of a login response.
+func loginToken(method string, secret *api.Secret) (string, error) {
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return "", fmt.Errorf("%s login failed: no client token in response", method)
+	}
+	return secret.Auth.ClientToken, nil
+}
+
+// authenticateJWT logs in to the JWT/OIDC auth method mounted at authPath
+// and returns the resulting client token.
+func authenticateJWT(client *api.Client, authPath, role, jwt string) (string, error) {
+	return login(client, "jwt", authPath, map[string]interface{}{
+		"role": role,
+		"jwt":  jwt,
+	})
+}
+
+// authenticateAppRole logs in to the AppRole auth method at auth/approle
+// and returns the resulting client token.
+func authenticateAppRole(client *api.Client, roleID, secretID string) (string, error) {
+	return login(client, "approle", "approle", map[string]interface{}{
+		"role_id":   roleID,
+		"secret_id": secretID,
+	})
+}
+
+// authenticateKubernetes logs in to the Kubernetes auth method at
+// auth/kubernetes with a service account token and returns the resulting
+// client token.
+func authenticateKubernetes(client *api.Client, role, jwt string) (string, error) {
+	return login(client, "kubernetes", "kubernetes", map[string]interface{}{
+		"role": role,
+		"jwt":  jwt,
+	})
+}
+
+// authenticateLDAP logs in to the LDAP auth method at auth/ldap and returns
+// the resulting client token. If Vault requires MFA to complete the login,
+// passcode is called (once) for any method that takes a passcode, such as
+// TOTP; push methods like Duo are approved out of band.
+func authenticateLDAP(client *api.Client, username, password string, passcode func() (string, error)) (string, error) {
+	secret, err := client.Logical().Write("auth/ldap/login/"+url.PathEscape(username), map[string]interface{}{
+		"password": password,
+	})
+	if err != nil {
+		return "", fmt.Errorf("ldap login failed: %w", err)
+	}
+	if secret != nil && secret.Auth != nil && secret.Auth.MFARequirement != nil {
+		if secret, err = validateMFA(client, secret.Auth.MFARequirement, passcode); err != nil {
+			return "", fmt.Errorf("ldap login failed: %w", err)
+		}
+	}
+	return loginToken("ldap", secret)
+}
+
+// validateMFA completes a login that requires MFA, satisfying each
+// constraint with its first method, and returns the final login response.
+func validateMFA(client *api.Client, req *api.MFARequirement, passcode func() (string, error)) (*api.Secret, error) {
+	var code string
+	payload := make(map[string]interface{}, len(req.MFAConstraints))
+	for name, constraint := range req.MFAConstraints {
+		if constraint == nil || len(constraint.Any) == 0 {
+			return nil, fmt.Errorf("MFA constraint %s has no methods", name)
+		}
+		method := constraint.Any[0]
+		if !method.UsesPasscode {
+			payload[method.ID] = []string{}
+			continue
+		}
+		if code == "" {
+			var err error
+			if code, err = passcode(); err != nil {
+				return nil, fmt.Errorf("reading MFA passcode: %w", err)
+			}
+		}
+		payload[method.ID] = []string{code}
+	}
+
+	secret, err := client.Sys().MFAValidate(req.MFARequestID, payload)
+	if err != nil {
+		return nil, fmt.Errorf("MFA validation failed: %w", err)
+	}
+	return secret, nil
+}
+
+// resolveJWT returns value itself if it looks like a JWT (JWTs start with
+// "ey", the base64 of '{"'), otherwise reads the JWT from the file it names.
+func resolveJWT(value string) (string, error) {
+	if strings.HasPrefix(value, "ey") {
+		return value, nil
+	}
+	data, err := os.ReadFile(value)
+	if err != nil {
+		return "", fmt.Errorf("reading JWT file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,677 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// mockVault is an in-memory stand-in for the Vault HTTP API. It records
+// every request and stores written bodies keyed by their API path, so a
+// GET returns whatever was last written to the same path. KV v2 data paths
+// (containing "/data/") are versioned and honor options.cas.
+type mockVault struct {
+	*httptest.Server
+
+	// delay is added to every response, to simulate network latency
+	delay time.Duration
+
+	mu       sync.Mutex
+	calls    []string
+	data     map[string]map[string]interface{}
+	versions map[string]int
+	handlers map[string]http.HandlerFunc
+}
+
+func newMockVault(t testing.TB) *mockVault {
+	t.Helper()
+	m := &mockVault{
+		data:     make(map[string]map[string]interface{}),
+		versions: make(map[string]int),
+		handlers: make(map[string]http.HandlerFunc),
+	}
+	m.Server = httptest.NewServer(http.HandlerFunc(m.serve))
+	t.Cleanup(m.Close)
+	return m
+}
+
+// handle overrides the response for a single method and API path,
+// e.g. handle("GET", "/v1/auth/token/lookup-self", ...).
+func (m *mockVault) handle(method, path string, h http.HandlerFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[method+" "+path] = h
+}
+
+// Calls returns the "METHOD /v1/path" log of every request received.
+func (m *mockVault) Calls() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.calls...)
+}
+
+// client returns a KV v2 VaultClient pointed at the mock server.
+func (m *mockVault) client(t testing.TB, mount string) *VaultClient {
+	t.Helper()
+	c, err := NewVaultClient(vaultConn{Addr: m.URL}, "test-token", mount, 2)
+	if err != nil {
+		t.Fatalf("NewVaultClient: %v", err)
+	}
+	return c
+}
+
+func (m *mockVault) serve(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	key := r.Method + " " + r.URL.Path
+	m.calls = append(m.calls, key)
+	h := m.handlers[key]
+	m.mu.Unlock()
+
+	if m.delay > 0 {
+		time.Sleep(m.delay)
+	}
+
+	if h != nil {
+		h(w, r)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	switch r.Method {
+	case http.MethodPut, http.MethodPost:
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if isKVv2DataPath(path) {
+			if opts, ok := body["options"].(map[string]interface{}); ok {
+				if cas, ok := opts["cas"].(float64); ok && int(cas) != m.versions[path] {
+					w.WriteHeader(http.StatusBadRequest)
+					writeJSON(w, map[string]interface{}{"errors": []string{"check-and-set parameter did not match the current version"}})
+					return
+				}
+			}
+			m.versions[path]++
+		}
+		m.data[path] = body
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet:
+		m.mu.Lock()
+		body, ok := m.data[path]
+		version := m.versions[path]
+		m.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			writeJSON(w, map[string]interface{}{"errors": []string{}})
+			return
+		}
+		if isKVv2DataPath(path) {
+			writeJSON(w, map[string]interface{}{"data": map[string]interface{}{
+				"data":     body["data"],
+				"metadata": map[string]interface{}{"version": version},
+			}})
+			return
+		}
+		writeJSON(w, map[string]interface{}{"data": body})
+	case http.MethodDelete:
+		// Deleting metadata destroys every version of the secret
+		if strings.Contains(path, "/metadata/") {
+			path = strings.Replace(path, "/metadata/", "/data/", 1)
+		}
+		m.mu.Lock()
+		delete(m.data, path)
+		delete(m.versions, path)
+		m.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+	}
+}
+
+// seed stores a KV v2 secret as if it had been written once.
+func (m *mockVault) seed(path string, data map[string]interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[path] = map[string]interface{}{"data": data}
+	m.versions[path]++
+}
+
+// stored returns the data map of a KV v2 secret, or nil if absent.
+func (m *mockVault) stored(path string) map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, _ := m.data[path]["data"].(map[string]interface{})
+	return data
+}
+
+func isKVv2DataPath(path string) bool {
+	return strings.Contains(path, "/data/")
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestWriteKV(t *testing.T) {
+	t.Run("kv v2", func(t *testing.T) {
+		mv := newMockVault(t)
+		client := mv.client(t, "secret")
+
+		if err := client.WriteKV("myapp/db.port", 5432); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		calls := mv.Calls()
+		if len(calls) != 1 || calls[0] != "PUT /v1/secret/data/myapp/db.port" {
+			t.Fatalf("unexpected calls: %v", calls)
+		}
+		data := mv.stored("secret/data/myapp/db.port")
+		if data["value"] != "5432" {
+			t.Errorf("stored value = %v, expected \"5432\"", data["value"])
+		}
+	})
+
+	t.Run("kv v1", func(t *testing.T) {
+		mv := newMockVault(t)
+		client, err := NewVaultClient(vaultConn{Addr: mv.URL}, "test-token", "kv", 1)
+		if err != nil {
+			t.Fatalf("NewVaultClient: %v", err)
+		}
+
+		if err := client.WriteKV("myapp/db.port", 5432); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		calls := mv.Calls()
+		if len(calls) != 1 || calls[0] != "PUT /v1/kv/myapp/db.port" {
+			t.Fatalf("unexpected calls: %v", calls)
+		}
+		// KV v1 stores the map directly, without a "data" wrapper
+		expected := map[string]interface{}{"value": "5432"}
+		if got := mv.data["kv/myapp/db.port"]; !reflect.DeepEqual(got, expected) {
+			t.Errorf("stored = %v, expected %v", got, expected)
+		}
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		if _, err := NewVaultClient(vaultConn{Addr: "http://127.0.0.1:8200"}, "t", "secret", 3); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestReadKV(t *testing.T) {
+	mv := newMockVault(t)
+	client := mv.client(t, "secret")
+	mv.seed("secret/data/myapp/db.password", map[string]interface{}{"value": "hunter2"})
+
+	value, err := client.ReadKV("myapp/db.password")
+	if err != nil || value != "hunter2" {
+		t.Errorf("ReadKV() = (%q, %v), expected hunter2", value, err)
+	}
+	if _, err := client.ReadKV("myapp/missing"); err == nil {
+		t.Error("expected error for missing secret")
+	}
+}
+
+func TestVaultNamespace(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+	}{
+		{"with namespace", "admin/team-a"},
+		{"without namespace", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("VAULT_NAMESPACE", "")
+			mv := newMockVault(t)
+			var got []string
+			mv.handle("PUT", "/v1/secret/data/myapp/key", func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Values("X-Vault-Namespace")
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			client, err := NewVaultClient(vaultConn{Addr: mv.URL, Namespace: tt.namespace}, "test-token", "secret", 2)
+			if err != nil {
+				t.Fatalf("NewVaultClient: %v", err)
+			}
+			if err := client.WriteKV("myapp/key", "v"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tt.namespace == "" {
+				if len(got) != 0 {
+					t.Errorf("X-Vault-Namespace = %v, expected no header", got)
+				}
+			} else if len(got) != 1 || got[0] != tt.namespace {
+				t.Errorf("X-Vault-Namespace = %v, expected %q", got, tt.namespace)
+			}
+		})
+	}
+}
+
+func TestVaultRequestLog(t *testing.T) {
+	mv := newMockVault(t)
+	var log strings.Builder
+	client, err := NewVaultClient(vaultConn{Addr: mv.URL, Log: &log}, "test-token", "secret", 2)
+	if err != nil {
+		t.Fatalf("NewVaultClient: %v", err)
+	}
+	if err := client.WriteKV("myapp/db.url", "s3cr3t"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.ReadKV("myapp/db.url"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "PUT " + mv.URL + "/v1/secret/data/myapp/db.url\n" +
+		"GET " + mv.URL + "/v1/secret/data/myapp/db.url\n"
+	if log.String() != expected {
+		t.Errorf("log = %q, expected %q", log.String(), expected)
+	}
+}
+
+func TestVaultTLS(t *testing.T) {
+	t.Setenv("VAULT_CACERT", "")
+	t.Setenv("VAULT_SKIP_VERIFY", "")
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	os.WriteFile(caFile, caPEM, 0644)
+
+	tests := []struct {
+		name    string
+		tls     *api.TLSConfig
+		wantErr bool
+	}{
+		{"untrusted", nil, true},
+		{"ca cert", &api.TLSConfig{CACert: caFile}, false},
+		{"skip verify", &api.TLSConfig{Insecure: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewVaultClient(vaultConn{Addr: srv.URL, TLS: tt.tls}, "test-token", "secret", 2)
+			if err != nil {
+				t.Fatalf("NewVaultClient: %v", err)
+			}
+			err = client.WriteKV("myapp/key", "v")
+			if tt.wantErr && err == nil {
+				t.Error("expected certificate error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	t.Run("invalid ca cert", func(t *testing.T) {
+		badFile := filepath.Join(t.TempDir(), "bad.pem")
+		os.WriteFile(badFile, []byte("not a certificate"), 0644)
+		if _, err := NewVaultClient(vaultConn{Addr: srv.URL, TLS: &api.TLSConfig{CACert: badFile}}, "t", "secret", 2); err == nil {
+			t.Error("expected error for invalid CA certificate")
+		}
+	})
+}
+
+func TestWhoAmI(t *testing.T) {
+	tests := []struct {
+		name       string
+		ttl        int
+		expireTime interface{}
+		wantTTL    time.Duration
+		wantExpire string
+	}{
+		{"with expiry", 16320, "2025-06-01T15:30:00Z", 16320 * time.Second, "2025-06-01T15:30:00Z"},
+		{"short ttl", 120, "2025-06-01T11:02:00.123456Z", 2 * time.Minute, "2025-06-01T11:02:00Z"},
+		{"no expiry", 0, nil, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mv := newMockVault(t)
+			mv.handle("GET", "/v1/auth/token/lookup-self", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, map[string]interface{}{
+					"data": map[string]interface{}{"ttl": tt.ttl, "expire_time": tt.expireTime},
+				})
+			})
+
+			info, err := mv.client(t, "secret").WhoAmI()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if info.TTL != tt.wantTTL {
+				t.Errorf("TTL = %v, expected %v", info.TTL, tt.wantTTL)
+			}
+			if tt.wantExpire == "" {
+				if !info.ExpireTime.IsZero() {
+					t.Errorf("expected zero ExpireTime, got %v", info.ExpireTime)
+				}
+			} else if got := info.ExpireTime.Format(time.RFC3339); got != tt.wantExpire {
+				t.Errorf("ExpireTime = %s, expected %s", got, tt.wantExpire)
+			}
+		})
+	}
+}
+
+func TestMergeKV(t *testing.T) {
+	mv := newMockVault(t)
+	client := mv.client(t, "secret")
+	mv.seed("secret/data/myapp/db", map[string]interface{}{"value": "old", "owner": "team-a"})
+
+	if err := client.MergeKV("myapp/db", map[string]interface{}{"value": "new"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]interface{}{"value": "new", "owner": "team-a"}
+	if got := mv.stored("secret/data/myapp/db"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("stored = %v, expected %v", got, expected)
+	}
+
+	t.Run("fails on concurrent update", func(t *testing.T) {
+		mv.handle("GET", "/v1/secret/data/myapp/db", func(w http.ResponseWriter, r *http.Request) {
+			// Report a stale version so the CAS write is rejected
+			writeJSON(w, map[string]interface{}{"data": map[string]interface{}{
+				"data":     map[string]interface{}{"value": "new"},
+				"metadata": map[string]interface{}{"version": 1},
+			}})
+		})
+		if err := client.MergeKV("myapp/db", map[string]interface{}{"value": "newer"}); err == nil {
+			t.Fatal("expected CAS error")
+		}
+	})
+
+	t.Run("kv v1", func(t *testing.T) {
+		mv := newMockVault(t)
+		client, err := NewVaultClient(vaultConn{Addr: mv.URL}, "test-token", "kv", 1)
+		if err != nil {
+			t.Fatalf("NewVaultClient: %v", err)
+		}
+		mv.data["kv/myapp/db"] = map[string]interface{}{"value": "old", "owner": "team-a"}
+
+		if err := client.MergeKV("myapp/db", map[string]interface{}{"value": "new"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := mv.data["kv/myapp/db"]; !reflect.DeepEqual(got, expected) {
+			t.Errorf("stored = %v, expected %v", got, expected)
+		}
+	})
+}
+
+func TestDetectKVVersion(t *testing.T) {
+	mv := newMockVault(t)
+	mv.handle("GET", "/v1/sys/mounts", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"data": map[string]interface{}{
+			"secret/": map[string]interface{}{"type": "kv", "options": map[string]interface{}{"version": "2"}},
+			"kv/":     map[string]interface{}{"type": "kv", "options": map[string]interface{}{"version": "1"}},
+			"old/":    map[string]interface{}{"type": "generic", "options": nil},
+			"pki/":    map[string]interface{}{"type": "pki"},
+		}})
+	})
+
+	tests := []struct {
+		mount    string
+		expected int
+		wantErr  bool
+	}{
+		{"secret", 2, false},
+		{"kv/", 1, false},
+		{"old", 1, false},
+		{"pki", 0, true},
+		{"missing", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mount, func(t *testing.T) {
+			version, err := mv.client(t, tt.mount).DetectKVVersion()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if version != tt.expected {
+				t.Errorf("version = %d, expected %d", version, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPatchMetadata(t *testing.T) {
+	mv := newMockVault(t)
+	client := mv.client(t, "secret")
+	var body map[string]interface{}
+	var contentType string
+	mv.handle("PATCH", "/v1/secret/metadata/myapp/db", func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	if err := client.PatchMetadata("myapp/db", map[string]string{"team": "platform"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{"custom_metadata": map[string]interface{}{"team": "platform"}}
+	if !reflect.DeepEqual(body, expected) {
+		t.Errorf("body = %v, expected %v", body, expected)
+	}
+	if contentType != "application/merge-patch+json" {
+		t.Errorf("Content-Type = %q, expected application/merge-patch+json", contentType)
+	}
+
+	t.Run("kv v1", func(t *testing.T) {
+		client, err := NewVaultClient(vaultConn{Addr: mv.URL}, "test-token", "kv", 1)
+		if err != nil {
+			t.Fatalf("NewVaultClient: %v", err)
+		}
+		if err := client.PatchMetadata("myapp/db", map[string]string{"team": "platform"}); err == nil {
+			t.Error("expected error on KV v1")
+		}
+	})
+}
+
+func TestAuthenticateJWT(t *testing.T) {
+	mv := newMockVault(t)
+	var gotBody map[string]interface{}
+	mv.handle("PUT", "/v1/auth/gitlab/login", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		writeJSON(w, map[string]interface{}{"auth": map[string]interface{}{"client_token": "s.jwt-token"}})
+	})
+
+	client, err := newAPIClient(vaultConn{Addr: mv.URL})
+	if err != nil {
+		t.Fatalf("newAPIClient: %v", err)
+	}
+	token, err := authenticateJWT(client, "gitlab", "ci", "eyJhbGciOi.payload.sig")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token != "s.jwt-token" {
+		t.Errorf("token = %q, expected s.jwt-token", token)
+	}
+	expected := map[string]interface{}{"role": "ci", "jwt": "eyJhbGciOi.payload.sig"}
+	if !reflect.DeepEqual(gotBody, expected) {
+		t.Errorf("login body = %v, expected %v", gotBody, expected)
+	}
+
+	t.Run("login rejected", func(t *testing.T) {
+		mv.handle("PUT", "/v1/auth/gitlab/login", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]interface{}{"errors": []string{"role not found"}})
+		})
+		if _, err := authenticateJWT(client, "gitlab", "ci", "eyJ"); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestAuthenticateAppRole(t *testing.T) {
+	mv := newMockVault(t)
+	var gotBody map[string]interface{}
+	mv.handle("PUT", "/v1/auth/approle/login", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		writeJSON(w, map[string]interface{}{"auth": map[string]interface{}{"client_token": "s.approle-token"}})
+	})
+
+	client, err := newAPIClient(vaultConn{Addr: mv.URL})
+	if err != nil {
+		t.Fatalf("newAPIClient: %v", err)
+	}
+	token, err := authenticateAppRole(client, "role-123", "secret-456")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token != "s.approle-token" {
+		t.Errorf("token = %q, expected s.approle-token", token)
+	}
+	expected := map[string]interface{}{"role_id": "role-123", "secret_id": "secret-456"}
+	if !reflect.DeepEqual(gotBody, expected) {
+		t.Errorf("login body = %v, expected %v", gotBody, expected)
+	}
+
+	t.Run("invalid secret id", func(t *testing.T) {
+		mv.handle("PUT", "/v1/auth/approle/login", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]interface{}{"errors": []string{"invalid secret id"}})
+		})
+		if _, err := authenticateAppRole(client, "role-123", "wrong"); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestAuthenticateKubernetes(t *testing.T) {
+	mv := newMockVault(t)
+	var gotBody map[string]interface{}
+	mv.handle("PUT", "/v1/auth/kubernetes/login", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		writeJSON(w, map[string]interface{}{"auth": map[string]interface{}{"client_token": "s.k8s-token"}})
+	})
+
+	jwtPath := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(jwtPath, []byte("eyJrOHMi.payload.sig\n"), 0600)
+
+	token, err := loginKubernetes(vaultConn{Addr: mv.URL}, "deployer", jwtPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token != "s.k8s-token" {
+		t.Errorf("token = %q, expected s.k8s-token", token)
+	}
+	expected := map[string]interface{}{"role": "deployer", "jwt": "eyJrOHMi.payload.sig"}
+	if !reflect.DeepEqual(gotBody, expected) {
+		t.Errorf("login body = %v, expected %v", gotBody, expected)
+	}
+
+	t.Run("missing token file", func(t *testing.T) {
+		if _, err := loginKubernetes(vaultConn{Addr: mv.URL}, "deployer", "/nonexistent/token"); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestAuthenticateLDAP(t *testing.T) {
+	mv := newMockVault(t)
+	var gotBody map[string]interface{}
+	mv.handle("PUT", "/v1/auth/ldap/login/jdoe", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		writeJSON(w, map[string]interface{}{"auth": map[string]interface{}{"client_token": "s.ldap-token"}})
+	})
+	client := mv.client(t, "secret").client
+	noPasscode := func() (string, error) {
+		t.Error("passcode requested without MFA")
+		return "", nil
+	}
+
+	token, err := authenticateLDAP(client, "jdoe", "pw", noPasscode)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token != "s.ldap-token" {
+		t.Errorf("token = %q, expected s.ldap-token", token)
+	}
+	if expected := map[string]interface{}{"password": "pw"}; !reflect.DeepEqual(gotBody, expected) {
+		t.Errorf("login body = %v, expected %v", gotBody, expected)
+	}
+
+	t.Run("mfa", func(t *testing.T) {
+		mv.handle("PUT", "/v1/auth/ldap/login/jdoe", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{"auth": map[string]interface{}{
+				"client_token": "",
+				"mfa_requirement": map[string]interface{}{
+					"mfa_request_id": "req-1",
+					"mfa_constraints": map[string]interface{}{
+						"totp": map[string]interface{}{"any": []map[string]interface{}{{"type": "totp", "id": "totp-id", "uses_passcode": true}}},
+						"duo":  map[string]interface{}{"any": []map[string]interface{}{{"type": "duo", "id": "duo-id"}}},
+					},
+				},
+			}})
+		})
+		var gotValidate map[string]interface{}
+		mv.handle("POST", "/v1/sys/mfa/validate", func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&gotValidate)
+			writeJSON(w, map[string]interface{}{"auth": map[string]interface{}{"client_token": "s.mfa-token"}})
+		})
+
+		prompts := 0
+		token, err := authenticateLDAP(client, "jdoe", "pw", func() (string, error) {
+			prompts++
+			return "123456", nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if token != "s.mfa-token" || prompts != 1 {
+			t.Errorf("got token %q after %d prompts, expected s.mfa-token after 1", token, prompts)
+		}
+		expected := map[string]interface{}{
+			"mfa_request_id": "req-1",
+			"mfa_payload":    map[string]interface{}{"totp-id": []interface{}{"123456"}, "duo-id": []interface{}{}},
+		}
+		if !reflect.DeepEqual(gotValidate, expected) {
+			t.Errorf("validate body = %v, expected %v", gotValidate, expected)
+		}
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		mv.handle("PUT", "/v1/auth/ldap/login/jdoe", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]interface{}{"errors": []string{"ldap operation failed"}})
+		})
+		if _, err := authenticateLDAP(client, "jdoe", "wrong", noPasscode); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestResolveJWT(t *testing.T) {
+	if jwt, err := resolveJWT("eyJhbGciOi.payload.sig"); err != nil || jwt != "eyJhbGciOi.payload.sig" {
+		t.Errorf("literal JWT: got (%q, %v)", jwt, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(path, []byte("eyJfromfile\n"), 0600)
+	if jwt, err := resolveJWT(path); err != nil || jwt != "eyJfromfile" {
+		t.Errorf("JWT file: got (%q, %v)", jwt, err)
+	}
+
+	if _, err := resolveJWT("/nonexistent/token"); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
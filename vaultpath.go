@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// vaultPathFile names the file --vault-path-from-file reads a SOPS file's
+// vault path from.
+const vaultPathFile = ".vaultpath"
+
+// findVaultPath looks for a .vaultpath file in sopsFile's directory, then in
+// each parent directory in turn, and returns the vault path in the nearest
+// one found along with that file's path. The file holds the path on a single
+// line; surrounding whitespace and slashes are ignored. If there is none, it
+// returns "" and no error.
+func findVaultPath(sopsFile string) (vaultPath, source string, err error) {
+	dir, err := filepath.Abs(filepath.Dir(sopsFile))
+	if err != nil {
+		return "", "", err
+	}
+	for {
+		source = filepath.Join(dir, vaultPathFile)
+		content, err := os.ReadFile(source)
+		switch {
+		case err == nil:
+			vaultPath = strings.Trim(strings.TrimSpace(string(content)), "/")
+			if vaultPath == "" || strings.ContainsAny(vaultPath, "\r\n") {
+				return "", "", fmt.Errorf("%s must contain a single vault path", source)
+			}
+			return vaultPath, source, nil
+		case !errors.Is(err, fs.ErrNotExist):
+			return "", "", fmt.Errorf("reading %s: %w", source, err)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", nil
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindVaultPath(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "apps", "web")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sopsFile := filepath.Join(nested, "secrets.yaml")
+
+	if path, _, err := findVaultPath(sopsFile); err != nil || path != "" {
+		t.Fatalf("with no .vaultpath: findVaultPath = %q, %v; expected no path", path, err)
+	}
+
+	// The nearest .vaultpath wins
+	rootFile := filepath.Join(root, vaultPathFile)
+	if err := os.WriteFile(rootFile, []byte("shared\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path, source, err := findVaultPath(sopsFile)
+	if err != nil || path != "shared" || source != rootFile {
+		t.Errorf("findVaultPath = %q, %q, %v; expected shared from %s", path, source, err, rootFile)
+	}
+	if err := os.WriteFile(filepath.Join(nested, vaultPathFile), []byte("  /myproject/web/ \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if path, _, err := findVaultPath(sopsFile); err != nil || path != "myproject/web" {
+		t.Errorf("findVaultPath = %q, %v; expected myproject/web", path, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(nested, vaultPathFile), []byte("a\nb\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := findVaultPath(sopsFile); err == nil || !strings.Contains(err.Error(), "single vault path") {
+		t.Errorf("expected an error for a multi-line .vaultpath, got %v", err)
+	}
+}
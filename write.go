@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Strategies for --vault-path-exists-strategy.
+const (
+	strategyOverwrite = "overwrite"
+	strategySkip      = "skip"
+	strategyMerge     = "merge"
+	strategyError     = "error"
+)
+
+// errInterrupted is returned when a write run is stopped by a signal.
+var errInterrupted = errors.New("interrupted")
+
+// writeOptions controls how writeSecrets handles each key.
+type writeOptions struct {
+	// Strategy is one of the strategy* constants.
+	Strategy string
+	// Rollback records each path's previous data before writing it, so the
+	// run can be undone with rollbackSecrets.
+	Rollback bool
+	// ForceRecreate destroys each path's existing versions before writing,
+	// so every secret starts again at version 1.
+	ForceRecreate bool
+	// Bundle means each value in the data passed to writeSecrets is a
+	// map[string]interface{} to store as the whole secret, rather than a
+	// single value to store under Field.
+	Bundle bool
+	// Field is the secret field each value is stored under ("value" if
+	// empty). It doesn't apply to bundles.
+	Field string
+	// Retry is applied to each key's write.
+	Retry retryPolicy
+	// Parallelism is the number of concurrent writers. Above 1, a failed
+	// write no longer stops the run; all failures are returned together.
+	Parallelism int
+	// CAS makes each overwrite check-and-set against the version read just
+	// before it. A key whose secret changed in between is skipped and listed
+	// in writeResult.Conflicts instead of failing the run.
+	CAS bool
+	// Tags, if set, are added to the custom metadata of each path written.
+	Tags map[string]string
+	// OnWrite, if set, is called with the outcome of each key's write. Keys
+	// skipped because their path already held data aren't reported. With
+	// Parallelism above 1 it is called from several goroutines at once.
+	OnWrite func(key string, err error)
+	// Progress, if set, is called once each key has been attempted, whether
+	// it was written, skipped, or failed.
+	Progress func()
+}
+
+// writeResult summarizes a writeSecrets run.
+type writeResult struct {
+	// Written lists the keys written, in write order.
+	Written []string
+	Skipped int
+	// Failed counts keys whose write failed (parallel writes only).
+	Failed int
+	// Conflicts lists the keys skipped after a check-and-set conflict.
+	Conflicts []string
+
+	// status records the outcome of each attempted key, see Status.
+	status map[string]string
+	// previous holds the pre-write data of each written path (nil if the
+	// path was empty), recorded only with writeOptions.Rollback.
+	previous map[string]map[string]interface{}
+}
+
+// writeSecrets writes each key to its own path, as returned by pathFor,
+// handling paths that already hold data according to opts.Strategy. It stops
+// at the first error, or with errInterrupted once ctx is cancelled; the key
+// being written when that happens is always finished first. With
+// opts.Parallelism above 1 the writes are spread over that many workers and
+// see writeSecretsParallel for how errors are reported.
+func writeSecrets(ctx context.Context, client VaultWriter, keys []string, data map[string]interface{}, pathFor func(key string) string, opts writeOptions) (writeResult, error) {
+	result := writeResult{
+		status:   make(map[string]string),
+		previous: make(map[string]map[string]interface{}),
+	}
+
+	// With the error strategy nothing is written unless every path is free
+	if opts.Strategy == strategyError {
+		for _, key := range keys {
+			secretPath := pathFor(key)
+			existing, _, err := client.readKV(secretPath)
+			if err != nil {
+				return result, err
+			}
+			if existing != nil {
+				return result, fmt.Errorf("vault path %s already exists", secretPath)
+			}
+		}
+	}
+
+	if opts.Parallelism > 1 {
+		return writeSecretsParallel(ctx, client, keys, data, pathFor, opts, result)
+	}
+
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			return result, errInterrupted
+		}
+
+		skipped, existing, err := writeKeyWithRetry(ctx, client, pathFor(key), data[key], opts)
+		opts.reportWrite(key, skipped, err)
+		if errors.Is(err, errCASConflict) {
+			result.conflict(key)
+			continue
+		}
+		if err != nil {
+			result.status[key] = statusFailed
+			return result, err
+		}
+		result.record(key, skipped, existing, opts)
+	}
+	return result, nil
+}
+
+// writeSecretsParallel is writeSecrets with opts.Parallelism workers. Every
+// key is attempted even if some fail, and the failures are joined into the
+// returned error. Once ctx is cancelled no new writes start, and the error
+// also wraps errInterrupted.
+func writeSecretsParallel(ctx context.Context, client VaultWriter, keys []string, data map[string]interface{}, pathFor func(key string) string, opts writeOptions, result writeResult) (writeResult, error) {
+	jobs := make(chan string)
+	errCh := make(chan error, len(keys))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < opts.Parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range jobs {
+				skipped, existing, err := writeKeyWithRetry(ctx, client, pathFor(key), data[key], opts)
+				opts.reportWrite(key, skipped, err)
+				if errors.Is(err, errCASConflict) {
+					mu.Lock()
+					result.conflict(key)
+					mu.Unlock()
+					continue
+				}
+				if err != nil {
+					mu.Lock()
+					result.status[key] = statusFailed
+					mu.Unlock()
+					errCh <- err
+					continue
+				}
+				mu.Lock()
+				result.record(key, skipped, existing, opts)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	interrupted := false
+feed:
+	for _, key := range keys {
+		select {
+		case jobs <- key:
+		case <-ctx.Done():
+			interrupted = true
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(errCh)
+
+	var errs []error
+	for err := range errCh {
+		errs = append(errs, err)
+	}
+	result.Failed = len(errs)
+	if interrupted {
+		errs = append(errs, errInterrupted)
+	}
+	return result, errors.Join(errs...)
+}
+
+// field returns the secret field each value is stored under.
+func (o writeOptions) field() string {
+	if o.Field == "" {
+		return defaultValueField
+	}
+	return o.Field
+}
+
+// reportWrite passes the outcome of writing key to OnWrite, unless the key
+// was skipped, and counts it towards Progress.
+func (o writeOptions) reportWrite(key string, skipped bool, err error) {
+	if o.OnWrite != nil && !skipped {
+		o.OnWrite(key, err)
+	}
+	if o.Progress != nil {
+		o.Progress()
+	}
+}
+
+// writeKeyWithRetry is writeKey retried on transient errors per opts.Retry,
+// traced as one span of ctx's.
+func writeKeyWithRetry(ctx context.Context, client VaultWriter, secretPath string, value interface{}, opts writeOptions) (bool, map[string]interface{}, error) {
+	ctx, span := tracer.Start(ctx, "vault.write", trace.WithAttributes(attribute.String(attrVaultPath, secretPath)))
+	var skipped bool
+	var existing map[string]interface{}
+	err := withRetry(ctx, opts.Retry, func() error {
+		var err error
+		skipped, existing, err = writeKey(client, secretPath, value, opts)
+		return err
+	})
+	endSpan(span, err)
+	return skipped, existing, err
+}
+
+// writeKey writes a single value to secretPath according to opts. It reports
+// whether the path was skipped because it already held data, and the data
+// it held beforehand when that was read (for skip and rollback).
+func writeKey(client VaultWriter, secretPath string, value interface{}, opts writeOptions) (bool, map[string]interface{}, error) {
+	secret := map[string]interface{}{opts.field(): value}
+	if opts.Bundle {
+		secret = value.(map[string]interface{})
+	}
+
+	var existing map[string]interface{}
+	if opts.Rollback || opts.Strategy == strategySkip {
+		var err error
+		existing, _, err = client.readKV(secretPath)
+		if err != nil {
+			return false, nil, err
+		}
+	}
+
+	var err error
+	switch opts.Strategy {
+	case strategySkip:
+		if existing != nil {
+			return true, existing, nil
+		}
+		err = client.WriteKVData(secretPath, secret)
+	case strategyMerge:
+		err = client.MergeKV(secretPath, stringValues(secret))
+	default:
+		if opts.ForceRecreate {
+			err = client.DeleteKVAllVersions(secretPath)
+		}
+		if err == nil && opts.CAS {
+			err = writeKeyCAS(client, secretPath, secret)
+		} else if err == nil {
+			err = client.WriteKVData(secretPath, secret)
+		}
+	}
+	if err == nil && len(opts.Tags) > 0 {
+		err = client.PatchMetadata(secretPath, opts.Tags)
+	}
+	return false, existing, err
+}
+
+// writeKeyCAS writes secret to secretPath with check-and-set against the
+// secret's current version.
+func writeKeyCAS(client VaultWriter, secretPath string, secret map[string]interface{}) error {
+	metadata, err := client.ReadKVMetadata(secretPath)
+	if err != nil {
+		return err
+	}
+	version := 0
+	if metadata != nil {
+		version = metadata.CurrentVersion
+	}
+	return client.WriteKVDataCAS(secretPath, secret, version)
+}
+
+// Status returns what happened to key: written, skipped, failed, or
+// not_written if the run stopped before reaching it.
+func (r writeResult) Status(key string) string {
+	if status, ok := r.status[key]; ok {
+		return status
+	}
+	return statusNotWritten
+}
+
+// record adds the outcome of writing key to the result.
+func (r *writeResult) record(key string, skipped bool, existing map[string]interface{}, opts writeOptions) {
+	if skipped {
+		r.Skipped++
+		r.status[key] = statusSkipped
+		return
+	}
+	r.Written = append(r.Written, key)
+	r.status[key] = statusWritten
+	if opts.Rollback {
+		r.previous[key] = existing
+	}
+}
+
+// conflict records that key was skipped after a check-and-set conflict.
+func (r *writeResult) conflict(key string) {
+	r.Conflicts = append(r.Conflicts, key)
+	r.status[key] = statusConflict
+}
+
+// deleteSecrets permanently deletes each path, destroying all versions. It
+// stops at the first error, or with errInterrupted once ctx is cancelled,
+// and returns the number of paths deleted.
+func deleteSecrets(ctx context.Context, client VaultWriter, paths []string, retry retryPolicy) (int, error) {
+	deleted := 0
+	for _, p := range paths {
+		if ctx.Err() != nil {
+			return deleted, errInterrupted
+		}
+		if err := withRetry(ctx, retry, func() error { return client.DeleteKVAllVersions(p) }); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// verifySecrets reads back every path written in result and compares it to
+// what was written from data, returning a description of each mismatch.
+// Fields that were already in a merged or bundled secret aren't checked.
+func verifySecrets(client VaultWriter, result writeResult, data map[string]interface{}, pathFor func(key string) string, opts writeOptions) ([]string, error) {
+	var mismatches []string
+	for _, key := range result.Written {
+		secretPath := pathFor(key)
+		if !opts.Bundle {
+			got, err := client.ReadKVField(secretPath, opts.field())
+			if err != nil {
+				return mismatches, err
+			}
+			if want := formatValue(data[key]); got != want {
+				mismatches = append(mismatches, fmt.Sprintf("%s: stored value differs from the value written", secretPath))
+			}
+			continue
+		}
+
+		stored, _, err := client.readKV(secretPath)
+		if err != nil {
+			return mismatches, err
+		}
+		expected := stringValues(data[key].(map[string]interface{}))
+		fields := make([]string, 0, len(expected))
+		for field := range expected {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			if stored[field] != expected[field] {
+				mismatches = append(mismatches, fmt.Sprintf("%s#%s: stored value differs from the value written", secretPath, field))
+			}
+		}
+	}
+	return mismatches, nil
+}
+
+// rollbackSecrets restores every path written in result to its previous
+// data, deleting paths that didn't exist before. It is best-effort: all paths
+// are attempted and the failures are returned together.
+func rollbackSecrets(client VaultWriter, result writeResult, pathFor func(key string) string) []error {
+	var errs []error
+	for i := len(result.Written) - 1; i >= 0; i-- {
+		key := result.Written[i]
+		if err := client.restoreKV(pathFor(key), result.previous[key]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// stagingSegment is the path segment --atomic stages each secret under, next
+// to where it will be written.
+const stagingSegment = ".sops-to-vault-staging"
+
+// stagingPath returns where --atomic stages the secret for secretPath: in a
+// stagingSegment sub-path of the same parent, so policies granting write to
+// the real path's siblings usually cover it too.
+func stagingPath(secretPath string) string {
+	return path.Join(path.Dir(secretPath), stagingSegment, path.Base(secretPath))
+}
+
+// stageSecrets trial-writes every key to its stagingPath, to find out before
+// touching the real paths whether the writes would succeed. It stops at the
+// first failure. The staged paths are deleted again either way; failing to
+// delete one is reported in cleanupErrs rather than as a staging failure.
+func stageSecrets(ctx context.Context, client VaultWriter, keys []string, data map[string]interface{}, pathFor func(key string) string, opts writeOptions) (cleanupErrs []error, err error) {
+	stageOpts := writeOptions{Strategy: strategyOverwrite, Bundle: opts.Bundle, Field: opts.Field, Retry: opts.Retry, Tags: opts.Tags}
+	var staged []string
+	defer func() {
+		for _, p := range staged {
+			if derr := client.DeleteKVAllVersions(p); derr != nil {
+				cleanupErrs = append(cleanupErrs, derr)
+			}
+		}
+	}()
+
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			return nil, errInterrupted
+		}
+		p := stagingPath(pathFor(key))
+		if _, _, err := writeKeyWithRetry(ctx, client, p, data[key], stageOpts); err != nil {
+			return nil, fmt.Errorf("staging %s: %w", pathFor(key), err)
+		}
+		staged = append(staged, p)
+	}
+	return nil, nil
+}
+
+// confirm prints prompt to w and reports whether the answer read from r is yes.
+func confirm(r io.Reader, w io.Writer, prompt string) bool {
+	fmt.Fprintf(w, "%s [y/N]: ", prompt)
+	answer, _ := bufio.NewReader(r).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// interruptContext returns a context that is cancelled when a signal arrives
+// on sigCh. release is called once that first signal arrives, so a second one
+// can get the default handling. The returned stop function releases the
+// watcher.
+func interruptContext(parent context.Context, sigCh <-chan os.Signal, release func()) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case sig := <-sigCh:
+			release()
+			fmt.Fprintf(os.Stderr, "\nReceived %s, stopping after the current write (press Ctrl-C again to force exit)...\n", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// notifyInterrupt returns a context cancelled on SIGINT or SIGTERM. After the
+// first signal the default handling is restored, so a second one terminates
+// the process even during a slow rollback or retry backoff.
+func notifyInterrupt() (context.Context, context.CancelFunc) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	ctx, cancel := interruptContext(context.Background(), sigCh, func() { signal.Stop(sigCh) })
+	return ctx, func() {
+		signal.Stop(sigCh)
+		cancel()
+	}
+}
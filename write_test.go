@@ -0,0 +1,542 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// FakeVaultWriter is an in-memory VaultWriter that records each call as
+// "<method> <path>". Writing to a path in Fail fails with that error.
+type FakeVaultWriter struct {
+	Secrets map[string]map[string]interface{}
+	Tags    map[string]map[string]string
+	Fail    map[string]error
+	Calls   []string
+
+	versions map[string]int
+}
+
+func newFakeVaultWriter() *FakeVaultWriter {
+	return &FakeVaultWriter{
+		Secrets:  make(map[string]map[string]interface{}),
+		Tags:     make(map[string]map[string]string),
+		Fail:     make(map[string]error),
+		versions: make(map[string]int),
+	}
+}
+
+func (f *FakeVaultWriter) record(method, path string) {
+	f.Calls = append(f.Calls, method+" "+path)
+}
+
+func (f *FakeVaultWriter) WriteKVData(path string, data map[string]interface{}) error {
+	f.record("write", path)
+	if err := f.Fail[path]; err != nil {
+		return err
+	}
+	f.Secrets[path] = data
+	f.versions[path]++
+	return nil
+}
+
+func (f *FakeVaultWriter) WriteKVDataCAS(path string, data map[string]interface{}, version int) error {
+	f.record("write-cas", path)
+	if version != f.versions[path] {
+		return fmt.Errorf("check-and-set parameter did not match the current version")
+	}
+	f.Secrets[path] = data
+	f.versions[path]++
+	return nil
+}
+
+func (f *FakeVaultWriter) MergeKV(path string, newData map[string]interface{}) error {
+	f.record("merge", path)
+	merged := make(map[string]interface{})
+	for k, v := range f.Secrets[path] {
+		merged[k] = v
+	}
+	for k, v := range newData {
+		merged[k] = v
+	}
+	f.Secrets[path] = merged
+	f.versions[path]++
+	return nil
+}
+
+func (f *FakeVaultWriter) DeleteKVAllVersions(path string) error {
+	f.record("delete", path)
+	delete(f.Secrets, path)
+	delete(f.versions, path)
+	return nil
+}
+
+func (f *FakeVaultWriter) PatchMetadata(path string, tags map[string]string) error {
+	f.record("tag", path)
+	f.Tags[path] = tags
+	return nil
+}
+
+func (f *FakeVaultWriter) ReadKVField(path, field string) (string, error) {
+	f.record("read", path)
+	return formatValue(f.Secrets[path][field]), nil
+}
+
+func (f *FakeVaultWriter) ReadKVMetadata(path string) (*KVMetadata, error) {
+	f.record("read-metadata", path)
+	if _, ok := f.Secrets[path]; !ok {
+		return nil, nil
+	}
+	return &KVMetadata{CurrentVersion: f.versions[path]}, nil
+}
+
+func (f *FakeVaultWriter) readKV(path string) (map[string]interface{}, int, error) {
+	f.record("read", path)
+	return f.Secrets[path], f.versions[path], nil
+}
+
+func (f *FakeVaultWriter) restoreKV(path string, data map[string]interface{}) error {
+	f.record("restore", path)
+	if data == nil {
+		delete(f.Secrets, path)
+		return nil
+	}
+	f.Secrets[path] = data
+	return nil
+}
+
+func TestWriteSecretsFakeWriter(t *testing.T) {
+	fake := newFakeVaultWriter()
+	fake.Secrets["app/existing"] = map[string]interface{}{"value": "old"}
+	fake.Fail["app/broken"] = errors.New("permission denied")
+
+	keys := []string{"existing", "new", "broken"}
+	data := map[string]interface{}{"existing": "updated", "new": "created", "broken": "x"}
+	opts := writeOptions{Strategy: strategyOverwrite, Rollback: true, Tags: map[string]string{"team": "platform"}}
+	result, err := writeSecrets(context.Background(), fake, keys, data, underPath("app"), opts)
+	if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("expected write error, got %v", err)
+	}
+	if !reflect.DeepEqual(result.Written, []string{"existing", "new"}) {
+		t.Errorf("written = %v, expected [existing new]", result.Written)
+	}
+	if !reflect.DeepEqual(fake.Tags["app/new"], opts.Tags) {
+		t.Errorf("tags on app/new = %v, expected %v", fake.Tags["app/new"], opts.Tags)
+	}
+
+	fake.Calls = nil
+	if errs := rollbackSecrets(fake, result, underPath("app")); len(errs) != 0 {
+		t.Fatalf("unexpected rollback errors: %v", errs)
+	}
+	if expected := []string{"restore app/new", "restore app/existing"}; !reflect.DeepEqual(fake.Calls, expected) {
+		t.Errorf("calls = %v, expected %v", fake.Calls, expected)
+	}
+	expected := map[string]map[string]interface{}{"app/existing": {"value": "old"}}
+	if !reflect.DeepEqual(fake.Secrets, expected) {
+		t.Errorf("secrets = %v, expected %v", fake.Secrets, expected)
+	}
+}
+
+func TestWriteSecretsStrategies(t *testing.T) {
+	data := map[string]interface{}{"db.password": "new-pass", "db.url": "postgres://new"}
+	keys := []string{"db.password", "db.url"}
+
+	setup := func(t *testing.T) (*mockVault, *VaultClient) {
+		mv := newMockVault(t)
+		mv.seed("secret/data/app/db.password", map[string]interface{}{"value": "old-pass", "rotated": "2024-01-01"})
+		return mv, mv.client(t, "secret")
+	}
+
+	t.Run("overwrite", func(t *testing.T) {
+		mv, client := setup(t)
+		result, err := writeSecrets(context.Background(), client, keys, data, underPath("app"), writeOptions{Strategy: strategyOverwrite})
+		if err != nil || len(result.Written) != 2 || result.Skipped != 0 {
+			t.Fatalf("got (%v, %d, %v), expected 2 written, 0 skipped", result.Written, result.Skipped, err)
+		}
+		expected := map[string]interface{}{"value": "new-pass"}
+		if got := mv.stored("secret/data/app/db.password"); !reflect.DeepEqual(got, expected) {
+			t.Errorf("stored = %v, expected %v", got, expected)
+		}
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		mv, client := setup(t)
+		result, err := writeSecrets(context.Background(), client, keys, data, underPath("app"), writeOptions{Strategy: strategySkip})
+		if err != nil || len(result.Written) != 1 || result.Skipped != 1 {
+			t.Fatalf("got (%v, %d, %v), expected 1 written, 1 skipped", result.Written, result.Skipped, err)
+		}
+		if got := mv.stored("secret/data/app/db.password")["value"]; got != "old-pass" {
+			t.Errorf("existing value changed to %v", got)
+		}
+		if got := mv.stored("secret/data/app/db.url")["value"]; got != "postgres://new" {
+			t.Errorf("new value = %v, expected postgres://new", got)
+		}
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		mv, client := setup(t)
+		result, err := writeSecrets(context.Background(), client, keys, data, underPath("app"), writeOptions{Strategy: strategyMerge})
+		if err != nil || len(result.Written) != 2 {
+			t.Fatalf("got (%v, %v), expected 2 written", result.Written, err)
+		}
+		expected := map[string]interface{}{"value": "new-pass", "rotated": "2024-01-01"}
+		if got := mv.stored("secret/data/app/db.password"); !reflect.DeepEqual(got, expected) {
+			t.Errorf("stored = %v, expected %v", got, expected)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		mv, client := setup(t)
+		result, err := writeSecrets(context.Background(), client, keys, data, underPath("app"), writeOptions{Strategy: strategyError})
+		if err == nil {
+			t.Fatal("expected error for existing path")
+		}
+		if len(result.Written) != 0 || mv.stored("secret/data/app/db.url") != nil {
+			t.Error("expected nothing to be written")
+		}
+	})
+}
+
+// underPath returns a pathFor function placing keys directly under base.
+func underPath(base string) func(string) string {
+	return func(key string) string { return base + "/" + key }
+}
+
+func TestWriteSecretsInterrupted(t *testing.T) {
+	mv := newMockVault(t)
+	client := mv.client(t, "secret")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Cancel while the first write is in flight; it should still complete
+	mv.handle("PUT", "/v1/secret/data/app/a", func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	data := map[string]interface{}{"a": "1", "b": "2", "c": "3"}
+	result, err := writeSecrets(ctx, client, []string{"a", "b", "c"}, data, underPath("app"), writeOptions{Strategy: strategyOverwrite})
+	if !errors.Is(err, errInterrupted) {
+		t.Fatalf("expected errInterrupted, got %v", err)
+	}
+	if !reflect.DeepEqual(result.Written, []string{"a"}) {
+		t.Errorf("written = %v, expected [a]", result.Written)
+	}
+	if calls := mv.Calls(); len(calls) != 1 {
+		t.Errorf("expected a single write, got %v", calls)
+	}
+}
+
+func TestRollbackSecrets(t *testing.T) {
+	mv := newMockVault(t)
+	client := mv.client(t, "secret")
+	mv.seed("secret/data/app/existing", map[string]interface{}{"value": "old"})
+	mv.handle("PUT", "/v1/secret/data/app/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		writeJSON(w, map[string]interface{}{"errors": []string{"permission denied"}})
+	})
+
+	keys := []string{"existing", "new", "broken"}
+	data := map[string]interface{}{"existing": "updated", "new": "created", "broken": "x"}
+	result, err := writeSecrets(context.Background(), client, keys, data, underPath("app"), writeOptions{Strategy: strategyOverwrite, Rollback: true})
+	if err == nil {
+		t.Fatal("expected write error")
+	}
+
+	if errs := rollbackSecrets(client, result, underPath("app")); len(errs) != 0 {
+		t.Fatalf("unexpected rollback errors: %v", errs)
+	}
+	if got := mv.stored("secret/data/app/existing")["value"]; got != "old" {
+		t.Errorf("existing value = %v, expected old", got)
+	}
+	if got := mv.stored("secret/data/app/new"); got != nil {
+		t.Errorf("new path should be deleted, found %v", got)
+	}
+}
+
+func TestWriteSecretsForceRecreate(t *testing.T) {
+	mv := newMockVault(t)
+	client := mv.client(t, "secret")
+	mv.seed("secret/data/app/db.password", map[string]interface{}{"value": "v1"})
+	mv.seed("secret/data/app/db.password", map[string]interface{}{"value": "v2"})
+
+	data := map[string]interface{}{"db.password": "v3"}
+	_, err := writeSecrets(context.Background(), client, []string{"db.password"}, data, underPath("app"), writeOptions{Strategy: strategyOverwrite, ForceRecreate: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"DELETE /v1/secret/metadata/app/db.password",
+		"PUT /v1/secret/data/app/db.password",
+	}
+	if calls := mv.Calls(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("calls = %v, expected %v", calls, expected)
+	}
+	if v := mv.versions["secret/data/app/db.password"]; v != 1 {
+		t.Errorf("version = %d, expected 1", v)
+	}
+}
+
+func TestWriteSecretsCAS(t *testing.T) {
+	mv := newMockVault(t)
+	client := mv.client(t, "secret")
+	mv.seed("secret/data/app/current", map[string]interface{}{"value": "v1"})
+	// stale was updated again after its metadata was read
+	mv.seed("secret/data/app/stale", map[string]interface{}{"value": "v1"})
+	mv.seed("secret/data/app/stale", map[string]interface{}{"value": "v2"})
+	for _, key := range []string{"current", "stale"} {
+		mv.handle("GET", "/v1/secret/metadata/app/"+key, func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{"data": map[string]interface{}{"current_version": 1}})
+		})
+	}
+
+	data := map[string]interface{}{"current": "new", "stale": "new", "missing": "new"}
+	keys := []string{"current", "missing", "stale"}
+	result, err := writeSecrets(context.Background(), client, keys, data, underPath("app"), writeOptions{Strategy: strategyOverwrite, CAS: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(result.Written, []string{"current", "missing"}) {
+		t.Errorf("written = %v, expected [current missing]", result.Written)
+	}
+	if !reflect.DeepEqual(result.Conflicts, []string{"stale"}) {
+		t.Errorf("conflicts = %v, expected [stale]", result.Conflicts)
+	}
+	if s := result.Status("stale"); s != statusConflict {
+		t.Errorf("status = %s, expected %s", s, statusConflict)
+	}
+	if got := mv.stored("secret/data/app/stale")["value"]; got != "v2" {
+		t.Errorf("stale value = %v, expected v2 to be kept", got)
+	}
+	if got := mv.stored("secret/data/app/missing")["value"]; got != "new" {
+		t.Errorf("missing value = %v, expected new", got)
+	}
+}
+
+func TestWriteSecretsParallel(t *testing.T) {
+	data := make(map[string]interface{})
+	var keys []string
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		keys = append(keys, key)
+		data[key] = i
+	}
+
+	t.Run("writes every key", func(t *testing.T) {
+		mv := newMockVault(t)
+		result, err := writeSecrets(context.Background(), mv.client(t, "secret"), keys, data, underPath("app"), writeOptions{Parallelism: 4})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(result.Written) != len(keys) || result.Failed != 0 {
+			t.Fatalf("written = %d, failed = %d, expected %d written", len(result.Written), result.Failed, len(keys))
+		}
+		for _, key := range keys {
+			if mv.stored("secret/data/app/"+key) == nil {
+				t.Errorf("%s not written", key)
+			}
+		}
+	})
+
+	t.Run("collects all failures", func(t *testing.T) {
+		mv := newMockVault(t)
+		deny := func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			writeJSON(w, map[string]interface{}{"errors": []string{"permission denied"}})
+		}
+		mv.handle("PUT", "/v1/secret/data/app/key03", deny)
+		mv.handle("PUT", "/v1/secret/data/app/key11", deny)
+
+		result, err := writeSecrets(context.Background(), mv.client(t, "secret"), keys, data, underPath("app"), writeOptions{Parallelism: 4})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if !strings.Contains(err.Error(), "app/key03") || !strings.Contains(err.Error(), "app/key11") {
+			t.Errorf("error should mention both failed paths: %v", err)
+		}
+		if result.Failed != 2 || len(result.Written) != len(keys)-2 {
+			t.Errorf("written = %d, failed = %d, expected %d and 2", len(result.Written), result.Failed, len(keys)-2)
+		}
+	})
+
+	t.Run("interrupted", func(t *testing.T) {
+		mv := newMockVault(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		result, err := writeSecrets(ctx, mv.client(t, "secret"), keys, data, underPath("app"), writeOptions{Parallelism: 4})
+		if !errors.Is(err, errInterrupted) {
+			t.Fatalf("expected errInterrupted, got %v", err)
+		}
+		if len(result.Written) == len(keys) {
+			t.Error("expected remaining keys to be left unwritten")
+		}
+	})
+}
+
+func BenchmarkWriteSecrets(b *testing.B) {
+	data := make(map[string]interface{})
+	var keys []string
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		keys = append(keys, key)
+		data[key] = i
+	}
+
+	for _, parallelism := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("parallelism=%d", parallelism), func(b *testing.B) {
+			mv := newMockVault(b)
+			mv.delay = time.Millisecond
+			client := mv.client(b, "secret")
+			opts := writeOptions{Parallelism: parallelism}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := writeSecrets(context.Background(), client, keys, data, underPath("app"), opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteSecretsBundle(t *testing.T) {
+	mv := newMockVault(t)
+	mv.seed("secret/data/app", map[string]interface{}{"legacy": "keep", "db.password": "old"})
+	data := map[string]interface{}{
+		"app": map[string]interface{}{"db.password": "new", "db.port": 5432},
+	}
+
+	result, err := writeSecrets(context.Background(), mv.client(t, "secret"), []string{"app"}, data, func(p string) string { return p }, writeOptions{Strategy: strategyMerge, Bundle: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(result.Written, []string{"app"}) {
+		t.Errorf("written = %v, expected [app]", result.Written)
+	}
+	if calls := mv.Calls(); calls[len(calls)-1] != "PUT /v1/secret/data/app" {
+		t.Errorf("expected a single write to the bundle path, got %v", calls)
+	}
+	expected := map[string]interface{}{"legacy": "keep", "db.password": "new", "db.port": "5432"}
+	if got := mv.stored("secret/data/app"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("stored = %v, expected %v", got, expected)
+	}
+}
+
+func TestVerifySecrets(t *testing.T) {
+	mv := newMockVault(t)
+	client := mv.client(t, "secret")
+	data := map[string]interface{}{"db.password": "p", "db.port": 5432}
+	keys := []string{"db.password", "db.port"}
+
+	result, err := writeSecrets(context.Background(), client, keys, data, underPath("app"), writeOptions{})
+	if err != nil {
+		t.Fatalf("writeSecrets: %v", err)
+	}
+
+	mismatches, err := verifySecrets(client, result, data, underPath("app"), writeOptions{})
+	if err != nil || len(mismatches) != 0 {
+		t.Fatalf("got (%v, %v), expected no mismatches", mismatches, err)
+	}
+
+	// Simulate the stored value being altered after the write
+	mv.seed("secret/data/app/db.port", map[string]interface{}{"value": "5433"})
+	mismatches, err = verifySecrets(client, result, data, underPath("app"), writeOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mismatches) != 1 || !strings.Contains(mismatches[0], "app/db.port") {
+		t.Errorf("mismatches = %v, expected one for app/db.port", mismatches)
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"y\n", true},
+		{"YES\n", true},
+		{"n\n", false},
+		{"\n", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		if got := confirm(strings.NewReader(tt.input), &out, "Continue?"); got != tt.expected {
+			t.Errorf("confirm(%q) = %v, expected %v", tt.input, got, tt.expected)
+		}
+		if out.String() != "Continue? [y/N]: " {
+			t.Errorf("unexpected prompt %q", out.String())
+		}
+	}
+}
+
+func TestInterruptContext(t *testing.T) {
+	sigCh := make(chan os.Signal, 1)
+	released := make(chan struct{})
+	ctx, cancel := interruptContext(context.Background(), sigCh, func() { close(released) })
+	defer cancel()
+
+	sigCh <- syscall.SIGINT
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context not cancelled after SIGINT")
+	}
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("signal handling not released after the first SIGINT")
+	}
+}
+
+func TestStageSecrets(t *testing.T) {
+	fake := newFakeVaultWriter()
+	fake.Secrets["app/db.password"] = map[string]interface{}{"value": "old"}
+
+	keys := []string{"db.password", "token"}
+	data := map[string]interface{}{"db.password": "new", "token": "t"}
+	opts := writeOptions{Strategy: strategySkip, Rollback: true}
+	cleanupErrs, err := stageSecrets(context.Background(), fake, keys, data, underPath("app"), opts)
+	if err != nil || len(cleanupErrs) > 0 {
+		t.Fatalf("unexpected errors: %v, %v", err, cleanupErrs)
+	}
+	expectedCalls := []string{
+		"write app/.sops-to-vault-staging/db.password",
+		"write app/.sops-to-vault-staging/token",
+		"delete app/.sops-to-vault-staging/db.password",
+		"delete app/.sops-to-vault-staging/token",
+	}
+	if !reflect.DeepEqual(fake.Calls, expectedCalls) {
+		t.Errorf("calls = %v, expected %v", fake.Calls, expectedCalls)
+	}
+	if len(fake.Secrets) != 1 || fake.Secrets["app/db.password"]["value"] != "old" {
+		t.Errorf("staging should leave only the real secrets, got %v", fake.Secrets)
+	}
+
+	t.Run("failure", func(t *testing.T) {
+		fake := newFakeVaultWriter()
+		fake.Fail["app/.sops-to-vault-staging/token"] = errors.New("permission denied")
+		_, err := stageSecrets(context.Background(), fake, keys, data, underPath("app"), opts)
+		if err == nil || !strings.Contains(err.Error(), "staging app/token") {
+			t.Fatalf("expected staging error, got %v", err)
+		}
+		if len(fake.Secrets) != 0 {
+			t.Errorf("staged secrets should be removed, got %v", fake.Secrets)
+		}
+		if last := fake.Calls[len(fake.Calls)-1]; last != "delete app/.sops-to-vault-staging/db.password" {
+			t.Errorf("last call = %s, expected the staged secret deleted", last)
+		}
+	})
+}